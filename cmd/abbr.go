@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var abbreviationDefinitionPattern = regexp.MustCompile(`^ {0,3}\*\[([^\]]+)\]:[ \t]*(.*?)\s*$`)
+
+// kindAbbreviation is the goldmark node kind of abbreviations.
+var kindAbbreviation = gast.NewNodeKind("Abbreviation")
+
+// abbreviationNode is an occurrence of a defined abbreviation, rendered as
+// <abbr> with the expansion as its title.
+type abbreviationNode struct {
+	gast.BaseInline
+	title string
+}
+
+func (n *abbreviationNode) Kind() gast.NodeKind {
+	return kindAbbreviation
+}
+
+func (n *abbreviationNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Title": n.title}, nil)
+}
+
+type abbreviationTransformer struct{}
+
+// Transform removes the abbreviation definitions, paragraphs consisting of
+// lines such as *[HTML]: HyperText Markup Language, and marks up every
+// occurrence of the abbreviations in the text of the book. Definitions apply
+// to the whole book wherever they are written. Code is left alone.
+func (t *abbreviationTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	definitions := make(map[string]string)
+	var paragraphs []gast.Node
+	var texts []*gast.Text
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *gast.Paragraph:
+			if found := abbreviationDefinitions(n, source); found != nil {
+				for abbreviation, title := range found {
+					definitions[abbreviation] = title
+				}
+				paragraphs = append(paragraphs, n)
+				return gast.WalkSkipChildren, nil
+			}
+		case *gast.CodeSpan, *gast.CodeBlock, *gast.FencedCodeBlock, *gast.HTMLBlock, *gast.RawHTML:
+			return gast.WalkSkipChildren, nil
+		case *gast.Text:
+			texts = append(texts, n)
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, paragraph := range paragraphs {
+		paragraph.Parent().RemoveChild(paragraph.Parent(), paragraph)
+	}
+	if len(definitions) == 0 {
+		return
+	}
+
+	// Longer abbreviations take precedence over those they start with
+	var quoted []string
+	for abbreviation := range definitions {
+		quoted = append(quoted, regexp.QuoteMeta(abbreviation))
+	}
+	slices.SortFunc(quoted, func(a, b string) int { return len(b) - len(a) })
+	pattern := regexp.MustCompile(strings.Join(quoted, "|"))
+	for _, node := range texts {
+		markAbbreviations(node, source, pattern, definitions)
+	}
+}
+
+// abbreviationDefinitions returns the definitions of a paragraph made of
+// abbreviation definitions only.
+func abbreviationDefinitions(paragraph *gast.Paragraph, source []byte) map[string]string {
+	lines := paragraph.Lines()
+	if lines.Len() == 0 {
+		return nil
+	}
+	definitions := make(map[string]string)
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		match := abbreviationDefinitionPattern.FindSubmatch(segment.Value(source))
+		if match == nil {
+			return nil
+		}
+		definitions[strings.TrimSpace(string(match[1]))] = string(match[2])
+	}
+	return definitions
+}
+
+// markAbbreviations splits a text node around the abbreviations it contains,
+// which must not be part of a longer word.
+func markAbbreviations(node *gast.Text, source []byte, pattern *regexp.Regexp, definitions map[string]string) {
+	parent := node.Parent()
+	for {
+		value := node.Segment.Value(source)
+		var start, end int
+		found := false
+		for _, loc := range pattern.FindAllIndex(value, -1) {
+			if isWordBoundary(string(value), loc[0], loc[1]) {
+				start, end, found = loc[0], loc[1], true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+
+		segment := node.Segment
+		if start > 0 {
+			parent.InsertBefore(parent, node, gast.NewTextSegment(segment.WithStop(segment.Start+start)))
+		}
+		abbreviation := &abbreviationNode{title: definitions[string(value[start:end])]}
+		abbreviation.AppendChild(abbreviation, gast.NewTextSegment(text.NewSegment(segment.Start+start, segment.Start+end)))
+		parent.InsertBefore(parent, node, abbreviation)
+
+		node.Segment = segment.WithStart(segment.Start + end)
+		if node.Segment.Len() == 0 {
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				return
+			}
+			parent.RemoveChild(parent, node)
+			return
+		}
+	}
+}
+
+type abbreviationHTMLRenderer struct{}
+
+func (r *abbreviationHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAbbreviation, r.renderAbbreviation)
+}
+
+func (r *abbreviationHTMLRenderer) renderAbbreviation(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		n := node.(*abbreviationNode)
+		_, _ = w.WriteString(`<abbr title="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(n.title)))
+		_, _ = w.WriteString(`">`)
+	} else {
+		_, _ = w.WriteString("</abbr>")
+	}
+	return gast.WalkContinue, nil
+}
+
+type abbreviationExtension struct{}
+
+// abbreviations is a goldmark extension that renders defined abbreviations as
+// <abbr> elements.
+var abbreviations = &abbreviationExtension{}
+
+func (e *abbreviationExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&abbreviationTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&abbreviationHTMLRenderer{}, 500),
+	))
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAbbreviations(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "definitions apply to the whole book",
+			markdown: "The HTML spec.\n\n*[HTML]: HyperText Markup Language\n",
+			want:     `<p>The <abbr title="HyperText Markup Language">HTML</abbr> spec.</p>`,
+		},
+		{
+			name:     "longer abbreviations take precedence",
+			markdown: "*[W3]: World Wide Web\n*[W3C]: World Wide Web Consortium\n\nW3C and W3.",
+			want:     `<p><abbr title="World Wide Web Consortium">W3C</abbr> and <abbr title="World Wide Web">W3</abbr>.</p>`,
+		},
+		{
+			name:     "parts of words are left alone",
+			markdown: "*[EPUB]: Electronic Publication\n\nEPUBs and EPUB",
+			want:     `<p>EPUBs and <abbr title="Electronic Publication">EPUB</abbr></p>`,
+		},
+		{
+			name:     "code is left alone",
+			markdown: "*[CSS]: Cascading Style Sheets\n\n`CSS` and CSS",
+			want:     `<p><code>CSS</code> and <abbr title="Cascading Style Sheets">CSS</abbr></p>`,
+		},
+		{
+			name:     "titles are escaped",
+			markdown: "*[R&D]: Research & \"Development\"\n\nR&D",
+			want:     `<p><abbr title="Research &amp; &quot;Development&quot;">R&amp;D</abbr></p>`,
+		},
+		{
+			name:     "paragraphs with other lines are not definitions",
+			markdown: "*[HTML]: HyperText Markup Language\nand more",
+			want:     "<p>*[HTML]: HyperText Markup Language<br />\nand more</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{extensions: []string{"abbr"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	imgTagPattern = regexp.MustCompile(`<img\b[^>]*>`)
+	imgSrcPattern = regexp.MustCompile(`\bsrc="([^"]*)"`)
+	imgAltPattern = regexp.MustCompile(`\balt="([^"]*)"`)
+)
+
+// accessibilityPatch adds schema.org accessibility metadata to the package
+// document. When no access mode is specified, it is derived from the content.
+func accessibilityPatch(options generateOptions, htmlContent string) epubPatch {
+	accessModes := options.accessModes
+	if len(accessModes) == 0 {
+		accessModes = []string{"textual"}
+		if imgTagPattern.MatchString(htmlContent) {
+			accessModes = append(accessModes, "visual")
+		}
+	}
+
+	var meta strings.Builder
+	for _, mode := range accessModes {
+		fmt.Fprintf(&meta, "    <meta property=\"schema:accessMode\">%s</meta>\n", html.EscapeString(mode))
+	}
+	for _, feature := range options.accessibilityFeatures {
+		fmt.Fprintf(&meta, "    <meta property=\"schema:accessibilityFeature\">%s</meta>\n", html.EscapeString(feature))
+	}
+	if options.accessibilitySummary != "" {
+		fmt.Fprintf(&meta, "    <meta property=\"schema:accessibilitySummary\">%s</meta>\n", html.EscapeString(options.accessibilitySummary))
+	}
+
+	return epubPatch{
+		filename: packageFilename,
+		apply: func(content []byte) ([]byte, error) {
+			return insertBefore(content, "</metadata>", meta.String())
+		},
+	}
+}
+
+// accessibilityWarnings reports images without alternative text and headings
+// that skip a level.
+func accessibilityWarnings(htmlContent string) []string {
+	var warnings []string
+
+	for _, tag := range imgTagPattern.FindAllString(htmlContent, -1) {
+		if isDecorativeImage(tag) {
+			continue
+		}
+		alt := imgAltPattern.FindStringSubmatch(tag)
+		if alt != nil && strings.TrimSpace(alt[1]) != "" {
+			continue
+		}
+		src := ""
+		if match := imgSrcPattern.FindStringSubmatch(tag); match != nil {
+			src = match[1]
+		}
+		warnings = append(warnings, fmt.Sprintf("image %s has no alt text", src))
+	}
+
+	previousLevel := 0
+	for _, h := range extractHeadings(htmlContent) {
+		if previousLevel > 0 && h.level > previousLevel+1 {
+			warnings = append(warnings, fmt.Sprintf("heading %q skips from h%d to h%d", h.text, previousLevel, h.level))
+		}
+		previousLevel = h.level
+	}
+
+	return warnings
+}
+
+// isDecorativeImage reports whether an img tag is explicitly marked as
+// decorative and therefore needs no alternative text.
+func isDecorativeImage(tag string) bool {
+	return strings.Contains(tag, `role="presentation"`)
+}
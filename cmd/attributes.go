@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// parseAttributeList parses value as a whole attribute list such as
+// {#id .class key=value}.
+func parseAttributeList(value []byte) (parser.Attributes, int, bool) {
+	reader := text.NewReader(value)
+	attrs, ok := parser.ParseAttributes(reader)
+	if !ok {
+		return nil, 0, false
+	}
+	_, position := reader.Position()
+	return attrs, position.Start, true
+}
+
+func setAttributes(node gast.Node, attrs parser.Attributes) {
+	for _, attr := range attrs {
+		node.SetAttribute(attr.Name, attr.Value)
+	}
+}
+
+// attributeTargets are the kinds of inline nodes an attribute list directly
+// following them applies to.
+var attributeTargets = []gast.NodeKind{
+	gast.KindEmphasis, gast.KindLink, gast.KindImage, gast.KindCodeSpan, gast.KindAutoLink, east.KindStrikethrough,
+}
+
+type attributeTransformer struct{}
+
+// Transform applies attribute lists to the blocks and inline elements they
+// follow. A list on a line of its own applies to the block before it, and on
+// the last line of a paragraph to the paragraph:
+//
+//	Some paragraph.
+//	{.lead}
+//
+//	- a list
+//
+//	{#steps .compact}
+//
+// A list right after an emphasis, link, image or code span applies to it, as
+// in *important*{.warning}. Heading attributes are handled by the parser.
+func (t *attributeTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var paragraphs []*gast.Paragraph
+	var texts []*gast.Text
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *gast.Paragraph:
+			paragraphs = append(paragraphs, n)
+		case *gast.Text:
+			texts = append(texts, n)
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, text := range texts {
+		applyInlineAttributes(text, source)
+	}
+	for _, paragraph := range paragraphs {
+		applyBlockAttributes(paragraph, source)
+	}
+}
+
+func applyInlineAttributes(node *gast.Text, source []byte) {
+	previous := node.PreviousSibling()
+	if previous == nil || node.Segment.Len() == 0 || source[node.Segment.Start] != '{' {
+		return
+	}
+	isTarget := false
+	for _, kind := range attributeTargets {
+		isTarget = isTarget || previous.Kind() == kind
+	}
+	if !isTarget {
+		return
+	}
+
+	// Inline parsers such as linkify split text at spaces, so the list may
+	// continue in the following text nodes
+	texts := []*gast.Text{node}
+	for last := node; !last.SoftLineBreak() && !last.HardLineBreak(); {
+		next, ok := last.NextSibling().(*gast.Text)
+		if !ok || next.Segment.Start != last.Segment.Stop {
+			break
+		}
+		texts = append(texts, next)
+		last = next
+	}
+	attrs, consumed, ok := parseAttributeList(source[node.Segment.Start:texts[len(texts)-1].Segment.Stop])
+	if !ok {
+		return
+	}
+	setAttributes(previous, attrs)
+
+	end := node.Segment.Start + consumed
+	for _, text := range texts {
+		text.Segment = text.Segment.WithStart(min(max(text.Segment.Start, end), text.Segment.Stop))
+		if text.Segment.Len() == 0 && !text.SoftLineBreak() && !text.HardLineBreak() {
+			text.Parent().RemoveChild(text.Parent(), text)
+		}
+	}
+}
+
+func applyBlockAttributes(paragraph *gast.Paragraph, source []byte) {
+	lines := paragraph.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	last := lines.At(lines.Len() - 1)
+	value := bytes.TrimSpace(last.Value(source))
+	attrs, consumed, ok := parseAttributeList(value)
+	if !ok || consumed != len(value) {
+		return
+	}
+
+	parent := paragraph.Parent()
+	if lines.Len() == 1 {
+		target := paragraph.PreviousSibling()
+		if target == nil {
+			return
+		}
+		setAttributes(target, attrs)
+		parent.RemoveChild(parent, paragraph)
+		return
+	}
+
+	setAttributes(paragraph, attrs)
+	lines.SetSliced(0, lines.Len()-1)
+	// Remove the inline nodes of the attribute line and the line break
+	// before it
+	for child := paragraph.LastChild(); child != nil; child = paragraph.LastChild() {
+		text, ok := child.(*gast.Text)
+		if !ok || text.Segment.Start < last.Start {
+			break
+		}
+		paragraph.RemoveChild(paragraph, child)
+	}
+	if text, ok := paragraph.LastChild().(*gast.Text); ok {
+		text.SetSoftLineBreak(false)
+		text.SetHardLineBreak(false)
+	}
+}
+
+type attributeExtension struct{}
+
+// blockAttributes is a goldmark extension that applies attribute lists to
+// blocks and inline elements. Heading attributes are a parser option enabled
+// together with it.
+var blockAttributes = &attributeExtension{}
+
+func (e *attributeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithAttribute(),
+		parser.WithASTTransformers(util.Prioritized(&attributeTransformer{}, 500)),
+	)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		markdown   string
+		extensions []string
+		want       string
+	}{
+		{
+			name:     "last line of a paragraph",
+			markdown: "Some paragraph.\n{.lead}",
+			want:     `<p class="lead">Some paragraph.</p>`,
+		},
+		{
+			name:     "line of its own after a block",
+			markdown: "- a list\n\n{#steps .compact}",
+			want:     "<ul id=\"steps\" class=\"compact\">\n<li>a list</li>\n</ul>",
+		},
+		{
+			name:     "inline elements",
+			markdown: "Be *careful*{.warning} with [links](https://example.org){rel=nofollow}.",
+			want:     `<p>Be <em class="warning">careful</em> with <a href="https://example.org" rel="nofollow">links</a>.</p>`,
+		},
+		{
+			name:     "headings",
+			markdown: "## Setup {#setup .optional}",
+			want:     `<h2 id="setup" class="optional">Setup</h2>`,
+		},
+		{
+			name:       "inline lists with linkify",
+			markdown:   "See *this*{#this .note} and [that](that.md){.x .y}.",
+			extensions: []string{"attributes", "linkify"},
+			want:       `<p>See <em id="this" class="note">this</em> and <a href="that.md" class="x y">that</a>.</p>`,
+		},
+		{
+			name:     "braces after text are kept",
+			markdown: "A set {1, 2}",
+			want:     "<p>A set {1, 2}</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extensions := tt.extensions
+			if extensions == nil {
+				extensions = []string{"attributes"}
+			}
+			got, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{extensions: extensions})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	exportProfileDefault = "default"
+	exportProfileBraille = "braille"
+
+	// brailleLineWidth and brailleLinesPerPage are the dimensions of a
+	// standard braille page, which BRF files are laid out for.
+	brailleLineWidth    = 40
+	brailleLinesPerPage = 25
+)
+
+var validExportProfiles = []string{exportProfileDefault, exportProfileBraille}
+
+var (
+	tablePattern          = regexp.MustCompile(`(?s)<table\b[^>]*>.*?</table>`)
+	tableHeaderPattern    = regexp.MustCompile(`<th\b`)
+	tableStructurePattern = regexp.MustCompile(`</?(?:table|thead|tbody|tfoot|tr|td)\b[^>]*>`)
+	colorSpanPattern      = regexp.MustCompile(`(?s)<span\b[^>]*\bstyle="[^"]*\bcolor\s*:[^"]*"[^>]*>(.*?)</span>`)
+)
+
+func validateExportProfileOptions(options generateOptions) error {
+	if !slices.Contains(validExportProfiles, options.exportProfile) {
+		return fmt.Errorf("invalid export profile %s, expected one of %s", options.exportProfile, strings.Join(validExportProfiles, ", "))
+	}
+	return nil
+}
+
+// applyBrailleProfile rewrites constructs that only work visually. Emphasis
+// conveyed by colour alone becomes <em>, tables without header cells are
+// layout tables and are linearized, and image descriptions are shown as text
+// after their images.
+func applyBrailleProfile(htmlContent string) string {
+	htmlContent = colorSpanPattern.ReplaceAllString(htmlContent, "<em>$1</em>")
+
+	htmlContent = tablePattern.ReplaceAllStringFunc(htmlContent, func(table string) string {
+		if tableHeaderPattern.MatchString(table) {
+			return table
+		}
+		return tableStructurePattern.ReplaceAllStringFunc(table, func(tag string) string {
+			switch {
+			case strings.HasPrefix(tag, "<table"):
+				return `<div class="linearized-table">`
+			case strings.HasPrefix(tag, "</table"):
+				return "</div>"
+			case strings.HasPrefix(tag, "<tr"), strings.HasPrefix(tag, "<td"):
+				return "<div>"
+			case strings.HasPrefix(tag, "</tr"), strings.HasPrefix(tag, "</td"):
+				return "</div>"
+			}
+			return ""
+		})
+	})
+
+	return imgTagPattern.ReplaceAllStringFunc(htmlContent, func(tag string) string {
+		alt := imgAltPattern.FindStringSubmatch(tag)
+		if isDecorativeImage(tag) || alt == nil || strings.TrimSpace(alt[1]) == "" {
+			return tag
+		}
+		return tag + `<span class="image-description">Image: ` + alt[1] + "</span>"
+	})
+}
+
+// brailleCSS returns the rules that show image descriptions on their own line.
+func brailleCSS(options generateOptions) string {
+	if options.exportProfile != exportProfileBraille {
+		return ""
+	}
+	return `
+.image-description {
+    display: block;
+    font-style: italic;
+}
+`
+}
+
+// brailleTextFilename returns the path of the plain text written next to the
+// output by the braille profile.
+func brailleTextFilename(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".txt"
+}
+
+// exportBrailleText writes the text of htmlContent laid out for braille
+// pages: lines are wrapped at 40 characters, pages of 25 lines are separated
+// by form feeds. The text is ready for braille translation software producing BRF files.
+func exportBrailleText(filename, htmlContent string) error {
+	var lines []string
+	for _, block := range textBlocks(htmlContent) {
+		lines = append(lines, wrapText(block, brailleLineWidth)...)
+		lines = append(lines, "")
+	}
+
+	var text strings.Builder
+	for i, line := range lines {
+		if i > 0 && i%brailleLinesPerPage == 0 {
+			text.WriteString("\f")
+		}
+		text.WriteString(line + "\n")
+	}
+
+	if err := os.WriteFile(filename, []byte(text.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write braille text file: %w", err)
+	}
+	return nil
+}
+
+// textBlocks returns the text of the block elements and table rows of
+// htmlContent, with whitespace collapsed and list items marked. Images have no
+// text; the braille profile has added their descriptions after them.
+func textBlocks(htmlContent string) []string {
+	var blocks []string
+	var current strings.Builder
+	flush := func() {
+		if block := strings.Join(strings.Fields(current.String()), " "); block != "" {
+			blocks = append(blocks, block)
+		}
+		current.Reset()
+	}
+
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(htmlContent))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			flush()
+			return blocks
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case nethtml.TextToken:
+			current.WriteString(token.Data)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken, nethtml.EndTagToken:
+			switch {
+			case token.Data == "br" || token.Data == "td" || token.Data == "th":
+				current.WriteString(" ")
+			case token.Data == "li" && tokenType == nethtml.StartTagToken:
+				flush()
+				current.WriteString("- ")
+			case blockElements[token.Data] || token.Data == "tr" || token.Data == "hr":
+				flush()
+			}
+		}
+	}
+}
+
+// wrapText breaks text into lines of at most width characters at spaces.
+// Words longer than width are split.
+func wrapText(text string, width int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > width {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		if len(line) > 0 && len(line)+1+len(runes) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, runes...)
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyBrailleProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "colour emphasis",
+			html: `<p>Mind the <span style="color: red">gap</span></p>`,
+			want: `<p>Mind the <em>gap</em></p>`,
+		},
+		{
+			name: "layout tables are linearized",
+			html: `<table><tbody><tr><td>One</td><td>Two</td></tr></tbody></table>`,
+			want: `<div class="linearized-table"><div><div>One</div><div>Two</div></div></div>`,
+		},
+		{
+			name: "data tables are kept",
+			html: `<table><thead><tr><th>Name</th></tr></thead><tbody><tr><td>Tea</td></tr></tbody></table>`,
+			want: `<table><thead><tr><th>Name</th></tr></thead><tbody><tr><td>Tea</td></tr></tbody></table>`,
+		},
+		{
+			name: "image descriptions",
+			html: `<img src="map.png" alt="Map of the bay" /><img src="swash.png" alt="" />`,
+			want: `<img src="map.png" alt="Map of the bay" /><span class="image-description">Image: Map of the bay</span><img src="swash.png" alt="" />`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyBrailleProfile(tt.html); got != tt.want {
+				t.Errorf("applyBrailleProfile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{text: "the quick brown fox", width: 10, want: []string{"the quick", "brown fox"}},
+		{text: "  spaced   out  ", width: 40, want: []string{"spaced out"}},
+		{text: "a abcdefghij b", width: 4, want: []string{"a", "abcd", "efgh", "ij b"}},
+		{text: "日本語の文章", width: 3, want: []string{"日本語", "の文章"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := wrapText(tt.text, tt.width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("wrapText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportBrailleText(t *testing.T) {
+	var html strings.Builder
+	html.WriteString("<h1>Title</h1><ul><li>One</li><li>Two</li></ul><table><tr><td>A</td><td>B</td></tr></table>")
+	for range 20 {
+		html.WriteString("<p>Paragraph</p>")
+	}
+
+	filename := filepath.Join(t.TempDir(), "book.txt")
+	if err := exportBrailleText(filename, html.String()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(string(content), "\f")
+	if len(pages) != 2 {
+		t.Fatalf("exported text has %d pages, want 2", len(pages))
+	}
+	if want := "Title\n\n- One\n\n- Two\n\nA B\n\nParagraph\n"; !strings.HasPrefix(pages[0], want) {
+		t.Errorf("first page = %q, want it to start with %q", pages[0], want)
+	}
+	if lines := strings.Count(pages[0], "\n"); lines != brailleLinesPerPage {
+		t.Errorf("first page has %d lines, want %d", lines, brailleLinesPerPage)
+	}
+}
+
+func TestBrailleTextFilename(t *testing.T) {
+	if got := brailleTextFilename("out/book.epub"); got != "out/book.txt" {
+		t.Errorf("brailleTextFilename() = %s, want out/book.txt", got)
+	}
+	if err := validateExportProfileOptions(generateOptions{exportProfile: "large-print"}); err == nil {
+		t.Error("validateExportProfileOptions(large-print) error = nil, want an error")
+	}
+}
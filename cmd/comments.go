@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// keepAllComments is the --keep-comments value keeping every comment.
+const keepAllComments = "all"
+
+var (
+	commentPattern      = regexp.MustCompile(`(?s)^<!--(.*)-->$`)
+	commentLabelPattern = regexp.MustCompile(`^\s*([A-Za-z][\w-]*)\s*:`)
+)
+
+var (
+	kindCommentBlock  = gast.NewNodeKind("CommentBlock")
+	kindCommentInline = gast.NewNodeKind("CommentInline")
+)
+
+// commentBlock is an HTML block consisting of an HTML comment.
+type commentBlock struct {
+	gast.BaseBlock
+	text string
+}
+
+func (n *commentBlock) Kind() gast.NodeKind {
+	return kindCommentBlock
+}
+
+func (n *commentBlock) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Text": n.text}, nil)
+}
+
+// commentInline is an HTML comment within a paragraph.
+type commentInline struct {
+	gast.BaseInline
+	text string
+}
+
+func (n *commentInline) Kind() gast.NodeKind {
+	return kindCommentInline
+}
+
+func (n *commentInline) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Text": n.text}, nil)
+}
+
+type commentTransformer struct{}
+
+// Transform replaces HTML comments with comment nodes, so that comments are
+// handled the same way whatever the --html policy. It runs after the page
+// break transformer has taken the <!-- pagebreak --> markers.
+func (t *commentTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	type replacement struct {
+		node    gast.Node
+		comment gast.Node
+	}
+	var replacements []replacement
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *gast.HTMLBlock:
+			raw := string(n.Lines().Value(source))
+			if n.HasClosure() {
+				raw += string(n.ClosureLine.Value(source))
+			}
+			if comment, ok := commentText(raw); ok {
+				replacements = append(replacements, replacement{node, &commentBlock{text: comment}})
+			}
+			return gast.WalkSkipChildren, nil
+		case *gast.RawHTML:
+			if comment, ok := commentText(string(n.Segments.Value(source))); ok {
+				replacements = append(replacements, replacement{node, &commentInline{text: comment}})
+			}
+			return gast.WalkSkipChildren, nil
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, r := range replacements {
+		r.node.Parent().ReplaceChild(r.node.Parent(), r.node, r.comment)
+	}
+}
+
+// commentText returns the text of raw if it is a single HTML comment.
+func commentText(raw string) (string, bool) {
+	match := commentPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil || strings.Contains(match[1], "-->") {
+		return "", false
+	}
+	return match[1], true
+}
+
+// commentRenderer writes the comments selected by --keep-comments as XHTML
+// comments and drops the others.
+type commentRenderer struct {
+	labels []string
+}
+
+func (r *commentRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindCommentBlock, r.renderCommentBlock)
+	reg.Register(kindCommentInline, r.renderCommentInline)
+}
+
+func (r *commentRenderer) renderCommentBlock(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering && r.keep(node.(*commentBlock).text) {
+		_, _ = w.WriteString(xhtmlComment(node.(*commentBlock).text) + "\n")
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+func (r *commentRenderer) renderCommentInline(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering && r.keep(node.(*commentInline).text) {
+		_, _ = w.WriteString(xhtmlComment(node.(*commentInline).text))
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+// keep reports whether a comment is selected by its label, the word before
+// the first colon, as in <!-- editor: check the date -->.
+func (r *commentRenderer) keep(comment string) bool {
+	if slices.Contains(r.labels, keepAllComments) {
+		return true
+	}
+	match := commentLabelPattern.FindStringSubmatch(comment)
+	return match != nil && slices.ContainsFunc(r.labels, func(label string) bool {
+		return strings.EqualFold(label, match[1])
+	})
+}
+
+// xhtmlComment returns comment as an XML comment, which cannot contain "--"
+// or end with "-".
+func xhtmlComment(comment string) string {
+	for strings.Contains(comment, "--") {
+		comment = strings.ReplaceAll(comment, "--", "- -")
+	}
+	if strings.HasSuffix(comment, "-") {
+		comment += " "
+	}
+	return "<!--" + comment + "-->"
+}
+
+type commentExtension struct {
+	labels []string
+}
+
+// markdownComments returns a goldmark extension that keeps the HTML comments
+// labelled with one of labels, or all comments for "all", and strips the
+// others.
+func markdownComments(labels []string) goldmark.Extender {
+	return &commentExtension{labels: labels}
+}
+
+func (e *commentExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&commentTransformer{}, 600),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&commentRenderer{labels: e.labels}, 500),
+	))
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeepComments(t *testing.T) {
+	markdown := "<!-- editor: check the date -->\n\nText <!-- todo: cite --> here <!-- note -->.\n\n<!-- pagebreak -->\n"
+	tests := []struct {
+		name    string
+		options generateOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "comments are stripped by default",
+			options: generateOptions{extensions: []string{"pagebreak"}, htmlPolicy: htmlPassthrough},
+			want:    []string{"<p>Text  here .</p>", `<div class="page-break"></div>`},
+			notWant: []string{"<!--"},
+		},
+		{
+			name:    "labelled comments",
+			options: generateOptions{extensions: []string{"pagebreak"}, keepComments: []string{"Editor", "todo"}},
+			want:    []string{"<!-- editor: check the date -->\n", "Text <!-- todo: cite --> here ."},
+			notWant: []string{"<!-- note -->", "pagebreak -->"},
+		},
+		{
+			name:    "all comments",
+			options: generateOptions{keepComments: []string{keepAllComments}},
+			want:    []string{"<!-- note -->", "<!-- pagebreak -->"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("convertMarkdownToHTML() = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("convertMarkdownToHTML() = %q, want it not to contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestXHTMLComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{comment: " editor: fine ", want: "<!-- editor: fine -->"},
+		{comment: " a -- b ---", want: "<!-- a - - b - - - -->"},
+		{comment: "trailing-", want: "<!--trailing- -->"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.comment, func(t *testing.T) {
+			if got := xhtmlComment(tt.comment); got != tt.want {
+				t.Errorf("xhtmlComment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	configProfilesKey = "profiles"
+	configEnvPrefix   = "MARKDOWN_TO_EPUB_"
+)
+
+var profile string
+
+// configSkippedFlags are the flags that cannot be set from the config file.
+var configSkippedFlags = []string{"config", "profile", "help"}
+
+// configEnvSkippedFlags are the flags that cannot be set from environment
+// variables, since --exec commands, which may run markdown-to-epub again, get
+// the variables of the same names describing the book just built.
+var configEnvSkippedFlags = []string{"input", "output", "title"}
+
+// configExclusiveFlags maps flags to the flag that, given on the command line,
+// overrides them in the config file.
+var configExclusiveFlags = map[string]string{"verbose": "quiet", "quiet": "verbose"}
+
+// applyConfig sets the flags of cmd that are not given on the command line
+// from environment variables or the config file. The variable of a flag is its
+// name in upper case with underscores prefixed with MARKDOWN_TO_EPUB_, such as
+// MARKDOWN_TO_EPUB_TOC_DEPTH, and takes precedence over the config file. Keys
+// of the config file are flag names; the keys of the selected profile under
+// profiles take precedence over the top level keys, which take precedence
+// over the keys of the remote configs under extends:
+//
+//	extends:
+//	  - url: https://example.org/publishing/base.yaml
+//	    sha256: 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+//	author: Jane Doe
+//	language: en
+//	profiles:
+//	  fiction:
+//	    smart-punctuation: true
+//	    css: /home/jane/books/fiction.css
+//	  manual:
+//	    number-headings: true
+//	    toc-depth: 3
+func applyConfig(cmd *cobra.Command, profile string) error {
+	settings, err := resolveRemoteConfig(viper.AllSettings())
+	if err != nil {
+		return err
+	}
+	var profileSettings map[string]any
+	if profile != "" {
+		profiles, _ := settings[configProfilesKey].(map[string]any)
+		var ok bool
+		profileSettings, ok = profiles[strings.ToLower(profile)].(map[string]any)
+		if !ok {
+			return fmt.Errorf("profile %s not found in config file %s", profile, viper.ConfigFileUsed())
+		}
+		if err := resolveTheme(profileSettings); err != nil {
+			return err
+		}
+	}
+
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || slices.Contains(configSkippedFlags, flag.Name) {
+			return
+		}
+		if exclusive, ok := configExclusiveFlags[flag.Name]; ok && cmd.Flags().Changed(exclusive) {
+			return
+		}
+		if name, value, ok := configEnv(flag.Name); ok {
+			if setErr := flag.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid value of %s: %w", name, setErr)
+			}
+			return
+		}
+		value, ok := profileSettings[flag.Name]
+		if !ok {
+			value, ok = settings[flag.Name]
+		}
+		if !ok {
+			return
+		}
+		var setErr error
+		items, isList := value.([]any)
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok && isList {
+			// Items are set one by one since they may contain commas, as
+			// --exec commands do
+			setErr = sliceValue.Replace(configItems(items))
+		} else {
+			setErr = flag.Value.Set(configValue(value))
+		}
+		if setErr != nil {
+			err = fmt.Errorf("invalid value of %s in config file %s: %w", flag.Name, viper.ConfigFileUsed(), setErr)
+		}
+	})
+	return err
+}
+
+// configEnv returns the environment variable setting flag and its value, if
+// the variable is set.
+func configEnv(flag string) (string, string, bool) {
+	if slices.Contains(configEnvSkippedFlags, flag) {
+		return "", "", false
+	}
+	name := configEnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+	value, ok := os.LookupEnv(name)
+	return name, value, ok
+}
+
+// configSecret returns the value of the environment variable env, or else of
+// key in the profile or at the top level of the local config file. Secrets
+// have no flags, since command lines show in process lists and shell history,
+// and are not taken from remote configs.
+func configSecret(env, key string) string {
+	if value, ok := os.LookupEnv(env); ok {
+		return value
+	}
+	if profile != "" {
+		if value := viper.GetString(configProfilesKey + "." + strings.ToLower(profile) + "." + key); value != "" {
+			return value
+		}
+	}
+	return viper.GetString(key)
+}
+
+// configValue formats a config file value as a flag value. Lists become comma
+// separated values and maps become comma separated key=value pairs.
+func configValue(value any) string {
+	switch v := value.(type) {
+	case []any:
+		return strings.Join(configItems(v), ",")
+	case map[string]any:
+		var pairs []string
+		for key, item := range v {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, item))
+		}
+		slices.Sort(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+func configItems(values []any) []string {
+	items := make([]string, len(values))
+	for i, item := range values {
+		items[i] = fmt.Sprint(item)
+	}
+	return items
+}
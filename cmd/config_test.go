@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// isolateConfig points the config, cache and state directories to an empty
+// directory and resets viper, so that tests do not read the user's config.
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+}
+
+func TestApplyConfig(t *testing.T) {
+	const config = `author: File Author
+language: fr
+toc-depth: 2
+css:
+  - base.css
+  - print, screen.css
+profiles:
+  manual:
+    author: Profile Author
+    toc-depth: 3
+`
+	tests := []struct {
+		name    string
+		config  string
+		profile string
+		env     map[string]string
+		args    []string
+		want    map[string]string
+		err     string
+	}{
+		{
+			name: "defaults without config",
+			want: map[string]string{"author": "", "language": "en", "toc-depth": "1", "css": "[]"},
+		},
+		{
+			name:   "config file",
+			config: config,
+			want:   map[string]string{"author": "File Author", "language": "fr", "toc-depth": "2", "css": `[base.css,"print, screen.css"]`},
+		},
+		{
+			name:    "profile over config file",
+			config:  config,
+			profile: "manual",
+			want:    map[string]string{"author": "Profile Author", "language": "fr", "toc-depth": "3"},
+		},
+		{
+			name:    "profile names are case insensitive",
+			config:  config,
+			profile: "Manual",
+			want:    map[string]string{"author": "Profile Author"},
+		},
+		{
+			name:    "environment over profile",
+			config:  config,
+			profile: "manual",
+			env:     map[string]string{"MARKDOWN_TO_EPUB_AUTHOR": "Env Author", "MARKDOWN_TO_EPUB_TOC_DEPTH": "4"},
+			want:    map[string]string{"author": "Env Author", "language": "fr", "toc-depth": "4"},
+		},
+		{
+			name:    "flag over environment",
+			config:  config,
+			profile: "manual",
+			env:     map[string]string{"MARKDOWN_TO_EPUB_AUTHOR": "Env Author"},
+			args:    []string{"--author", "Flag Author"},
+			want:    map[string]string{"author": "Flag Author", "toc-depth": "3"},
+		},
+		{
+			name: "environment without config file",
+			env:  map[string]string{"MARKDOWN_TO_EPUB_LANGUAGE": "de"},
+			want: map[string]string{"language": "de"},
+		},
+		{
+			name: "variables of --exec commands are not read",
+			env:  map[string]string{"MARKDOWN_TO_EPUB_TITLE": "Built Book"},
+			want: map[string]string{"title": ""},
+		},
+		{
+			name:   "exclusive flag given on the command line",
+			config: "verbose: true\n",
+			args:   []string{"--quiet"},
+			want:   map[string]string{"verbose": "false", "quiet": "true"},
+		},
+		{
+			name:    "missing profile",
+			config:  config,
+			profile: "fiction",
+			err:     "profile fiction not found",
+		},
+		{
+			name: "invalid environment value",
+			env:  map[string]string{"MARKDOWN_TO_EPUB_TOC_DEPTH": "deep"},
+			err:  "invalid value of MARKDOWN_TO_EPUB_TOC_DEPTH",
+		},
+		{
+			name:   "invalid config value",
+			config: "toc-depth: deep\n",
+			err:    "invalid value of toc-depth in config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			if tt.config != "" {
+				filename := filepath.Join(t.TempDir(), "config.yaml")
+				writeFiles(t, filepath.Dir(filename), map[string]string{filepath.Base(filename): tt.config})
+				viper.SetConfigFile(filename)
+				if err := viper.ReadInConfig(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cmd := &cobra.Command{Use: "test"}
+			flags := cmd.Flags()
+			flags.String("author", "", "")
+			flags.String("language", "en", "")
+			flags.String("title", "", "")
+			flags.Int("toc-depth", 1, "")
+			flags.StringSlice("css", nil, "")
+			flags.Bool("verbose", false, "")
+			flags.Bool("quiet", false, "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyConfig(cmd, tt.profile)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("applyConfig() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyConfig() error = %v", err)
+			}
+			for name, want := range tt.want {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigSecret(t *testing.T) {
+	const config = `smtp-password: file secret
+profiles:
+  work:
+    smtp-password: profile secret
+`
+	tests := []struct {
+		name    string
+		config  string
+		profile string
+		env     string
+		want    string
+	}{
+		{name: "unset"},
+		{name: "config file", config: config, want: "file secret"},
+		{name: "profile over config file", config: config, profile: "Work", want: "profile secret"},
+		{name: "config file without the profile key", config: config, profile: "home", want: "file secret"},
+		{name: "environment over config file", config: config, profile: "work", env: "env secret", want: "env secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			saved := profile
+			t.Cleanup(func() { profile = saved })
+			profile = tt.profile
+			if tt.config != "" {
+				filename := filepath.Join(t.TempDir(), "config.yaml")
+				writeFiles(t, filepath.Dir(filename), map[string]string{filepath.Base(filename): tt.config})
+				viper.SetConfigFile(filename)
+				if err := viper.ReadInConfig(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.env != "" {
+				t.Setenv(smtpPasswordEnv, tt.env)
+			}
+
+			if got := configSecret(smtpPasswordEnv, smtpPasswordKey); got != tt.want {
+				t.Errorf("configSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
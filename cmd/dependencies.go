@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// dependencyGraph is the include graph of a book as exported by
+// --export-dependencies. The chapters are the files included by the input
+// file, each listed with every file it includes directly or through other
+// files. Dependents maps each included file to the chapters it is part of,
+// so that watchers and incremental builds can rebuild exactly the chapters
+// affected by an edited shared fragment.
+type dependencyGraph struct {
+	Input      string              `json:"input"`
+	Chapters   []chapterDependency `json:"chapters"`
+	Dependents map[string][]string `json:"dependents"`
+}
+
+type chapterDependency struct {
+	File     string   `json:"file"`
+	Includes []string `json:"includes"`
+}
+
+// dependencyGraph returns the include graph of the manuscript.
+func (m *manuscript) dependencyGraph() dependencyGraph {
+	graph := dependencyGraph{
+		Input:      m.filename,
+		Chapters:   []chapterDependency{},
+		Dependents: make(map[string][]string),
+	}
+	for _, chapter := range m.dependencies[m.filename] {
+		includes := []string{}
+		m.collectIncludes(chapter, &includes)
+		graph.Chapters = append(graph.Chapters, chapterDependency{File: chapter, Includes: includes})
+
+		for _, file := range append([]string{chapter}, includes...) {
+			if !slices.Contains(graph.Dependents[file], chapter) {
+				graph.Dependents[file] = append(graph.Dependents[file], chapter)
+			}
+		}
+	}
+	return graph
+}
+
+// collectIncludes appends the files included by filename, directly or
+// through other files, to includes in the order they are first included.
+func (m *manuscript) collectIncludes(filename string, includes *[]string) {
+	for _, included := range m.dependencies[filename] {
+		if slices.Contains(*includes, included) {
+			continue
+		}
+		*includes = append(*includes, included)
+		m.collectIncludes(included, includes)
+	}
+}
+
+func exportDependencies(filename string, graph dependencyGraph) error {
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dependencies: %w", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write dependencies file: %w", err)
+	}
+	return nil
+}
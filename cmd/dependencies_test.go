@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		files map[string]string
+		want  dependencyGraph
+	}{
+		{
+			name:  "chapters of a master document",
+			input: "book.md",
+			files: map[string]string{
+				"book.md":            "# Book\n<!-- include: chapters/one.md -->\n<!-- include: chapters/two.md -->\n",
+				"chapters/one.md":    "# One\n<!-- include: ../shared/glossary.md -->\n<!-- include: ../shared/glossary.md -->\n",
+				"chapters/two.md":    "# Two\n<!-- include: ../shared/note.md -->\n",
+				"shared/glossary.md": "Glossary\n",
+				"shared/note.md":     "<!-- include: glossary.md -->\n",
+				"shared/unused.md":   "Unused\n",
+			},
+			want: dependencyGraph{
+				Input: "book.md",
+				Chapters: []chapterDependency{
+					{File: "chapters/one.md", Includes: []string{"shared/glossary.md"}},
+					{File: "chapters/two.md", Includes: []string{"shared/note.md", "shared/glossary.md"}},
+				},
+				Dependents: map[string][]string{
+					"chapters/one.md":    {"chapters/one.md"},
+					"chapters/two.md":    {"chapters/two.md"},
+					"shared/glossary.md": {"chapters/one.md", "chapters/two.md"},
+					"shared/note.md":     {"chapters/two.md"},
+				},
+			},
+		},
+		{
+			name:  "a book without includes",
+			input: "book.md",
+			files: map[string]string{"book.md": "# Book\n"},
+			want:  dependencyGraph{Input: "book.md", Chapters: []chapterDependency{}, Dependents: map[string][]string{}},
+		},
+		{
+			name:  "files of a directory",
+			input: "book",
+			files: map[string]string{
+				"book/01.md":              "# One\n<!-- include: shared/glossary.md -->\n",
+				"book/02.md":              "# Two\n",
+				"book/shared/glossary.md": "Glossary\n",
+			},
+			want: dependencyGraph{
+				Input: "book",
+				Chapters: []chapterDependency{
+					{File: "book/01.md", Includes: []string{"book/shared/glossary.md"}},
+					{File: "book/02.md", Includes: []string{}},
+				},
+				Dependents: map[string][]string{
+					"book/01.md":              {"book/01.md"},
+					"book/02.md":              {"book/02.md"},
+					"book/shared/glossary.md": {"book/01.md"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			book, err := loadMarkdown(filepath.Join(dir, tt.input), sourceOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := relativeDependencyGraph(t, dir, book.dependencyGraph())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dependencyGraph() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// relativeDependencyGraph returns graph with the paths relative to dir.
+func relativeDependencyGraph(t *testing.T, dir string, graph dependencyGraph) dependencyGraph {
+	t.Helper()
+	relative := func(path string) string {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.ToSlash(rel)
+	}
+	relativeAll := func(paths []string) []string {
+		rels := []string{}
+		for _, path := range paths {
+			rels = append(rels, relative(path))
+		}
+		return rels
+	}
+
+	result := dependencyGraph{Input: relative(graph.Input), Chapters: []chapterDependency{}, Dependents: map[string][]string{}}
+	for _, chapter := range graph.Chapters {
+		result.Chapters = append(result.Chapters, chapterDependency{File: relative(chapter.File), Includes: relativeAll(chapter.Includes)})
+	}
+	for file, chapters := range graph.Dependents {
+		result.Dependents[relative(file)] = relativeAll(chapters)
+	}
+	return result
+}
+
+func TestExportDependencies(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "deps.json")
+	graph := dependencyGraph{
+		Input:      "book.md",
+		Chapters:   []chapterDependency{{File: "one.md", Includes: []string{}}},
+		Dependents: map[string][]string{"one.md": {"one.md"}},
+	}
+	if err := exportDependencies(filename, graph); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"includes": []`) {
+		t.Errorf("dependencies file = %s, want empty includes as []", content)
+	}
+	var got dependencyGraph
+	if err := json.Unmarshal(content, &got); err != nil || !reflect.DeepEqual(got, graph) {
+		t.Errorf("dependencies file = %s (%v), want %+v", content, err, graph)
+	}
+}
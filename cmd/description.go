@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	nethtml "golang.org/x/net/html"
+)
+
+func validateDescriptionOptions(options generateOptions) error {
+	if options.autoDescription < 0 {
+		return fmt.Errorf("auto description sentence count must not be negative")
+	}
+	return nil
+}
+
+// bookDescription returns the dc:description of the book: --description, or
+// with --auto-description the first sentences of the content. Chapters left
+// out with --only are not part of the content and do not contribute.
+func bookDescription(htmlContent string, options generateOptions) string {
+	if options.description != "" || options.autoDescription == 0 {
+		return options.description
+	}
+	return excerpt(htmlContent, options.autoDescription)
+}
+
+// excerptSkippedElements are the elements whose text is not prose of the
+// book, or not the prose a reader meets first, such as quotations and
+// rubies' readings.
+var excerptSkippedElements = []string{
+	"h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "figure", "figcaption", "table",
+	"ul", "ol", "dl", "pre", "nav", "aside", "rt", "rp", "sup",
+}
+
+// excerpt returns the first count sentences of the paragraphs of htmlContent.
+func excerpt(htmlContent string, count int) string {
+	var sentences []string
+	var paragraph strings.Builder
+	skipped := 0
+	inParagraph := false
+
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(htmlContent))
+	for len(sentences) < count {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case nethtml.TextToken:
+			if inParagraph && skipped == 0 {
+				paragraph.WriteString(token.Data)
+			}
+		case nethtml.StartTagToken:
+			if slices.Contains(excerptSkippedElements, token.Data) {
+				skipped++
+			} else if token.Data == "p" && skipped == 0 {
+				inParagraph = true
+			} else if token.Data == "br" && inParagraph {
+				paragraph.WriteString(" ")
+			}
+		case nethtml.SelfClosingTagToken:
+			if token.Data == "br" && inParagraph {
+				paragraph.WriteString(" ")
+			}
+		case nethtml.EndTagToken:
+			if slices.Contains(excerptSkippedElements, token.Data) && skipped > 0 {
+				skipped--
+			} else if token.Data == "p" && inParagraph {
+				inParagraph = false
+				sentences = append(sentences, splitSentences(paragraph.String())...)
+				paragraph.Reset()
+			}
+		}
+	}
+
+	if len(sentences) > count {
+		sentences = sentences[:count]
+	}
+	return joinSentences(sentences)
+}
+
+// splitSentences splits text at full stops, question marks and exclamation
+// marks followed by a space, and at CJK sentence endings, keeping closing
+// quotes and brackets with the sentence they end.
+func splitSentences(text string) []string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	var sentences []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		cjk := r == '。' || r == '！' || r == '？'
+		if !cjk && r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isSentenceCloser(runes[end]) {
+			end++
+		}
+		if !cjk && end < len(runes) && runes[end] != ' ' {
+			continue
+		}
+		if sentence := strings.TrimSpace(string(runes[start:end])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start, i = end, end-1
+	}
+	if sentence := strings.TrimSpace(string(runes[start:])); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// joinSentences joins sentences with spaces, except after CJK sentence
+// endings, which are not followed by spaces.
+func joinSentences(sentences []string) string {
+	var b strings.Builder
+	for i, sentence := range sentences {
+		if i > 0 {
+			last, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(sentences[i-1], isSentenceCloser))
+			if last != '。' && last != '！' && last != '？' {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(sentence)
+	}
+	return b.String()
+}
+
+// isSentenceCloser reports whether r is a closing quote or bracket, which
+// belongs to the sentence before it.
+func isSentenceCloser(r rune) bool {
+	return unicode.Is(unicode.Pe, r) || unicode.Is(unicode.Pf, r) || r == '"' || r == '\''
+}
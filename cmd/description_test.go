@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBookDescription(t *testing.T) {
+	const content = `<h1>Field Guide</h1>` +
+		`<blockquote><p>A quotation first.</p></blockquote>` +
+		`<p>Birds sing at dawn. Owls call at night! Do <em>you</em> listen?</p>` +
+		`<ul><li>Not prose.</li></ul>` +
+		`<p>Whales sing too.</p>`
+
+	tests := []struct {
+		name    string
+		options generateOptions
+		want    string
+	}{
+		{name: "none by default"},
+		{name: "--description", options: generateOptions{description: "A guide.", autoDescription: 2}, want: "A guide."},
+		{name: "first sentence", options: generateOptions{autoDescription: 1}, want: "Birds sing at dawn."},
+		{name: "sentences across paragraphs", options: generateOptions{autoDescription: 4}, want: "Birds sing at dawn. Owls call at night! Do you listen? Whales sing too."},
+		{name: "fewer sentences than asked", options: generateOptions{autoDescription: 10}, want: "Birds sing at dawn. Owls call at night! Do you listen? Whales sing too."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bookDescription(content, tt.options); got != tt.want {
+				t.Errorf("bookDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "One. Two? Three!", want: []string{"One.", "Two?", "Three!"}},
+		{text: `He said "Stop." Then left.`, want: []string{`He said "Stop."`, "Then left."}},
+		{text: "Version 1.2 is out. Yes", want: []string{"Version 1.2 is out.", "Yes"}},
+		{text: "鳥が鳴く。「朝だ！」夜。", want: []string{"鳥が鳴く。", "「朝だ！」", "夜。"}},
+		{text: "  spread\n over  lines. ", want: []string{"spread over lines."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := splitSentences(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("splitSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinSentences(t *testing.T) {
+	if got := joinSentences([]string{"鳥が鳴く。", "「朝だ！」", "Birds sing.", "Owls call."}); got != "鳥が鳴く。「朝だ！」Birds sing. Owls call." {
+		t.Errorf("joinSentences() = %q", got)
+	}
+}
+
+func TestValidateDescriptionOptions(t *testing.T) {
+	if err := validateDescriptionOptions(generateOptions{autoDescription: 3}); err != nil {
+		t.Errorf("validateDescriptionOptions(3) error = %v", err)
+	}
+	if err := validateDescriptionOptions(generateOptions{autoDescription: -1}); err == nil {
+		t.Error("validateDescriptionOptions(-1) error = nil, want an error")
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	validDirections   = []string{"ltr", "rtl"}
+	validWritingModes = []string{"horizontal-tb", "vertical-rl"}
+)
+
+func validateDirectionOptions(options generateOptions) error {
+	if !slices.Contains(validDirections, options.direction) {
+		return fmt.Errorf("invalid direction %s, expected one of %s", options.direction, strings.Join(validDirections, ", "))
+	}
+	if !slices.Contains(validWritingModes, options.writingMode) {
+		return fmt.Errorf("invalid writing mode %s, expected one of %s", options.writingMode, strings.Join(validWritingModes, ", "))
+	}
+	return nil
+}
+
+// pageProgressionDirection returns the spine page-progression-direction for
+// the options. Vertical text is read from right to left, so it pages the same
+// way as right-to-left scripts.
+func pageProgressionDirection(options generateOptions) string {
+	if options.direction == "rtl" || options.writingMode == "vertical-rl" {
+		return "rtl"
+	}
+	return ""
+}
+
+// directionCSS returns the stylesheet rules for the text direction and
+// writing mode of the options. Prefixed properties are included for reading
+// systems that predate the unprefixed writing-mode property.
+func directionCSS(options generateOptions) string {
+	var css strings.Builder
+	if options.direction == "rtl" {
+		css.WriteString(`
+html, body {
+    direction: rtl;
+}
+`)
+	}
+	if options.writingMode == "vertical-rl" {
+		css.WriteString(`
+html {
+    -epub-writing-mode: vertical-rl;
+    -webkit-writing-mode: vertical-rl;
+    writing-mode: vertical-rl;
+}
+`)
+	}
+	return css.String()
+}
+
+// writingModePatches returns the patches that declare a vertical writing mode
+// in the package metadata, which Kindle requires in addition to the CSS.
+func writingModePatches(options generateOptions) []epubPatch {
+	if options.writingMode != "vertical-rl" {
+		return nil
+	}
+	return []epubPatch{
+		{
+			filename: packageFilename,
+			apply: func(content []byte) ([]byte, error) {
+				return insertBefore(content, "</metadata>", "    <meta name=\"primary-writing-mode\" content=\"vertical-rl\"></meta>\n")
+			},
+		},
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexhokl/helper/iohelper"
+)
+
+const markdownExtension = ".md"
+
+// inputDir returns the directory relative paths of the book are resolved
+// against: the input directory, or the directory of the input file.
+func inputDir(filename string) string {
+	if iohelper.IsDirectoryExist(filename) {
+		return filename
+	}
+	return filepath.Dir(filename)
+}
+
+// loadDirectory reads the markdown files in dir and its subdirectories as
+// the chapters of a book, in the order of their paths, like a file including
+// each of them in turn. Files that other files include, with include
+// directives or as ![[note]] embeds, are left to the files including them.
+// In an Obsidian vault, this compiles every note of the vault into the book.
+func loadDirectory(dir string, options sourceOptions) (*manuscript, error) {
+	resolver, err := newIncludeResolver(dir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = walkSources(dir, options, func(path, rel string) error {
+		if isMarkdownFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no markdown files found in %s", dir)
+	}
+
+	included := make(map[string]bool)
+	for _, file := range files {
+		targets, err := resolver.includeTargets(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range targets {
+			if absTarget, err := filepath.Abs(target); err == nil {
+				included[absTarget] = true
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for _, file := range files {
+		if absFile, err := filepath.Abs(file); err == nil && included[absFile] {
+			continue
+		}
+		if err := resolver.includeInto(&body, dir, file); err != nil {
+			return nil, err
+		}
+	}
+	return resolver.manuscript(dir, frontMatter{}, body.Bytes()), nil
+}
+
+// includeTargets returns the files filename includes directly.
+func (r *includeResolver) includeTargets(filename string) ([]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read markdown file %s: %w", filename, err)
+	}
+	var targets []string
+	var fence codeFence
+	for line := range bytes.Lines(content) {
+		if fence.code(line) {
+			continue
+		}
+		if match := includeDirectivePattern.FindSubmatch(line); match != nil {
+			targets = append(targets, filepath.Join(filepath.Dir(filename), string(match[1])))
+		} else if r.vault != nil {
+			if target := r.vault.embeddedNote(line); target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets, nil
+}
+
+func isMarkdownFile(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), markdownExtension)
+}
+
+// sourceOptions control how the files of a book are found in an input
+// directory or Obsidian vault.
+type sourceOptions struct {
+	followSymlinks  bool
+	caseInsensitive bool
+
+	// vaultDir is the Obsidian vault of the book, found from the input when
+	// empty.
+	vaultDir string
+}
+
+// sourceWalker visits the files of a directory for walkSources.
+type sourceWalker struct {
+	options sourceOptions
+	rules   *ignoreRules
+	fn      func(path, rel string) error
+
+	// visited holds the directories walked, with symbolic links resolved,
+	// so that links to a parent directory do not loop.
+	visited map[string]bool
+
+	// folded maps the case folded paths visited to the paths.
+	folded map[string]string
+}
+
+// walkSources calls fn for each file under root in the order of their paths,
+// with the path of the file under root and its slash separated path relative
+// to root. Hidden files and directories, such as .git, and the files and
+// directories matching the .epubignore file in root are skipped. Symbolic
+// links are followed with options.followSymlinks and skipped otherwise.
+// Paths differing only by case, which case-insensitive file systems such as
+// those of macOS and Windows cannot hold, are an error with
+// options.caseInsensitive and reported otherwise.
+func walkSources(root string, options sourceOptions, fn func(path, rel string) error) error {
+	rules, err := loadIgnoreRules(root, options.caseInsensitive)
+	if err != nil {
+		return err
+	}
+	walker := &sourceWalker{
+		options: options,
+		rules:   rules,
+		fn:      fn,
+		visited: make(map[string]bool),
+		folded:  make(map[string]string),
+	}
+	return walker.walk(root, "")
+}
+
+func (w *sourceWalker) walk(dir, relDir string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.visited[realDir] {
+		slog.Warn("skipping directory already read through a symbolic link", "path", dir)
+		return nil
+	}
+	w.visited[realDir] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		rel := strings.TrimPrefix(relDir+"/"+entry.Name(), "/")
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !w.options.followSymlinks {
+				slog.Warn("skipping symbolic link, use --follow-symlinks to follow it", "path", path)
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				slog.Warn("skipping broken symbolic link", "path", path, "error", err)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+		if w.rules.ignored(rel, isDir) {
+			continue
+		}
+		if err := w.checkCase(rel); err != nil {
+			return err
+		}
+
+		if isDir {
+			err = w.walk(path, rel)
+		} else {
+			err = w.fn(path, rel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCase reports rel when a path visited before differs from it only by
+// case.
+func (w *sourceWalker) checkCase(rel string) error {
+	key := strings.ToLower(rel)
+	other, ok := w.folded[key]
+	if !ok {
+		w.folded[key] = rel
+		return nil
+	}
+	if w.options.caseInsensitive {
+		return fmt.Errorf("%s and %s differ only by case", other, rel)
+	}
+	slog.Warn("paths differ only by case, which case-insensitive file systems cannot tell apart", "path", rel, "other", other)
+	return nil
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		symlinks map[string]string
+		options  sourceOptions
+		want     string
+		err      string
+	}{
+		{
+			name: "files in the order of their paths",
+			files: map[string]string{
+				"02-middle.md":       "# Middle\n",
+				"01-beginning.md":    "# Beginning",
+				"03-end/01-end.md":   "# End\n",
+				"03-end/picture.png": "png",
+			},
+			want: "# Beginning\n# Middle\n# End\n",
+		},
+		{
+			name: "included files are left to the including file",
+			files: map[string]string{
+				"01-one.md":    "# One\n<!-- include: parts/two.md -->\n",
+				"parts/two.md": "# Two\n",
+				"03-three.md":  "# Three\n",
+			},
+			want: "# One\n# Two\n# Three\n",
+		},
+		{
+			name: "hidden files and directories are skipped",
+			files: map[string]string{
+				"one.md":        "# One\n",
+				".draft.md":     "# Draft\n",
+				".git/notes.md": "# Notes\n",
+			},
+			want: "# One\n",
+		},
+		{
+			name: "files matching .epubignore are skipped",
+			files: map[string]string{
+				".epubignore":               "scratch/\n/templates\n*.draft.md\n!epilogue.draft.md\n",
+				"one.md":                    "# One\n",
+				"one.draft.md":              "# One draft\n",
+				"epilogue.draft.md":         "# Epilogue\n",
+				"scratch/ideas.md":          "# Ideas\n",
+				"templates/chapter.md":      "# Template\n",
+				"chapters/templates/two.md": "# Two\n",
+			},
+			want: "# Two\n# Epilogue\n# One\n",
+		},
+		{
+			name:     "symbolic links are skipped",
+			files:    map[string]string{"one.md": "# One\n", "shared/two.md": "# Two\n"},
+			symlinks: map[string]string{"book/shared": "../shared", "book/one.md": "../one.md"},
+			err:      "no markdown files found",
+		},
+		{
+			name:     "symbolic links are followed",
+			files:    map[string]string{"one.md": "# One\n", "shared/two.md": "# Two\n"},
+			symlinks: map[string]string{"book/shared": "../shared", "book/one.md": "../one.md"},
+			options:  sourceOptions{followSymlinks: true},
+			want:     "# One\n# Two\n",
+		},
+		{
+			name:     "links to a parent directory do not loop",
+			files:    map[string]string{"book/one.md": "# One\n"},
+			symlinks: map[string]string{"book/loop": "."},
+			options:  sourceOptions{followSymlinks: true},
+			want:     "# One\n",
+		},
+		{
+			name:  "paths differing by case are reported",
+			files: map[string]string{"book/Notes.md": "# Upper\n", "book/notes.md": "# Lower\n"},
+			want:  "# Upper\n# Lower\n",
+		},
+		{
+			name:    "paths differing by case are errors when case-insensitive",
+			files:   map[string]string{"book/Notes.md": "# Upper\n", "book/notes.md": "# Lower\n"},
+			options: sourceOptions{caseInsensitive: true},
+			err:     "differ only by case",
+		},
+		{
+			name:    "ignore patterns match regardless of case when case-insensitive",
+			files:   map[string]string{"book/.epubignore": "drafts/\n", "book/Drafts/one.md": "# Draft\n", "book/two.md": "# Two\n"},
+			options: sourceOptions{caseInsensitive: true},
+			want:    "# Two\n",
+		},
+		{
+			name:  "directories without markdown files are errors",
+			files: map[string]string{"notes.txt": "notes"},
+			err:   "no markdown files found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			for link, target := range tt.symlinks {
+				link = filepath.Join(dir, link)
+				if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(target, link); err != nil {
+					t.Skipf("symbolic links are not supported: %v", err)
+				}
+			}
+			root := dir
+			if _, err := os.Stat(filepath.Join(dir, "book")); err == nil {
+				root = filepath.Join(dir, "book")
+			}
+
+			book, err := loadMarkdown(root, tt.options)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("loadMarkdown() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadMarkdown() error = %v", err)
+			}
+			if got := string(book.content); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"book.md": "# Book\n"})
+
+	if got := inputDir(dir); got != dir {
+		t.Errorf("inputDir(%s) = %s, want %s", dir, got, dir)
+	}
+	if got := inputDir(filepath.Join(dir, "book.md")); got != dir {
+		t.Errorf("inputDir(book.md) = %s, want %s", got, dir)
+	}
+}
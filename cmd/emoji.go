@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"regexp"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var emojiShortcodePattern = regexp.MustCompile(`^:([a-z0-9_+-]+):`)
+
+// emojiShortcodes maps the GitHub shortcodes of commonly used emoji to the
+// emoji. Shortcodes missing from the table are left as written.
+var emojiShortcodes = map[string]string{
+	// Faces
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "grin": "😁", "laughing": "😆",
+	"satisfied": "😆", "sweat_smile": "😅", "joy": "😂", "rofl": "🤣", "relaxed": "☺️",
+	"blush": "😊", "innocent": "😇", "slightly_smiling_face": "🙂", "upside_down_face": "🙃",
+	"wink": "😉", "relieved": "😌", "heart_eyes": "😍", "kissing_heart": "😘",
+	"yum": "😋", "stuck_out_tongue": "😛", "stuck_out_tongue_winking_eye": "😜",
+	"sunglasses": "😎", "nerd_face": "🤓", "thinking": "🤔", "neutral_face": "😐",
+	"expressionless": "😑", "no_mouth": "😶", "smirk": "😏", "unamused": "😒",
+	"roll_eyes": "🙄", "grimacing": "😬", "lying_face": "🤥", "pensive": "😔",
+	"sleepy": "😪", "sleeping": "😴", "mask": "😷", "nauseated_face": "🤢",
+	"sneezing_face": "🤧", "dizzy_face": "😵", "exploding_head": "🤯", "cowboy_hat_face": "🤠",
+	"partying_face": "🥳", "confused": "😕", "worried": "😟", "frowning_face": "☹️",
+	"open_mouth": "😮", "hushed": "😯", "astonished": "😲", "flushed": "😳",
+	"pleading_face": "🥺", "fearful": "😨", "cold_sweat": "😰", "cry": "😢", "sob": "😭",
+	"scream": "😱", "confounded": "😖", "persevere": "😣", "disappointed": "😞",
+	"sweat": "😓", "weary": "😩", "tired_face": "😫", "yawning_face": "🥱",
+	"triumph": "😤", "rage": "😡", "angry": "😠", "smiling_imp": "😈", "skull": "💀",
+	"poop": "💩", "clown_face": "🤡", "ghost": "👻", "alien": "👽", "robot": "🤖",
+	"see_no_evil": "🙈", "hear_no_evil": "🙉", "speak_no_evil": "🙊",
+
+	// People and gestures
+	"wave": "👋", "raised_hand": "✋", "hand": "✋", "ok_hand": "👌", "v": "✌️",
+	"crossed_fingers": "🤞", "point_left": "👈", "point_right": "👉", "point_up": "☝️",
+	"point_down": "👇", "+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎",
+	"fist": "✊", "punch": "👊", "clap": "👏", "raised_hands": "🙌", "open_hands": "👐",
+	"handshake": "🤝", "pray": "🙏", "writing_hand": "✍️", "muscle": "💪", "eyes": "👀",
+	"eye": "👁️", "brain": "🧠", "baby": "👶", "man": "👨", "woman": "👩",
+	"shrug": "🤷", "facepalm": "🤦", "bow": "🙇", "runner": "🏃", "dancer": "💃",
+
+	// Hearts and symbols
+	"heart": "❤️", "orange_heart": "🧡", "yellow_heart": "💛", "green_heart": "💚",
+	"blue_heart": "💙", "purple_heart": "💜", "black_heart": "🖤", "white_heart": "🤍",
+	"broken_heart": "💔", "two_hearts": "💕", "sparkling_heart": "💖", "100": "💯",
+	"anger": "💢", "boom": "💥", "collision": "💥", "dizzy": "💫", "sweat_drops": "💦",
+	"zzz": "💤", "speech_balloon": "💬", "thought_balloon": "💭", "sparkles": "✨",
+	"star": "⭐", "star2": "🌟", "fire": "🔥", "zap": "⚡", "warning": "⚠️",
+	"no_entry": "⛔", "no_entry_sign": "🚫", "x": "❌", "heavy_check_mark": "✔️",
+	"white_check_mark": "✅", "ballot_box_with_check": "☑️", "heavy_multiplication_x": "✖️",
+	"heavy_plus_sign": "➕", "heavy_minus_sign": "➖", "question": "❓", "grey_question": "❔",
+	"exclamation": "❗", "heavy_exclamation_mark": "❗", "grey_exclamation": "❕",
+	"bangbang": "‼️", "interrobang": "⁉️", "information_source": "ℹ️", "recycle": "♻️",
+	"copyright": "©️", "registered": "®️", "tm": "™️", "arrow_right": "➡️",
+	"arrow_left": "⬅️", "arrow_up": "⬆️", "arrow_down": "⬇️", "arrows_counterclockwise": "🔄",
+	"red_circle": "🔴", "large_blue_circle": "🔵", "green_circle": "🟢", "yellow_circle": "🟡",
+	"white_circle": "⚪", "black_circle": "⚫", "checkered_flag": "🏁", "triangular_flag_on_post": "🚩",
+
+	// Nature and weather
+	"sunny": "☀️", "cloud": "☁️", "umbrella": "☔", "snowflake": "❄️", "snowman": "⛄",
+	"rainbow": "🌈", "ocean": "🌊", "crescent_moon": "🌙", "earth_africa": "🌍",
+	"earth_americas": "🌎", "earth_asia": "🌏", "seedling": "🌱", "evergreen_tree": "🌲",
+	"deciduous_tree": "🌳", "palm_tree": "🌴", "cactus": "🌵", "herb": "🌿",
+	"four_leaf_clover": "🍀", "maple_leaf": "🍁", "fallen_leaf": "🍂", "cherry_blossom": "🌸",
+	"rose": "🌹", "sunflower": "🌻", "tulip": "🌷", "mushroom": "🍄", "dog": "🐶",
+	"cat": "🐱", "mouse": "🐭", "rabbit": "🐰", "fox_face": "🦊", "bear": "🐻",
+	"panda_face": "🐼", "koala": "🐨", "tiger": "🐯", "lion": "🦁", "cow": "🐮",
+	"pig": "🐷", "frog": "🐸", "monkey": "🐒", "chicken": "🐔", "penguin": "🐧",
+	"bird": "🐦", "owl": "🦉", "honeybee": "🐝", "bug": "🐛", "butterfly": "🦋",
+	"snail": "🐌", "turtle": "🐢", "snake": "🐍", "octopus": "🐙", "whale": "🐳",
+	"dolphin": "🐬", "fish": "🐟", "tropical_fish": "🐠", "crab": "🦀", "unicorn": "🦄",
+
+	// Food and drink
+	"apple": "🍎", "green_apple": "🍏", "pear": "🍐", "tangerine": "🍊", "lemon": "🍋",
+	"banana": "🍌", "watermelon": "🍉", "grapes": "🍇", "strawberry": "🍓", "cherries": "🍒",
+	"peach": "🍑", "tomato": "🍅", "avocado": "🥑", "carrot": "🥕", "corn": "🌽",
+	"bread": "🍞", "cheese": "🧀", "egg": "🥚", "hamburger": "🍔", "fries": "🍟",
+	"pizza": "🍕", "hotdog": "🌭", "taco": "🌮", "rice": "🍚", "ramen": "🍜",
+	"sushi": "🍣", "bento": "🍱", "cake": "🍰", "birthday": "🎂", "cookie": "🍪",
+	"chocolate_bar": "🍫", "candy": "🍬", "coffee": "☕", "tea": "🍵", "beer": "🍺",
+	"beers": "🍻", "wine_glass": "🍷", "cocktail": "🍸", "champagne": "🍾",
+
+	// Activities and objects
+	"tada": "🎉", "confetti_ball": "🎊", "balloon": "🎈", "gift": "🎁", "trophy": "🏆",
+	"medal_sports": "🏅", "1st_place_medal": "🥇", "soccer": "⚽", "basketball": "🏀",
+	"football": "🏈", "tennis": "🎾", "dart": "🎯", "game_die": "🎲", "video_game": "🎮",
+	"jigsaw": "🧩", "art": "🎨", "performing_arts": "🎭", "musical_note": "🎵",
+	"notes": "🎶", "microphone": "🎤", "headphones": "🎧", "guitar": "🎸", "book": "📖",
+	"books": "📚", "notebook": "📓", "memo": "📝", "pencil": "📝", "pencil2": "✏️",
+	"page_facing_up": "📄", "bookmark": "🔖", "label": "🏷️", "newspaper": "📰",
+	"scroll": "📜", "clipboard": "📋", "pushpin": "📌", "paperclip": "📎",
+	"scissors": "✂️", "calendar": "📆", "date": "📅", "file_folder": "📁",
+	"open_file_folder": "📂", "chart_with_upwards_trend": "📈",
+	"chart_with_downwards_trend": "📉", "bar_chart": "📊", "envelope": "✉️", "email": "📧",
+	"inbox_tray": "📥", "outbox_tray": "📤", "package": "📦", "mailbox": "📫",
+	"phone": "☎️", "iphone": "📱", "computer": "💻", "keyboard": "⌨️", "printer": "🖨️",
+	"camera": "📷", "movie_camera": "🎥", "tv": "📺", "radio": "📻", "bulb": "💡",
+	"flashlight": "🔦", "candle": "🕯️", "battery": "🔋", "electric_plug": "🔌",
+	"mag": "🔍", "mag_right": "🔎", "lock": "🔒", "unlock": "🔓", "key": "🔑",
+	"hammer": "🔨", "wrench": "🔧", "gear": "⚙️", "link": "🔗", "chains": "⛓️",
+	"toolbox": "🧰", "magnet": "🧲", "microscope": "🔬", "telescope": "🔭",
+	"satellite": "📡", "syringe": "💉", "pill": "💊", "moneybag": "💰", "dollar": "💵",
+	"credit_card": "💳", "gem": "💎", "bell": "🔔", "no_bell": "🔕", "loudspeaker": "📢",
+	"mega": "📣", "hourglass": "⌛", "hourglass_flowing_sand": "⏳", "watch": "⌚",
+	"alarm_clock": "⏰", "stopwatch": "⏱️", "timer_clock": "⏲️", "triangular_ruler": "📐",
+	"straight_ruler": "📏", "crystal_ball": "🔮", "dna": "🧬", "test_tube": "🧪",
+
+	// Travel and places
+	"rocket": "🚀", "airplane": "✈️", "car": "🚗", "red_car": "🚗", "taxi": "🚕",
+	"bus": "🚌", "train": "🚋", "bike": "🚲", "ship": "🚢", "boat": "⛵", "anchor": "⚓",
+	"construction": "🚧", "rotating_light": "🚨", "house": "🏠", "office": "🏢",
+	"hospital": "🏥", "school": "🏫", "european_castle": "🏰", "tent": "⛺",
+	"mountain": "⛰️", "volcano": "🌋", "desert_island": "🏝️", "world_map": "🗺️",
+	"compass": "🧭", "globe_with_meridians": "🌐", "statue_of_liberty": "🗽",
+	"japan": "🗾", "mount_fuji": "🗻",
+}
+
+type emojiParser struct{}
+
+func (p *emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *emojiParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	line, _ := block.PeekLine()
+	match := emojiShortcodePattern.FindSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	emoji, ok := emojiShortcodes[string(match[1])]
+	if !ok {
+		return nil
+	}
+	block.Advance(len(match[0]))
+	return gast.NewString([]byte(emoji))
+}
+
+type emojiExtension struct{}
+
+// emojiShortcode is a goldmark extension that replaces GitHub emoji
+// shortcodes such as :smile: and :+1: with the emoji.
+var emojiShortcode = &emojiExtension{}
+
+func (e *emojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&emojiParser{}, 500),
+	))
+}
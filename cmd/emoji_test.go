@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmojiShortcodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "shortcodes",
+			markdown: "Done :tada: :+1:",
+			want:     "<p>Done 🎉 👍</p>",
+		},
+		{
+			name:     "unknown shortcodes are kept",
+			markdown: "At 10:30:00 :not_an_emoji:",
+			want:     "<p>At 10:30:00 :not_an_emoji:</p>",
+		},
+		{
+			name:     "shortcodes in code are kept",
+			markdown: "`:smile:`",
+			want:     "<p><code>:smile:</code></p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{extensions: []string{"emoji"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
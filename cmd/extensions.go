@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdownExtensions maps the names accepted by --extensions to goldmark
+// extensions.
+var markdownExtensions = map[string]goldmark.Extender{
+	"table":         extension.Table,
+	"strikethrough": extension.Strikethrough,
+	"tasklist":      extension.TaskList,
+	"deflist":       extension.DefinitionList,
+	"abbr":          abbreviations,
+	"attributes":    blockAttributes,
+	"media":         media,
+	"footnote":      extension.Footnote,
+	"linkify":       extension.Linkify,
+	"emoji":         emojiShortcode,
+	"ruby":          rubyAnnotation,
+	"gallery":       imageGallery,
+	"pagebreak":     pageBreak,
+}
+
+// defaultMarkdownExtensions is the GitHub Flavored Markdown set plus
+// definition lists, abbreviations, attribute lists, ruby annotations, image
+// galleries, audio and video clips and page break markers.
+var defaultMarkdownExtensions = []string{"table", "strikethrough", "tasklist", "linkify", "deflist", "abbr", "attributes", "ruby", "gallery", "media", "pagebreak"}
+
+func availableMarkdownExtensions() []string {
+	var names []string
+	for name := range markdownExtensions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func validateExtensionOptions(options generateOptions) error {
+	return validateExtensionNames(options.extensions)
+}
+
+func validateExtensionNames(names []string) error {
+	for _, name := range names {
+		if _, ok := markdownExtensions[name]; !ok {
+			return fmt.Errorf("unknown markdown extension %s, expected one of %s", name, strings.Join(availableMarkdownExtensions(), ", "))
+		}
+	}
+	return nil
+}
+
+// enabledMarkdownExtensions returns the goldmark extensions for the extension
+// names.
+func enabledMarkdownExtensions(names []string) []goldmark.Extender {
+	var extensions []goldmark.Extender
+	for _, name := range names {
+		if ext, ok := markdownExtensions[name]; ok {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
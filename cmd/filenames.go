@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+const (
+	sectionFilenamesDefault = "default"
+	xhtmlExtension          = ".xhtml"
+)
+
+var sectionFilenamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// chapterFieldPattern matches the fields of templates that would describe
+// chapters, which the single content document of the book has none of.
+var chapterFieldPattern = regexp.MustCompile(`\.(Number|Slug)\b`)
+
+// sectionFilenamePresets are the names accepted by --section-filenames
+// besides templates, naming the documents from their titles.
+var sectionFilenamePresets = map[string]func(title string) string{
+	"slug": func(title string) string {
+		return string(newHeadingIDs(headingIDASCII).Generate([]byte(title), ast.KindHeading))
+	},
+}
+
+// sectionFilenames are the names of the content documents after the cover.
+type sectionFilenames struct {
+	content    string
+	statistics string
+}
+
+// sectionFilenameData is the data of --section-filenames templates. The
+// whole book is a single content document, so there is no chapter number or
+// title to name documents after.
+type sectionFilenameData struct {
+	Title string
+}
+
+func validateSectionFilenameOptions(options generateOptions) error {
+	_, err := resolveSectionFilenames(options, "Book", templateFuncs(options, frontMatter{}))
+	return err
+}
+
+// resolveSectionFilenames returns the filenames of the content documents for
+// --section-filenames. The default keeps section0001.xhtml and
+// statistics.xhtml; the slug preset and templates name the content document
+// after the book title and the statistics page after its own title. The
+// .xhtml extension is added when missing.
+func resolveSectionFilenames(options generateOptions, title string, funcs template.FuncMap) (sectionFilenames, error) {
+	if options.sectionFilenames == sectionFilenamesDefault {
+		return sectionFilenames{content: contentSectionFilename, statistics: statsSectionFilename}, nil
+	}
+	if options.sectionFilenames == "number" || chapterFieldPattern.MatchString(options.sectionFilenames) {
+		return sectionFilenames{}, fmt.Errorf("invalid section filenames %s: the book is a single content document rather than one per chapter, so there are no chapter numbers or slugs to name documents after; use slug or a template of .Title", options.sectionFilenames)
+	}
+
+	expand, err := sectionFilenameExpander(options.sectionFilenames, funcs)
+	if err != nil {
+		return sectionFilenames{}, err
+	}
+	var names []string
+	for _, sectionTitle := range []string{title, "Statistics"} {
+		name, err := expand(sectionTitle)
+		if err != nil {
+			return sectionFilenames{}, err
+		}
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(filepath.Ext(name), xhtmlExtension) {
+			name += xhtmlExtension
+		}
+		if name == xhtmlExtension || !sectionFilenamePattern.MatchString(name) {
+			return sectionFilenames{}, fmt.Errorf("invalid section filename %q, expected letters, digits, dots, hyphens and underscores only", name)
+		}
+		if name == coverSectionFilename || (len(names) > 0 && name == names[0]) {
+			return sectionFilenames{}, fmt.Errorf("section filename %s is used by several content documents", name)
+		}
+		names = append(names, name)
+	}
+	return sectionFilenames{content: names[0], statistics: names[1]}, nil
+}
+
+// sectionFilenameExpander returns the function naming a document from its
+// title for the preset or template value.
+func sectionFilenameExpander(value string, funcs template.FuncMap) (func(title string) (string, error), error) {
+	if preset, ok := sectionFilenamePresets[value]; ok {
+		return func(title string) (string, error) { return preset(title), nil }, nil
+	}
+	if !strings.Contains(value, "{{") {
+		return nil, fmt.Errorf("invalid section filenames %s, expected default, slug or a template", value)
+	}
+	tmpl, err := template.New("filename").Funcs(funcs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse section filename template: %w", err)
+	}
+	return func(title string) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, sectionFilenameData{Title: title}); err != nil {
+			return "", fmt.Errorf("failed to expand section filename template: %w", err)
+		}
+		return buf.String(), nil
+	}, nil
+}
+
+// sectionIDPatch prefixes the manifest IDs of the content documents whose
+// filenames do not start with a letter, such as 001.xhtml. go-epub uses the
+// filenames as IDs, which must be XML names.
+func sectionIDPatch(filenames sectionFilenames) epubPatch {
+	return epubPatch{
+		filename: packageFilename,
+		apply: func(content []byte) ([]byte, error) {
+			for _, name := range []string{filenames.content, filenames.statistics} {
+				if first, _ := utf8.DecodeRuneInString(name); unicode.IsLetter(first) || first == '_' {
+					continue
+				}
+				for _, attr := range []string{" id", "idref"} {
+					content = bytes.ReplaceAll(content, []byte(attr+`="`+name+`"`), []byte(attr+`="section-`+name+`"`))
+				}
+			}
+			return content, nil
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSectionFilenames(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		content    string
+		statistics string
+		err        string
+	}{
+		{name: "default", value: sectionFilenamesDefault, content: contentSectionFilename, statistics: statsSectionFilename},
+		{name: "slug", value: "slug", content: "field-guide.xhtml", statistics: "statistics.xhtml"},
+		{name: "template with extension", value: `book-{{ slugify .Title }}.XHTML`, content: "book-field-guide.XHTML", statistics: "book-statistics.XHTML"},
+		{name: "chapter numbers", value: "number", err: "single content document rather than one per chapter"},
+		{name: "chapter number in a template", value: `{{ printf "%02d" .Number }}`, err: "single content document rather than one per chapter"},
+		{name: "chapter slug in a template", value: `{{ .Slug }}`, err: "single content document rather than one per chapter"},
+		{name: "unknown preset", value: "title", err: "invalid section filenames title"},
+		{name: "invalid characters", value: "{{ .Title }}", err: `invalid section filename "Field Guide.xhtml"`},
+		{name: "same name for every document", value: "{{ if false }}{{ end }}book", err: "used by several content documents"},
+		{name: "undefined field", value: "{{ .Chapter }}", err: "failed to expand section filename template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := generateOptions{sectionFilenames: tt.value}
+			got, err := resolveSectionFilenames(options, "Field Guide", templateFuncs(options, frontMatter{}))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("resolveSectionFilenames() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.content != tt.content || got.statistics != tt.statistics {
+				t.Errorf("resolveSectionFilenames() = %+v, want %s and %s", got, tt.content, tt.statistics)
+			}
+		})
+	}
+}
+
+func TestSectionIDPatch(t *testing.T) {
+	opf := `<item id="001.xhtml" href="xhtml/001.xhtml"></item><item id="statistics.xhtml" href="xhtml/statistics.xhtml"></item>` +
+		`<itemref idref="001.xhtml"></itemref>`
+	got, err := sectionIDPatch(sectionFilenames{content: "001.xhtml", statistics: "statistics.xhtml"}).apply([]byte(opf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<item id="section-001.xhtml" href="xhtml/001.xhtml"></item><item id="statistics.xhtml" href="xhtml/statistics.xhtml"></item>` +
+		`<itemref idref="section-001.xhtml"></itemref>`
+	if string(got) != want {
+		t.Errorf("sectionIDPatch() = %s, want %s", got, want)
+	}
+}
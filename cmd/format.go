@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alexhokl/helper/iohelper"
+)
+
+const (
+	formatEpub = "epub"
+	formatHTML = "html"
+
+	epubContentDir = "EPUB/"
+)
+
+var validFormats = []string{formatEpub, formatHTML}
+
+// htmlExportSkippedFiles are the package documents that are of no use outside
+// an epub reading system.
+var htmlExportSkippedFiles = []string{"package.opf", "toc.ncx"}
+
+func validateFormatOptions(options generateOptions) error {
+	if !slices.Contains(validFormats, options.format) {
+		return fmt.Errorf("invalid format %s, expected one of %s", options.format, strings.Join(validFormats, ", "))
+	}
+	if options.format != formatHTML {
+		return nil
+	}
+	if iohelper.IsFileExist(options.epubFilename) {
+		return fmt.Errorf("output %s is a file, the html format writes a directory", options.epubFilename)
+	}
+	if iohelper.IsDirectoryExist(options.epubFilename) && !options.overwrite {
+		return fmt.Errorf("output directory %s already exists, use option -f to overwrite", options.epubFilename)
+	}
+	return nil
+}
+
+// writeOutput writes the packaged epub, or with the html format its content
+// documents, stylesheet and assets, to the output path of the options.
+func writeOutput(data []byte, options generateOptions) error {
+	if options.format == formatHTML {
+		return exportHTMLDirectory(data, options.epubFilename)
+	}
+	if err := os.WriteFile(options.epubFilename, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write epub file: %w", err)
+	}
+	return nil
+}
+
+// exportHTMLDirectory extracts the content directory of a packaged epub to
+// dir. The navigation document nav.xhtml is the entry point.
+func exportHTMLDirectory(data []byte, dir string) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed to read epub: %w", err)
+	}
+
+	for _, file := range reader.File {
+		name, ok := strings.CutPrefix(file.Name, epubContentDir)
+		if !ok || strings.HasSuffix(name, "/") || slices.Contains(htmlExportSkippedFiles, name) {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid archive entry %s", file.Name)
+		}
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path.Clean(name)))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", target, err)
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportHTMLDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "site")
+	if err := writeOutput(testEpub(t, "Book", "Hello"), generateOptions{format: formatHTML, epubFilename: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"nav.xhtml", "xhtml/section0001.xhtml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("exported file %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"package.opf", "toc.ncx", "mimetype", "META-INF"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("exported file %s exists, want it left out", name)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "xhtml/section0001.xhtml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "<p>Hello</p>") {
+		t.Errorf("exported section = %s, want the content", content)
+	}
+}
+
+func TestValidateFormatOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"book.epub": "", "site/nav.xhtml": ""})
+	tests := []struct {
+		name    string
+		options generateOptions
+		err     string
+	}{
+		{name: "epub", options: generateOptions{format: formatEpub, epubFilename: filepath.Join(dir, "book.epub")}},
+		{name: "html to a new directory", options: generateOptions{format: formatHTML, epubFilename: filepath.Join(dir, "new")}},
+		{name: "html overwriting a directory", options: generateOptions{format: formatHTML, epubFilename: filepath.Join(dir, "site"), overwrite: true}},
+		{name: "unknown format", options: generateOptions{format: "pdf"}, err: "invalid format pdf"},
+		{name: "html to a file", options: generateOptions{format: formatHTML, epubFilename: filepath.Join(dir, "book.epub")}, err: "is a file"},
+		{name: "html to an existing directory", options: generateOptions{format: formatHTML, epubFilename: filepath.Join(dir, "site")}, err: "already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFormatOptions(tt.options)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validateFormatOptions() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validateFormatOptions() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const frontMatterDelimiter = "---"
+
+// frontMatter is the YAML block at the start of a markdown file, delimited by
+// --- lines.
+type frontMatter struct {
+	// ChapterOpeners maps chapter heading IDs to images shown above the
+	// heading.
+	ChapterOpeners map[string]string `yaml:"chapter-openers"`
+
+	// Vars are variables available to templates in the markdown.
+	Vars map[string]string `yaml:"vars"`
+
+	// Translations maps language codes to the strings looked up by the t
+	// template function.
+	Translations map[string]map[string]string `yaml:"translations"`
+
+	// fields holds every key of the front matter, for schema validation.
+	fields map[string]any
+}
+
+// splitFrontMatter parses the front matter of content, if any, and returns it
+// together with the remaining markdown.
+func splitFrontMatter(content []byte) (frontMatter, []byte, error) {
+	var matter frontMatter
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines) == 0 || string(bytes.TrimSpace(lines[0])) != frontMatterDelimiter {
+		return matter, content, nil
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if string(bytes.TrimSpace(lines[i])) != frontMatterDelimiter {
+			continue
+		}
+		block := bytes.Join(lines[1:i], nil)
+		if err := yaml.Unmarshal(block, &matter); err != nil {
+			return matter, nil, fmt.Errorf("failed to parse front matter: %w", err)
+		}
+		if err := yaml.Unmarshal(block, &matter.fields); err != nil {
+			return matter, nil, fmt.Errorf("failed to parse front matter: %w", err)
+		}
+		return matter, bytes.Join(lines[i+1:], nil), nil
+	}
+
+	// Without a closing delimiter the leading --- is a thematic break
+	return matter, content, nil
+}
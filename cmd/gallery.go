@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	galleryLanguage       = "gallery"
+	defaultGalleryColumns = 2
+	maxGalleryColumns     = 4
+)
+
+var (
+	galleryImagePattern   = regexp.MustCompile(`^!\[([^\]]*)\]\(\s*(\S+?)(?:\s+"([^"]*)")?\s*\)$`)
+	galleryColumnsPattern = regexp.MustCompile(`\bcolumns=(\d+)`)
+)
+
+// kindGallery is the goldmark node kind of image galleries.
+var kindGallery = gast.NewNodeKind("Gallery")
+
+type galleryImage struct {
+	src     string
+	alt     string
+	caption string
+}
+
+// galleryNode is a grid of captioned images written as a fenced block with
+// the gallery info string and one markdown image per line:
+//
+//	```gallery columns=3
+//	![Harbour at dawn](harbour.jpg)
+//	![Market](market.jpg "The morning market")
+//	```
+type galleryNode struct {
+	gast.BaseBlock
+	columns int
+	images  []galleryImage
+}
+
+func (n *galleryNode) Kind() gast.NodeKind {
+	return kindGallery
+}
+
+func (n *galleryNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{
+		"Columns": strconv.Itoa(n.columns),
+	}, nil)
+}
+
+type galleryTransformer struct{}
+
+// Transform replaces gallery fenced blocks with gallery nodes before they
+// reach the code highlighter.
+func (t *galleryTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*gast.FencedCodeBlock
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if block, ok := node.(*gast.FencedCodeBlock); ok && entering && string(block.Language(source)) == galleryLanguage {
+			blocks = append(blocks, block)
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		gallery := &galleryNode{columns: defaultGalleryColumns}
+		if block.Info != nil {
+			if match := galleryColumnsPattern.FindSubmatch(block.Info.Segment.Value(source)); match != nil {
+				if columns, err := strconv.Atoi(string(match[1])); err == nil && columns >= 1 && columns <= maxGalleryColumns {
+					gallery.columns = columns
+				}
+			}
+		}
+
+		lines := block.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			match := galleryImagePattern.FindStringSubmatch(strings.TrimSpace(string(line.Value(source))))
+			if match == nil {
+				continue
+			}
+			caption := match[3]
+			if caption == "" {
+				caption = match[1]
+			}
+			gallery.images = append(gallery.images, galleryImage{
+				src:     match[2],
+				alt:     match[1],
+				caption: caption,
+			})
+		}
+
+		block.Parent().ReplaceChild(block.Parent(), block, gallery)
+	}
+}
+
+type galleryHTMLRenderer struct{}
+
+func (r *galleryHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGallery, r.renderGallery)
+}
+
+func (r *galleryHTMLRenderer) renderGallery(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	n := node.(*galleryNode)
+
+	_, _ = w.WriteString(`<div class="gallery gallery-columns-` + strconv.Itoa(n.columns) + "\">\n")
+	for _, image := range n.images {
+		_, _ = w.WriteString(`<figure class="gallery-item"><img src="`)
+		_, _ = w.Write(util.EscapeHTML(util.URLEscape([]byte(image.src), false)))
+		_, _ = w.WriteString(`" alt="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(image.alt)))
+		_, _ = w.WriteString(`" />`)
+		if image.caption != "" {
+			_, _ = w.WriteString("<figcaption>")
+			_, _ = w.Write(util.EscapeHTML([]byte(image.caption)))
+			_, _ = w.WriteString("</figcaption>")
+		}
+		_, _ = w.WriteString("</figure>\n")
+	}
+	_, _ = w.WriteString("</div>\n")
+	return gast.WalkSkipChildren, nil
+}
+
+type galleryExtension struct{}
+
+// imageGallery is a goldmark extension that renders gallery fenced blocks as
+// image grids.
+var imageGallery = &galleryExtension{}
+
+func (e *galleryExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&galleryTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&galleryHTMLRenderer{}, 500),
+	))
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
 
 	"github.com/alexhokl/helper/cli"
 	"github.com/alexhokl/helper/iohelper"
@@ -18,10 +20,14 @@ import (
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
 )
 
-const epubUserAgent = "markdown-to-epub/1.0"
+const (
+	epubUserAgent          = "markdown-to-epub/1.0"
+	contentSectionFilename = "section0001.xhtml"
+)
 
 // userAgentTransport wraps an http.RoundTripper and injects a User-Agent
 // header on every request so that servers that block the default Go client
@@ -37,16 +43,84 @@ func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error
 	return t.base.RoundTrip(r)
 }
 
+// typographicSubstitutions replaces goldmark's default HTML named entities,
+// which are not defined in XHTML, with the characters themselves.
+var typographicSubstitutions = extension.TypographicSubstitutions{
+	extension.LeftSingleQuote:  []byte("‘"),
+	extension.RightSingleQuote: []byte("’"),
+	extension.LeftDoubleQuote:  []byte("“"),
+	extension.RightDoubleQuote: []byte("”"),
+	extension.EnDash:           []byte("–"),
+	extension.EmDash:           []byte("—"),
+	extension.Ellipsis:         []byte("…"),
+	extension.LeftAngleQuote:   []byte("«"),
+	extension.RightAngleQuote:  []byte("»"),
+	extension.Apostrophe:       []byte("’"),
+}
+
 //go:embed style.css
 var defaultCSS string
 
 type generateOptions struct {
-	markdownFilename string
-	epubFilename     string
-	overwrite        bool
-	title            string
-	author           string
-	language         string
+	markdownFilename   string
+	epubFilename       string
+	overwrite          bool
+	title              string
+	author             string
+	description        string
+	autoDescription    int
+	publisher          string
+	cssFilename        string
+	fonts              []string
+	language           string
+	direction          string
+	writingMode        string
+	outlineFilename    string
+	dependenciesFile   string
+	wordsPerPage       int
+	wordsPerMinute     int
+	statsPage          bool
+	tocWordCounts      bool
+	json               bool
+	smartPunctuation   bool
+	noHardWraps        bool
+	extensions         []string
+	runningHeader      string
+	runningFooter      string
+	htmlPolicy         string
+	maxImageWidth      int
+	imageQuality       int
+	maxInlineImageSize int
+	grayscale          bool
+	rasterizeSVG       bool
+	svgDPI             int
+	pageBreakBefore    []string
+	numberHeadings     bool
+	numberExclude      []string
+	tocDepth           int
+	readAloud          bool
+	lexiconFilename    string
+	format             string
+	vaultDir           string
+	redact             []string
+	only               string
+	sectionFilenames   string
+	headingID          string
+	exportProfile      string
+	template           bool
+	vars               map[string]string
+	followSymlinks     bool
+	caseInsensitive    bool
+	exec               []string
+	keepComments       []string
+	ruleExec           []string
+
+	frontMatterSchemaFilename string
+	coverTemplateFilename     string
+
+	accessModes           []string
+	accessibilityFeatures []string
+	accessibilitySummary  string
 }
 
 var generateOps generateOptions
@@ -62,12 +136,62 @@ func init() {
 	rootCmd.AddCommand(generateCmd)
 
 	flags := generateCmd.Flags()
-	flags.StringVarP(&generateOps.markdownFilename, "input", "i", "", "Path to markdown file")
-	flags.StringVarP(&generateOps.epubFilename, "output", "o", "", "Path to output epub file")
+	flags.StringVarP(&generateOps.markdownFilename, "input", "i", "", "Path to markdown file, or directory of markdown files")
+	flags.StringVarP(&generateOps.epubFilename, "output", "o", "", "Path to output epub file, or directory with --format html")
+	flags.StringVar(&generateOps.format, "format", formatEpub, "Output format (epub, or html to write the XHTML and assets to a directory)")
+	flags.StringVar(&generateOps.exportProfile, "export-profile", exportProfileDefault, "Export profile (default, or braille to avoid visual-only constructs and write a BRF-ready text file)")
 	flags.BoolVarP(&generateOps.overwrite, "overwrite", "f", false, "Overwrite existing epub file")
 	flags.StringVarP(&generateOps.title, "title", "t", "", "Title of the book (defaults to filename)")
 	flags.StringVarP(&generateOps.author, "author", "a", "", "Author of the book")
+	flags.StringVar(&generateOps.description, "description", "", "Description of the book shown by libraries and stores")
+	flags.IntVar(&generateOps.autoDescription, "auto-description", 0, "Without --description, describe the book with this many sentences from the start of the content")
+	flags.StringVar(&generateOps.publisher, "publisher", "", "Publisher of the book")
+	flags.StringVar(&generateOps.cssFilename, "css", "", "Path to a stylesheet applied after the default one")
+	flags.StringSliceVar(&generateOps.fonts, "font", nil, "Font files to embed, referenced from --css as ../fonts/<filename>")
 	flags.StringVarP(&generateOps.language, "language", "l", "en", "Language code (e.g., en, ja, zh)")
+	flags.BoolVar(&generateOps.smartPunctuation, "smart-punctuation", false, "Convert quotes, dashes and ellipses to typographic punctuation")
+	flags.BoolVar(&generateOps.noHardWraps, "no-hard-wraps", false, "Do not render line breaks within paragraphs as <br />")
+	flags.StringSliceVar(&generateOps.extensions, "extensions", defaultMarkdownExtensions, fmt.Sprintf("Markdown extensions to enable (%s)", strings.Join(availableMarkdownExtensions(), ", ")))
+	flags.StringVar(&generateOps.runningHeader, "running-header", "", "Running header template, may contain {title}, {chapter} and {page}")
+	flags.StringVar(&generateOps.runningFooter, "running-footer", "", "Running footer template, may contain {title}, {chapter} and {page}")
+	flags.StringSliceVar(&generateOps.keepComments, "keep-comments", nil, "Labels of the HTML comments to keep as XHTML comments, such as editor for <!-- editor: ... -->, or all")
+	flags.StringVar(&generateOps.htmlPolicy, "html", htmlStrip, "Handling of raw HTML in the markdown (passthrough, sanitize or strip)")
+	flags.IntVar(&generateOps.maxImageWidth, "max-image-width", 0, "Downscale images wider than this many pixels")
+	flags.IntVar(&generateOps.imageQuality, "image-quality", 0, fmt.Sprintf("JPEG quality (1-100) to recompress images with (defaults to %d for resized images)", defaultImageQuality))
+	flags.IntVar(&generateOps.maxInlineImageSize, "max-inline-image-size", 0, "Leave out images embedded as data URIs larger than this many kilobytes")
+	flags.BoolVar(&generateOps.grayscale, "grayscale", false, "Convert images to grayscale")
+	flags.BoolVar(&generateOps.rasterizeSVG, "rasterize-svg", false, "Convert SVG images to PNG for reading systems without SVG support")
+	flags.IntVar(&generateOps.svgDPI, "svg-dpi", 192, "Resolution of SVG images converted to PNG")
+	flags.StringSliceVar(&generateOps.pageBreakBefore, "page-break-before", nil, "Heading levels that start a new page (h1 to h6)")
+	flags.BoolVar(&generateOps.numberHeadings, "number-headings", false, "Prefix headings with hierarchical numbers such as 1, 1.1 and 1.1.1")
+	flags.StringSliceVar(&generateOps.numberExclude, "number-exclude", nil, "Heading levels not to number (h1 to h6)")
+	flags.StringVar(&generateOps.headingID, "heading-id", headingIDGitHub, "Style of the IDs generated for headings: github, unicode or ascii")
+	flags.StringVar(&generateOps.sectionFilenames, "section-filenames", sectionFilenamesDefault, "Filenames of the content documents: default, slug, or a template using .Title")
+	flags.IntVar(&generateOps.tocDepth, "toc-depth", 2, "Deepest heading level listed in the table of contents (0 lists chapters only)")
+	flags.BoolVar(&generateOps.readAloud, "read-aloud", false, "Add text-to-speech hints: pronunciations from --lexicon and pauses at scene breaks")
+	flags.StringVar(&generateOps.lexiconFilename, "lexicon", "", "Path to a Pronunciation Lexicon Specification (PLS) file to embed")
+	flags.BoolVar(&generateOps.template, "template", false, "Expand {{ .Title }}, {{ .Date }} and other template variables in the markdown")
+	flags.StringVar(&generateOps.coverTemplateFilename, "cover-template", "", "Path to an XHTML template of the cover page")
+	flags.StringToStringVar(&generateOps.vars, "var", nil, "Template variable as key=value (implies --template)")
+	flags.StringVar(&generateOps.vaultDir, "vault", "", "Obsidian vault of the markdown file (defaults to the closest parent directory with a .obsidian folder)")
+	flags.BoolVar(&generateOps.followSymlinks, "follow-symlinks", false, "Follow symbolic links when reading an input directory or a vault")
+	flags.BoolVar(&generateOps.caseInsensitive, "case-insensitive", false, "Match .epubignore patterns case-insensitively and fail on paths differing only by case")
+	flags.StringVar(&generateOps.only, "only", "", `Build only the selected chapters, e.g. "chapters 3,5-7"`)
+	flags.StringSliceVar(&generateOps.redact, "redact", nil, fmt.Sprintf("Mask text matching the rules of profiles (%s) or YAML rule files", strings.Join(availableRedactionProfiles(), ", ")))
+	flags.StringVar(&generateOps.frontMatterSchemaFilename, "front-matter-schema", "", "Path to a YAML schema the front matter of chapters must match")
+	flags.StringVar(&generateOps.direction, "direction", "ltr", "Text direction (ltr or rtl)")
+	flags.StringVar(&generateOps.writingMode, "writing-mode", "horizontal-tb", "Writing mode (horizontal-tb or vertical-rl)")
+	flags.StringVar(&generateOps.outlineFilename, "export-outline", "", "Path to write the chapter and heading outline as JSON")
+	flags.StringVar(&generateOps.dependenciesFile, "export-dependencies", "", "Path to write the chapters and the files they include as JSON")
+	flags.IntVar(&generateOps.wordsPerPage, "words-per-page", 250, "Words per page used to estimate the page count")
+	flags.IntVar(&generateOps.wordsPerMinute, "words-per-minute", 200, "Words read per minute used to estimate reading times")
+	flags.BoolVar(&generateOps.statsPage, "stats-page", false, "Add a page listing the word counts and reading times of the chapters")
+	flags.BoolVar(&generateOps.tocWordCounts, "toc-word-counts", false, "Show the word counts and reading times of the chapters in the table of contents")
+	flags.StringArrayVar(&generateOps.exec, "exec", nil, "Command to run after a successful build, may contain {output}, {input} and {title}; may be repeated")
+	flags.BoolVar(&generateOps.json, "json", false, "Print a summary of the build with chapter statistics as JSON")
+	flags.StringSliceVar(&generateOps.accessModes, "access-mode", nil, "schema.org access modes (defaults to textual, plus visual when the book has images)")
+	flags.StringSliceVar(&generateOps.accessibilityFeatures, "accessibility-feature", []string{"structuralNavigation", "tableOfContents"}, "schema.org accessibility features")
+	flags.StringVar(&generateOps.accessibilitySummary, "accessibility-summary", "", "Human-readable summary of the accessibility of the book")
 
 	if err := generateCmd.MarkFlagRequired("input"); err != nil {
 		cli.LogUnableToMarkFlagAsRequired("input", err)
@@ -81,74 +205,314 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 	if err := validateGenerateOptions(generateOps); err != nil {
 		return err
 	}
-
-	// Read the Markdown file
-	content, err := os.ReadFile(generateOps.markdownFilename)
+	resetStages()
+
+	// Read the Markdown file, its front matter and included files
+	done := startStage("parse")
+	book, err := loadMarkdown(generateOps.markdownFilename, sourceOptions{
+		followSymlinks:  generateOps.followSymlinks,
+		caseInsensitive: generateOps.caseInsensitive,
+		vaultDir:        generateOps.vaultDir,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read markdown file: %w", err)
+		return err
+	}
+	matter, content := book.matter, book.content
+	for _, warning := range book.warnings {
+		slog.Warn(warning)
+	}
+
+	// Check chapter front matter against the project schema
+	if generateOps.frontMatterSchemaFilename != "" {
+		schema, err := loadFrontMatterSchema(generateOps.frontMatterSchemaFilename)
+		if err != nil {
+			return err
+		}
+		if err := schema.validateManuscript(book); err != nil {
+			return err
+		}
+	}
+
+	// Keep the selected chapters only
+	if generateOps.only != "" {
+		selection, err := parseChapterSelection(generateOps.only)
+		if err != nil {
+			return err
+		}
+		book, err = book.selectChapters(selection, bookTitle(content))
+		if err != nil {
+			return err
+		}
+		content = book.content
+	}
+
+	// Substitute template variables
+	if templateEnabled(generateOps, matter) {
+		expanded, sources, err := expandMarkdownTemplate(content, templateData(generateOps, matter, bookTitle(content)), templateFuncs(generateOps, matter))
+		if err != nil {
+			return err
+		}
+		book = book.withLines(expanded, sources)
+		content = book.content
+	}
+
+	// Mask secrets and other text not to be shared
+	if len(generateOps.redact) > 0 {
+		rules, err := loadRedactionRules(generateOps.redact)
+		if err != nil {
+			return err
+		}
+		content = redact(content, rules, book)
 	}
 
 	// Convert Markdown to HTML
-	htmlContent, err := convertMarkdownToHTML(content)
+	headingIDs := newHeadingIDs(generateOps.headingID)
+	wikilinks := newWikilinkResolver(book)
+	htmlContent, err := convertMarkdownToHTML(content, headingIDs, wikilinks, generateOps)
 	if err != nil {
 		return fmt.Errorf("failed to convert markdown to HTML: %w", err)
 	}
+	for _, warning := range wikilinks.warnings {
+		slog.Warn(warning)
+	}
+	done("files", len(book.chapters()), "lines", len(book.origins))
+
+	// Warn about links whose target anchor is shared by several headings
+	done = startStage("process")
+	for _, warning := range headingIDs.ambiguousLinkWarnings(htmlContent) {
+		slog.Warn(warning)
+	}
 
 	// Determine title
-	title := generateOps.title
-	if title == "" {
-		// Try to extract title from first H1 heading
-		title = extractTitleFromMarkdown(string(content))
-		if title == "" {
-			// Fall back to filename without extension
-			title = strings.TrimSuffix(filepath.Base(generateOps.markdownFilename), filepath.Ext(generateOps.markdownFilename))
-		}
+	title := bookTitle(content)
+
+	// Number headings
+	if generateOps.numberHeadings {
+		htmlContent = numberHeadings(htmlContent, title, generateOps.numberExclude)
+	}
+
+	// Render the cover page
+	coverHTML, err := generateCoverPage(title, templateData(generateOps, matter, title), templateFuncs(generateOps, matter))
+	if err != nil {
+		return err
+	}
+
+	// Name the content documents
+	filenames, err := resolveSectionFilenames(generateOps, title, templateFuncs(generateOps, matter))
+	if err != nil {
+		return err
+	}
+
+	// Place chapter opener images above their chapter headings
+	htmlContent, openerWarnings := insertChapterOpeners(htmlContent, matter.ChapterOpeners)
+	for _, warning := range openerWarnings {
+		slog.Warn(warning)
 	}
 
 	// Resolve local image paths relative to the markdown file's directory
-	markdownDir := filepath.Dir(generateOps.markdownFilename)
+	markdownDir := inputDir(generateOps.markdownFilename)
 	htmlContent = resolveLocalImageSrcs(htmlContent, markdownDir)
+	htmlContent = resolveLocalMediaSrcs(htmlContent, markdownDir)
+
+	// Add text-to-speech hints
+	if generateOps.readAloud {
+		htmlContent = markSceneBreaks(htmlContent)
+		if generateOps.lexiconFilename != "" {
+			words, err := loadLexicon(generateOps.lexiconFilename)
+			if err != nil {
+				return err
+			}
+			htmlContent = annotatePronunciations(htmlContent, words)
+		}
+	}
+
+	// Replace constructs that only work visually
+	if generateOps.exportProfile == exportProfileBraille {
+		htmlContent = applyBrailleProfile(htmlContent)
+	}
+
+	// Normalize HTML constructs known to break reading systems
+	normalizer := newHTMLNormalizer()
+	htmlContent = normalizer.normalize(htmlContent)
+
+	// Check for common accessibility problems
+	for _, warning := range accessibilityWarnings(htmlContent) {
+		slog.Warn(warning)
+	}
+
+	// Count words and estimate pages
+	stats := computeStats(htmlContent, title, generateOps)
+
+	// Normalize the other sections after the content, so that IDs of the
+	// content keep their names when the cover uses them too
+	coverHTML = normalizer.normalize(coverHTML)
+	var statsHTML string
+	if generateOps.statsPage {
+		statsHTML = normalizer.normalize(statsPage(stats))
+	}
+	if normalizer.report.changed() {
+		slog.Info("Normalized HTML", "fixes", normalizer.report)
+	}
+	done()
 
 	// Create ePub
-	if err := createEpub(title, htmlContent); err != nil {
+	if err := createEpub(title, coverHTML, htmlContent, statsHTML, stats, filenames); err != nil {
 		return fmt.Errorf("failed to create epub: %w", err)
 	}
 
-	fmt.Printf("Successfully created %s\n", generateOps.epubFilename)
+	// Export the outline
+	if generateOps.outlineFilename != "" {
+		if err := exportOutline(generateOps.outlineFilename, buildOutline(title, filenames.content, htmlContent)); err != nil {
+			return fmt.Errorf("failed to export outline: %w", err)
+		}
+	}
+
+	// Export the include graph of the chapters
+	if generateOps.dependenciesFile != "" {
+		if err := exportDependencies(generateOps.dependenciesFile, book.dependencyGraph()); err != nil {
+			return fmt.Errorf("failed to export dependencies: %w", err)
+		}
+	}
+
+	// Export the text for braille translation
+	if generateOps.exportProfile == exportProfileBraille {
+		textFilename := brailleTextFilename(generateOps.epubFilename)
+		if err := exportBrailleText(textFilename, htmlContent); err != nil {
+			return err
+		}
+		slog.Info("Braille text written", "file", textFilename)
+	}
+
+	slog.Info("Successfully created "+generateOps.epubFilename, "words", stats.words, "pages", stats.pages)
+
+	// Run post-generation hooks
+	if len(generateOps.exec) > 0 {
+		hook := hookData{output: generateOps.epubFilename, input: generateOps.markdownFilename, title: title}
+		if err := runHooks(generateOps.exec, hook); err != nil {
+			return err
+		}
+	}
+	logStageSummary()
+	if generateOps.json {
+		return printBuildSummary(generateOps.epubFilename, title, stats)
+	}
 	return nil
 }
 
 func validateGenerateOptions(options generateOptions) error {
-	if !iohelper.IsFileExist(options.markdownFilename) {
+	if !iohelper.IsFileExist(options.markdownFilename) && !iohelper.IsDirectoryExist(options.markdownFilename) {
 		return fmt.Errorf("markdown file %s does not exist", options.markdownFilename)
 	}
 
-	if iohelper.IsFileExist(options.epubFilename) && !options.overwrite {
+	if err := validateFormatOptions(options); err != nil {
+		return err
+	}
+
+	if options.format == formatEpub && iohelper.IsFileExist(options.epubFilename) && !options.overwrite {
 		return fmt.Errorf("epub file %s already exists, use option -f to overwrite", options.epubFilename)
 	}
 
+	if err := validateDirectionOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateStylesheetOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateStatsOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateExtensionOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateHTMLOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateImageOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateSVGOptions(options); err != nil {
+		return err
+	}
+
+	if err := validatePageBreakOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateNumberingOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateTOCOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateExportProfileOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateRedactOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateOnlyOptions(options); err != nil {
+		return err
+	}
+
+	if err := validateSectionFilenameOptions(options); err != nil {
+		return err
+	}
+	if err := validateDescriptionOptions(options); err != nil {
+		return err
+	}
+	if err := validateHeadingIDOptions(options); err != nil {
+		return err
+	}
+	if err := validateExecOptions(options); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func convertMarkdownToHTML(content []byte) (string, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("github"),
-			),
+func convertMarkdownToHTML(content []byte, ids *headingIDs, wikilinks *wikilinkResolver, options generateOptions) (string, error) {
+	extensions := enabledMarkdownExtensions(options.extensions)
+	extensions = append(extensions,
+		wikilinks,
+		markdownComments(options.keepComments),
+		rawHTMLPolicy(options.htmlPolicy),
+		highlighting.NewHighlighting(
+			highlighting.WithStyle("github"),
 		),
+	)
+	if options.smartPunctuation {
+		extensions = append(extensions, extension.NewTypographer(
+			extension.WithTypographicSubstitutions(typographicSubstitutions),
+		))
+	}
+
+	rendererOptions := []renderer.Option{
+		html.WithXHTML(),
+	}
+	if !options.noHardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(extensions...),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
-		goldmark.WithRendererOptions(
-			html.WithHardWraps(),
-			html.WithXHTML(),
-		),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
 
 	var buf bytes.Buffer
-	if err := md.Convert(content, &buf); err != nil {
+	if err := md.Convert(content, &buf, parser.WithContext(parser.NewContext(parser.WithIDs(ids)))); err != nil {
 		return "", err
 	}
 
@@ -165,8 +529,8 @@ func resolveLocalImageSrcs(htmlContent, markdownDir string) string {
 			return match
 		}
 		src := parts[2]
-		// Leave URLs and absolute paths untouched
-		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") || filepath.IsAbs(src) {
+		// Leave URLs, data URIs and absolute paths untouched
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") || isDataURL(src) || filepath.IsAbs(src) {
 			return match
 		}
 		abs := filepath.Join(markdownDir, src)
@@ -174,6 +538,20 @@ func resolveLocalImageSrcs(htmlContent, markdownDir string) string {
 	})
 }
 
+// bookTitle returns the --title option, the first H1 heading of the markdown
+// or the markdown filename, in that order of preference.
+func bookTitle(content []byte) string {
+	if generateOps.title != "" {
+		return generateOps.title
+	}
+	// Try to extract title from first H1 heading
+	if title := extractTitleFromMarkdown(string(content)); title != "" {
+		return title
+	}
+	// Fall back to filename without extension
+	return strings.TrimSuffix(filepath.Base(generateOps.markdownFilename), filepath.Ext(generateOps.markdownFilename))
+}
+
 func extractTitleFromMarkdown(content string) string {
 	lines := strings.SplitSeq(content, "\n")
 	for line := range lines {
@@ -185,7 +563,14 @@ func extractTitleFromMarkdown(content string) string {
 	return ""
 }
 
-func createEpub(title, htmlContent string) error {
+func createEpub(title, coverHTML, htmlContent, statsHTML string, stats bookStats, filenames sectionFilenames) error {
+	// Assemble the ePub in memory rather than in a directory under the
+	// system temp directory, so that builds work in read-only containers and
+	// concurrent builds do not share files
+	if err := epub.Use(epub.MemoryFS); err != nil {
+		return fmt.Errorf("failed to create epub: %w", err)
+	}
+
 	// Create a new ePub
 	e, err := epub.NewEpub(title)
 	if err != nil {
@@ -194,70 +579,151 @@ func createEpub(title, htmlContent string) error {
 
 	// Use a custom HTTP client that sends a descriptive User-Agent so that
 	// servers like Wikimedia do not reject HEAD/GET requests for images.
-	e.Client = &http.Client{
+	client := &http.Client{
 		Transport: &userAgentTransport{
 			userAgent: epubUserAgent,
 			base:      http.DefaultTransport,
 		},
 	}
+	e.Client = client
 
 	// Set metadata
 	e.SetLang(generateOps.language)
+	if ppd := pageProgressionDirection(generateOps); ppd != "" {
+		e.SetPpd(ppd)
+	}
 	if generateOps.author != "" {
 		e.SetAuthor(generateOps.author)
 	}
+	if description := bookDescription(htmlContent, generateOps); description != "" {
+		e.SetDescription(description)
+	}
+	if err := addFonts(e, generateOps); err != nil {
+		return err
+	}
 
 	var cssPath string
 
 	// Use embedded CSS
-	css := defaultCSS
-
-	// Write CSS to a temporary file (go-epub requires a file path or URL)
-	tmpFile, err := os.CreateTemp("", "epub-style-*.css")
+	css := defaultCSS + directionCSS(generateOps) + pageBreakCSS(generateOps) + readAloudCSS(generateOps) + brailleCSS(generateOps) + runningContentCSS(generateOps, title)
+	custom, err := userCSS(generateOps)
 	if err != nil {
-		return fmt.Errorf("failed to create temp CSS file: %w", err)
-	}
-	defer os.Remove(tmpFile.Name())
-
-	if _, err := tmpFile.WriteString(css); err != nil {
-		tmpFile.Close()
-		return fmt.Errorf("failed to write CSS to temp file: %w", err)
+		return err
 	}
-	tmpFile.Close()
+	css += custom
 
-	// Add CSS to ePub
-	cssPath, err = e.AddCSS(tmpFile.Name(), "style.css")
+	// Add CSS to ePub from memory, so that no temporary file is needed
+	cssPath, err = e.AddCSS(dataURL("text/css", []byte(css)), "style.css")
 	if err != nil {
 		return fmt.Errorf("failed to add CSS: %w", err)
 	}
 
+	// Download, optimize and embed all images referenced in the cover and
+	// the content
+	done := startStage("embed images")
+	images := newImageEmbedder(e, client, generateOps)
+	coverHTML = images.embed(coverHTML)
+	htmlContent = images.embed(htmlContent)
+	htmlContent = images.embedMedia(htmlContent)
+	if report := images.report(); report != "" {
+		slog.Info("Optimized images", "sizes", report)
+	}
+	done("images", len(images.paths)-images.media, "media", images.media)
+
 	// Add cover page as the first section
-	coverHTML := generateCoverPage(title)
-	_, err = e.AddSection(coverHTML, "Cover", "cover.xhtml", cssPath)
+	done = startStage("add sections")
+	_, err = e.AddSection(wrapSection(coverHTML, "cover"), "Cover", coverSectionFilename, cssPath)
 	if err != nil {
 		return fmt.Errorf("failed to add cover page: %w", err)
 	}
 
 	// Add the content as a section
-	_, err = e.AddSection(htmlContent, title, "", cssPath)
+	contentFilename, err := e.AddSection(wrapSection(htmlContent, "bodymatter chapter"), title, filenames.content, cssPath)
 	if err != nil {
 		return fmt.Errorf("failed to add section: %w", err)
 	}
 
-	// Download and embed all images referenced in the content
-	e.EmbedImages()
+	// Add the statistics page after the content
+	if statsHTML != "" {
+		if _, err := e.AddSection(wrapSection(statsHTML, "backmatter appendix"), "Statistics", filenames.statistics, cssPath); err != nil {
+			return fmt.Errorf("failed to add statistics page: %w", err)
+		}
+	}
+	done()
+
+	// Package the ePub and add the structures go-epub does not generate
+	done = startStage("write")
+	defer func() { done() }()
+	var buf bytes.Buffer
+	if _, err := e.WriteTo(&buf); err != nil {
+		return fmt.Errorf("failed to package epub: %w", err)
+	}
+	patches := landmarkPatches(contentFilename)
+	var annotations map[string]string
+	if generateOps.tocWordCounts {
+		annotations = tocWordCounts(stats)
+	}
+	patches = append(patches, tocPatch(buildOutline(title, contentFilename, htmlContent), generateOps.tocDepth, annotations))
+	patches = append(patches, accessibilityPatch(generateOps, htmlContent))
+	patches = append(patches, writingModePatches(generateOps)...)
+	patches = append(patches, pageCountPatch(stats.pages), svgMediaTypePatch(), sectionIDPatch(filenames))
+	if generateOps.publisher != "" {
+		patches = append(patches, publisherPatch(generateOps.publisher))
+	}
+	sections := []string{coverSectionFilename, contentFilename}
+	if statsHTML != "" {
+		sections = append(sections, filenames.statistics)
+	}
+	for _, section := range sections {
+		patches = append(patches, ssmlNamespacePatch(section))
+	}
+	if generateOps.lexiconFilename != "" {
+		lexicon, err := lexiconPatches(generateOps.lexiconFilename, sections, generateOps.language)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, lexicon...)
+	}
+	data, err := patchEpub(buf.Bytes(), patches)
+	if err != nil {
+		return fmt.Errorf("failed to patch epub: %w", err)
+	}
 
-	// Write the ePub file
-	if err := e.Write(generateOps.epubFilename); err != nil {
-		return fmt.Errorf("failed to write epub file: %w", err)
+	// Write the ePub file, or its content for the html format
+	if err := writeOutput(data, generateOps); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-// generateCoverPage creates an HTML cover page with the book title
-func generateCoverPage(title string) string {
-	return fmt.Sprintf(`<div class="cover-page">
+// generateCoverPage creates an HTML cover page with the book title, or with
+// --cover-template, expands the template with the template data.
+func generateCoverPage(title string, data map[string]string, funcs template.FuncMap) (string, error) {
+	if generateOps.coverTemplateFilename == "" {
+		return fmt.Sprintf(`<div class="cover-page">
 	<h1 class="cover-title">%s</h1>
-</div>`, title)
+</div>`, template.HTMLEscapeString(title)), nil
+	}
+
+	content, err := os.ReadFile(generateOps.coverTemplateFilename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cover template: %w", err)
+	}
+	cover, err := expandCoverTemplate(content, data, funcs)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand cover template %s: %w", generateOps.coverTemplateFilename, err)
+	}
+	return string(cover), nil
+}
+
+// publisherPatch records the publisher in the package metadata, which go-epub
+// has no setter for.
+func publisherPatch(publisher string) epubPatch {
+	return epubPatch{
+		filename: packageFilename,
+		apply: func(content []byte) ([]byte, error) {
+			return insertBefore(content, "</metadata>", fmt.Sprintf("    <dc:publisher>%s</dc:publisher>\n", template.HTMLEscapeString(publisher)))
+		},
+	}
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		options  generateOptions
+		want     string
+	}{
+		{
+			name:     "straight punctuation by default",
+			markdown: `"Wait" -- it's...`,
+			want:     `<p>&quot;Wait&quot; -- it's...</p>`,
+		},
+		{
+			name:     "smart punctuation",
+			markdown: `"Wait" -- it's...`,
+			options:  generateOptions{smartPunctuation: true},
+			want:     `<p>“Wait” – it’s…</p>`,
+		},
+		{
+			name:     "hard wraps by default",
+			markdown: "one\ntwo",
+			want:     "<p>one<br />\ntwo</p>",
+		},
+		{
+			name:     "no hard wraps",
+			markdown: "one\ntwo",
+			options:  generateOptions{noHardWraps: true},
+			want:     "<p>one\ntwo</p>",
+		},
+		{
+			name:     "extension not enabled",
+			markdown: "~~gone~~",
+			want:     "<p>~~gone~~</p>",
+		},
+		{
+			name:     "enabled extension",
+			markdown: "~~gone~~",
+			options:  generateOptions{extensions: []string{"strikethrough"}},
+			want:     "<p><del>gone</del></p>",
+		},
+		{
+			name:     "heading attributes",
+			markdown: "# Title {#intro}",
+			options:  generateOptions{extensions: []string{"attributes"}},
+			want:     `<h1 id="intro">Title</h1>`,
+		},
+		{
+			name:     "gallery",
+			markdown: "```gallery columns=3\n![Cat](cat.png \"A cat\")\n![Dog](dog.png)\nnot an image\n```",
+			options:  generateOptions{extensions: []string{"gallery"}},
+			want: `<div class="gallery gallery-columns-3">` + "\n" +
+				`<figure class="gallery-item"><img src="cat.png" alt="Cat" /><figcaption>A cat</figcaption></figure>` + "\n" +
+				`<figure class="gallery-item"><img src="dog.png" alt="Dog" /><figcaption>Dog</figcaption></figure>` + "\n" +
+				`</div>`,
+		},
+		{
+			name:     "gallery columns out of range",
+			markdown: "```gallery columns=9\n![Cat](cat.png)\n```",
+			options:  generateOptions{extensions: []string{"gallery"}},
+			want: `<div class="gallery gallery-columns-2">` + "\n" +
+				`<figure class="gallery-item"><img src="cat.png" alt="Cat" /><figcaption>Cat</figcaption></figure>` + "\n" +
+				`</div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateExtensionOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		wantErr    bool
+	}{
+		{name: "defaults", extensions: defaultMarkdownExtensions},
+		{name: "attributes", extensions: []string{"attributes"}},
+		{name: "none"},
+		{name: "unknown", extensions: []string{"table", "tables"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExtensionOptions(generateOptions{extensions: tt.extensions})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateExtensionOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateEpubWithoutTempDir(t *testing.T) {
+	saved := generateOps
+	t.Cleanup(func() { generateOps = saved })
+
+	dir := t.TempDir()
+	generateOps = generateOptions{epubFilename: filepath.Join(dir, "book.epub"), language: "en", tocDepth: 2}
+	// Builds must not need the temp directory, which containers may not
+	// have or may mount read-only
+	t.Setenv("TMPDIR", filepath.Join(dir, "missing"))
+
+	cover, err := generateCoverPage("Book", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createEpub("Book", cover, `<h1 id="book">Book</h1><p>Text.</p>`, "", bookStats{}, sectionFilenames{content: "content.xhtml"}); err != nil {
+		t.Fatalf("createEpub() error = %v", err)
+	}
+	data, err := os.ReadFile(generateOps.epubFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := zipContents(t, checkMimetype(t, data))
+	if css := contents["EPUB/css/style.css"]; !strings.Contains(css, defaultCSS) {
+		t.Errorf("style.css = %s, want the default stylesheet", css)
+	}
+	if xhtml := contents["EPUB/xhtml/content.xhtml"]; !strings.Contains(xhtml, "<p>Text.</p>") {
+		t.Errorf("content.xhtml = %s, want the content", xhtml)
+	}
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	fragmentLinkPattern = regexp.MustCompile(`<a\b[^>]*\bhref="#([^"]+)"`)
+	headingTagPattern   = regexp.MustCompile(`(?s)<h([1-6])\b([^>]*)>(.*?)</h[1-6]>`)
+	htmlTagPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// headingLevels are the heading element names accepted by options that select
+// heading levels.
+var headingLevels = []string{"h1", "h2", "h3", "h4", "h5", "h6"}
+
+// heading is a heading found in rendered HTML.
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+// extractHeadings returns the headings of htmlContent in document order.
+func extractHeadings(htmlContent string) []heading {
+	var headings []heading
+	for _, match := range headingTagPattern.FindAllStringSubmatch(htmlContent, -1) {
+		level, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		id := ""
+		if parts := idAttributePattern.FindStringSubmatch(match[2]); parts != nil {
+			id = parts[2]
+		}
+		headings = append(headings, heading{
+			level: level,
+			id:    id,
+			text:  headingText(match[3]),
+		})
+	}
+	return headings
+}
+
+// headingText returns the text of the inner HTML of a heading.
+func headingText(inner string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(inner, "")))
+}
+
+const (
+	headingIDGitHub  = "github"
+	headingIDUnicode = "unicode"
+	headingIDASCII   = "ascii"
+)
+
+var validHeadingIDStrategies = []string{headingIDGitHub, headingIDUnicode, headingIDASCII}
+
+func validateHeadingIDOptions(options generateOptions) error {
+	if !slices.Contains(validHeadingIDStrategies, options.headingID) {
+		return fmt.Errorf("invalid heading ID style %s, expected one of %s", options.headingID, strings.Join(validHeadingIDStrategies, ", "))
+	}
+	return nil
+}
+
+// headingIDs generates auto heading IDs for the whole book. It implements
+// goldmark's parser.IDs so that a single instance can be shared by every
+// conversion, keeping IDs unique across chapters. When two headings produce
+// the same slug, later ones receive a numeric suffix in document order and
+// the collision is recorded so that links to the shared slug can be flagged.
+type headingIDs struct {
+	strategy   string
+	values     map[string]bool
+	collisions map[string][]string
+}
+
+func newHeadingIDs(strategy string) *headingIDs {
+	return &headingIDs{
+		strategy:   strategy,
+		values:     make(map[string]bool),
+		collisions: make(map[string][]string),
+	}
+}
+
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	text := strings.TrimSpace(string(value))
+	var result string
+	switch s.strategy {
+	case headingIDUnicode:
+		result = unicodeSlug(text)
+	case headingIDASCII:
+		result = asciiSlug(text)
+	default:
+		result = githubSlug(text)
+	}
+	if result == "" {
+		if kind == ast.KindHeading {
+			result = "heading"
+		} else {
+			result = "id"
+		}
+	}
+	return []byte(s.unique(result))
+}
+
+// githubSlug returns the anchor GitHub gives a heading: the text in lower
+// case without punctuation and symbols, with each space replaced by a hyphen.
+// Letters of every script are kept.
+func githubSlug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.M, r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// unicodeSlug keeps the letters, digits and marks of every script in lower
+// case, joining the words with single hyphens.
+func unicodeSlug(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.M, r)
+	})
+	return strings.Join(words, "-")
+}
+
+// asciiTransliterations are the Latin letters that do not decompose into an
+// ASCII letter and combining marks.
+var asciiTransliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l", 'þ': "th", 'ı': "i",
+}
+
+// asciiSlug folds accented Latin letters to ASCII and drops the characters
+// of other scripts, joining the words with single hyphens.
+func asciiSlug(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		case asciiTransliterations[r] != "":
+			b.WriteString(asciiTransliterations[r])
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), "-")
+}
+
+func (s *headingIDs) Put(value []byte) {
+	s.values[string(value)] = true
+}
+
+func (s *headingIDs) unique(base string) string {
+	if !s.values[base] {
+		s.values[base] = true
+		return base
+	}
+	if len(s.collisions[base]) == 0 {
+		s.collisions[base] = []string{base}
+	}
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", base, i)
+		if !s.values[candidate] {
+			s.values[candidate] = true
+			s.collisions[base] = append(s.collisions[base], candidate)
+			return candidate
+		}
+	}
+}
+
+// ambiguousLinkWarnings returns a warning for every fragment link in
+// htmlContent that targets a heading slug shared by several headings.
+func (s *headingIDs) ambiguousLinkWarnings(htmlContent string) []string {
+	var warnings []string
+	for _, match := range fragmentLinkPattern.FindAllStringSubmatch(htmlContent, -1) {
+		target := match[1]
+		ids, ok := s.collisions[target]
+		if !ok {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"link to #%s is ambiguous: headings %s share this anchor, it resolves to the first one",
+			target,
+			strings.Join(ids, ", "),
+		))
+	}
+	return warnings
+}
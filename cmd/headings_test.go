@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestHeadingIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		headings []string
+		want     []string
+	}{
+		{
+			name:     "GitHub slugs",
+			headings: []string{"Getting Started", "API_reference v2", "  Trimmed  ", "Café & Crème", "第一章 はじめに"},
+			want:     []string{"getting-started", "api_reference-v2", "trimmed", "café--crème", "第一章-はじめに"},
+		},
+		{
+			name:     "Unicode slugs",
+			strategy: headingIDUnicode,
+			headings: []string{"API_reference v2", "Café & Crème", "第一章 はじめに"},
+			want:     []string{"api-reference-v2", "café-crème", "第一章-はじめに"},
+		},
+		{
+			name:     "ASCII slugs",
+			strategy: headingIDASCII,
+			headings: []string{"API_reference v2", "Café & Crème", "Straße Ærø", "第一章 はじめに"},
+			want:     []string{"api-reference-v2", "cafe-creme", "strasse-aero", "heading"},
+		},
+		{
+			name:     "duplicates get numeric suffixes in document order",
+			headings: []string{"Notes", "Notes", "Notes"},
+			want:     []string{"notes", "notes-1", "notes-2"},
+		},
+		{
+			name:     "suffixes skip IDs already in use",
+			headings: []string{"Notes 1", "Notes", "Notes"},
+			want:     []string{"notes-1", "notes", "notes-2"},
+		},
+		{
+			name:     "headings without letters",
+			headings: []string{"!!!", "???"},
+			want:     []string{"heading", "heading-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := tt.strategy
+			if strategy == "" {
+				strategy = headingIDGitHub
+			}
+			ids := newHeadingIDs(strategy)
+			var got []string
+			for _, heading := range tt.headings {
+				got = append(got, string(ids.Generate([]byte(heading), ast.KindHeading)))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Generate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHeadingIDOptions(t *testing.T) {
+	for _, strategy := range validHeadingIDStrategies {
+		if err := validateHeadingIDOptions(generateOptions{headingID: strategy}); err != nil {
+			t.Errorf("validateHeadingIDOptions(%s) error = %v", strategy, err)
+		}
+	}
+	if err := validateHeadingIDOptions(generateOptions{headingID: "pinyin"}); err == nil {
+		t.Error("validateHeadingIDOptions(pinyin) error = nil, want an error")
+	}
+}
+
+func TestAmbiguousLinkWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		headings []string
+		html     string
+		want     []string
+	}{
+		{
+			name:     "links to unique headings",
+			headings: []string{"Intro", "Notes"},
+			html:     `<a href="#intro">intro</a><a href="#notes">notes</a>`,
+		},
+		{
+			name:     "links to shared slugs",
+			headings: []string{"Notes", "Notes"},
+			html:     `<a href="#notes">notes</a><a href="#notes-1">second notes</a>`,
+			want:     []string{"link to #notes is ambiguous: headings notes, notes-1 share this anchor, it resolves to the first one"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := newHeadingIDs(headingIDGitHub)
+			for _, heading := range tt.headings {
+				ids.Generate([]byte(heading), ast.KindHeading)
+			}
+			if got := ids.ambiguousLinkWarnings(tt.html); !slices.Equal(got, tt.want) {
+				t.Errorf("ambiguousLinkWarnings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// hookData are the values substituted for the placeholders of --exec
+// commands.
+type hookData struct {
+	output string
+	input  string
+	title  string
+}
+
+func validateExecOptions(options generateOptions) error {
+	for _, command := range options.exec {
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("--exec command cannot be empty")
+		}
+	}
+	return nil
+}
+
+// runHooks runs the --exec commands in turn after a successful build,
+// stopping at the first one that fails. Commands run in the shell with
+// {output}, {input} and {title} replaced by quoted values, which are also set
+// as the environment variables MARKDOWN_TO_EPUB_OUTPUT, MARKDOWN_TO_EPUB_INPUT
+// and MARKDOWN_TO_EPUB_TITLE. Their output goes to standard error so that it
+// does not mix with --json.
+func runHooks(commands []string, data hookData) error {
+	replacer := strings.NewReplacer(
+		"{output}", shellQuote(data.output),
+		"{input}", shellQuote(data.input),
+		"{title}", shellQuote(data.title),
+	)
+	env := append(os.Environ(),
+		"MARKDOWN_TO_EPUB_OUTPUT="+data.output,
+		"MARKDOWN_TO_EPUB_INPUT="+data.input,
+		"MARKDOWN_TO_EPUB_TITLE="+data.title,
+	)
+
+	for _, line := range commands {
+		done := startStage("exec")
+		command := shellCommand(replacer.Replace(line))
+		command.Env = env
+		command.Stdout = os.Stderr
+		command.Stderr = os.Stderr
+		slog.Info("Running hook", "command", line)
+		if err := command.Run(); err != nil {
+			return fmt.Errorf("hook %s failed: %w", line, err)
+		}
+		done("command", line)
+	}
+	return nil
+}
+
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+// shellQuote quotes value as a single word of the shell running hooks.
+func shellQuote(value string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are sh commands")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	data := hookData{output: filepath.Join(dir, "my book.epub"), input: "book.md", title: "Jane's Book"}
+	commands := []string{
+		`printf '%s|%s|%s\n' {output} {input} {title} >> ` + log,
+		`printf '%s|%s\n' "$MARKDOWN_TO_EPUB_OUTPUT" "$MARKDOWN_TO_EPUB_TITLE" >> ` + log,
+	}
+	if err := runHooks(commands, data); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := data.output + "|book.md|Jane's Book\n" + data.output + "|Jane's Book\n"
+	if string(content) != want {
+		t.Errorf("hooks wrote %q, want %q", content, want)
+	}
+}
+
+func TestRunHooksStopsAtFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are sh commands")
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	err := runHooks([]string{"exit 3", "touch " + marker}, hookData{})
+	if err == nil || !strings.Contains(err.Error(), "hook exit 3 failed") {
+		t.Errorf("runHooks() error = %v, want the failing hook", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("runHooks() ran the hook after the failing one")
+	}
+}
+
+func TestValidateExecOptions(t *testing.T) {
+	if err := validateExecOptions(generateOptions{exec: []string{"epubcheck {output}"}}); err != nil {
+		t.Errorf("validateExecOptions() error = %v", err)
+	}
+	if err := validateExecOptions(generateOptions{exec: []string{" "}}); err == nil {
+		t.Error("validateExecOptions() of an empty command error = nil, want an error")
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const ignoreFilename = ".epubignore"
+
+// ignorePattern is a pattern of an .epubignore file, which follows the
+// syntax of .gitignore files.
+type ignorePattern struct {
+	pattern *regexp.Regexp
+	negated bool
+	dirOnly bool
+}
+
+// ignoreRules are the patterns of the .epubignore file at the top of a
+// directory. The last pattern matching a path decides whether it is ignored.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+// loadIgnoreRules reads the .epubignore file in dir. A directory without one
+// ignores nothing.
+func loadIgnoreRules(dir string, ignoreCase bool) (*ignoreRules, error) {
+	filename := filepath.Join(dir, ignoreFilename)
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &ignoreRules{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %s: %w", filename, err)
+	}
+
+	rules := &ignoreRules{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		pattern, ok, err := parseIgnorePattern(scanner.Text(), ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in %s:%d: %w", filename, lineNumber, err)
+		}
+		if ok {
+			rules.patterns = append(rules.patterns, pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %s: %w", filename, err)
+	}
+	return rules, nil
+}
+
+// parseIgnorePattern parses a line of an .epubignore file. It reports false
+// for blank lines and comments.
+func parseIgnorePattern(line string, ignoreCase bool) (ignorePattern, bool, error) {
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false, nil
+	}
+
+	var pattern ignorePattern
+	if rest, ok := strings.CutPrefix(line, "!"); ok {
+		pattern.negated = true
+		line = rest
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if rest, ok := strings.CutSuffix(line, "/"); ok {
+		pattern.dirOnly = true
+		line = rest
+	}
+	// A pattern with a slash other than at its end is relative to the
+	// directory of the .epubignore file; others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignorePattern{}, false, nil
+	}
+
+	expression := globExpression(line)
+	if !anchored {
+		expression = "(?:.*/)?" + expression
+	}
+	expression = "^" + expression + "$"
+	if ignoreCase {
+		expression = "(?i)" + expression
+	}
+	var err error
+	pattern.pattern, err = regexp.Compile(expression)
+	if err != nil {
+		return ignorePattern{}, false, err
+	}
+	return pattern, true, nil
+}
+
+// globExpression translates a gitignore glob to a regular expression. * and
+// ? do not match slashes, while ** matches any number of directories.
+func globExpression(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				switch {
+				case strings.HasPrefix(glob[i:], "**/"):
+					b.WriteString("(?:.*/)?")
+					i += 2
+				default:
+					b.WriteString(".*")
+					i++
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if rest, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + rest
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignored reports whether the file or directory at the slash separated path
+// rel is ignored.
+func (r *ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range r.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.pattern.MatchString(rel) {
+			ignored = !pattern.negated
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		patterns   string
+		ignoreCase bool
+		path       string
+		isDir      bool
+		want       bool
+	}{
+		{name: "no patterns", path: "one.md"},
+		{name: "name at any depth", patterns: "notes.md", path: "drafts/notes.md", want: true},
+		{name: "star does not match slashes", patterns: "drafts*", path: "drafts/notes.md"},
+		{name: "star glob", patterns: "*.draft.md", path: "chapters/one.draft.md", want: true},
+		{name: "question mark", patterns: "ch?.md", path: "ch1.md", want: true},
+		{name: "character class", patterns: "ch[0-9].md", path: "chx.md"},
+		{name: "negated character class", patterns: "ch[!0-9].md", path: "chx.md", want: true},
+		{name: "anchored pattern", patterns: "/templates", path: "book/templates", isDir: true},
+		{name: "anchored pattern at the top", patterns: "/templates", path: "templates", isDir: true, want: true},
+		{name: "pattern with a slash is anchored", patterns: "book/notes.md", path: "other/book/notes.md"},
+		{name: "directory only pattern on a file", patterns: "scratch/", path: "scratch"},
+		{name: "directory only pattern on a directory", patterns: "scratch/", path: "book/scratch", isDir: true, want: true},
+		{name: "double star directories", patterns: "book/**/notes.md", path: "book/a/b/notes.md", want: true},
+		{name: "double star at the start", patterns: "**/notes.md", path: "notes.md", want: true},
+		{name: "negation brings a file back", patterns: "*.draft.md\n!epilogue.draft.md", path: "epilogue.draft.md"},
+		{name: "last match wins", patterns: "!one.md\none.md", path: "one.md", want: true},
+		{name: "comments and blank lines", patterns: "# one.md\n\n", path: "one.md"},
+		{name: "escaped hash", patterns: `\#one.md`, path: "#one.md", want: true},
+		{name: "case sensitive", patterns: "Notes.md", path: "notes.md"},
+		{name: "case insensitive", patterns: "Notes.md", ignoreCase: true, path: "notes.md", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &ignoreRules{}
+			for line := range strings.SplitSeq(tt.patterns, "\n") {
+				pattern, ok, err := parseIgnorePattern(line, tt.ignoreCase)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					rules.patterns = append(rules.patterns, pattern)
+				}
+			}
+			if got := rules.ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
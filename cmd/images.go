@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-shiori/go-epub"
+	nethtml "golang.org/x/net/html"
+)
+
+// defaultImageQuality is the JPEG quality of images re-encoded because they
+// were resized or converted to grayscale when --image-quality is not set.
+const defaultImageQuality = 85
+
+func validateImageOptions(options generateOptions) error {
+	if options.maxImageWidth < 0 {
+		return fmt.Errorf("max image width must not be negative")
+	}
+	if options.imageQuality < 0 || options.imageQuality > 100 {
+		return fmt.Errorf("image quality must be between 0 and 100 (0 uses the default of %d)", defaultImageQuality)
+	}
+	if options.maxInlineImageSize < 0 {
+		return fmt.Errorf("max inline image size must not be negative")
+	}
+	return nil
+}
+
+func imageProcessingEnabled(options generateOptions) bool {
+	return options.maxImageWidth > 0 || options.imageQuality > 0 || options.grayscale
+}
+
+// imageEmbedder adds the images referenced by img tags, and the audio and
+// video files of media elements, to the epub. Unlike go-epub's EmbedImages it
+// rewrites every reference to an image, not only the first, and optionally
+// optimizes images before adding them.
+type imageEmbedder struct {
+	epub      *epub.Epub
+	client    *http.Client
+	options   generateOptions
+	paths     map[string]string
+	filenames map[string]bool
+	tracks    map[string]string
+	media     int
+
+	optimized     int
+	originalBytes int
+	resultBytes   int
+}
+
+func newImageEmbedder(e *epub.Epub, client *http.Client, options generateOptions) *imageEmbedder {
+	return &imageEmbedder{
+		epub:      e,
+		client:    client,
+		options:   options,
+		paths:     make(map[string]string),
+		filenames: make(map[string]bool),
+		tracks:    make(map[string]string),
+	}
+}
+
+// embed adds the images referenced in html to the epub and returns html with
+// the img src attributes pointing at the added files. Images that cannot be
+// added are reported and left unchanged, except inline images, which are
+// replaced by their alt text rather than passing the data URI through.
+func (m *imageEmbedder) embed(html string) string {
+	return imgTagPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		parts := htmlImageSrcPattern.FindStringSubmatch(tag)
+		if parts == nil {
+			return tag
+		}
+		src := nethtml.UnescapeString(parts[2])
+		inline := isDataURL(src)
+		if !inline && !isRemoteImage(src) {
+			// Markdown destinations are URL-escaped, e.g. spaces become %20
+			if path, err := url.PathUnescape(src); err == nil {
+				src = path
+			}
+		}
+
+		internalPath, ok := m.paths[src]
+		if !ok {
+			var err error
+			internalPath, err = m.add(src)
+			if err != nil {
+				if inline {
+					var alt string
+					if match := imgAltPattern.FindStringSubmatch(tag); match != nil {
+						alt = match[1]
+					}
+					slog.Warn("can't add inline image to the epub, leaving it out", "alt", nethtml.UnescapeString(alt), "error", err)
+					return alt
+				}
+				slog.Warn("can't add image to the epub", "src", src, "error", err)
+				return tag
+			}
+			m.paths[src] = internalPath
+		}
+		return strings.Replace(tag, parts[0], parts[1]+internalPath+parts[3], 1)
+	})
+}
+
+func (m *imageEmbedder) add(src string) (string, error) {
+	if isDataURL(src) {
+		return m.addInline(src)
+	}
+	rasterize := m.options.rasterizeSVG && isSVG(src)
+	if !imageProcessingEnabled(m.options) && !rasterize {
+		return m.epub.AddImage(src, m.uniqueFilename(src))
+	}
+
+	data, err := m.read(src)
+	if err != nil {
+		return "", err
+	}
+	if rasterize {
+		png, err := rasterizeSVG(data, m.options.svgDPI)
+		if err != nil {
+			return "", err
+		}
+		optimized, _, _ := m.optimize(png)
+		filename := m.uniqueFilename(strings.TrimSuffix(src, path.Ext(src)) + ".png")
+		return m.epub.AddImage(dataURL("image/png", optimized), filename)
+	}
+
+	filename := m.uniqueFilename(src)
+	optimized, format, changed := m.optimize(data)
+	if !changed {
+		return m.epub.AddImage(src, filename)
+	}
+
+	m.optimized++
+	m.originalBytes += len(data)
+	m.resultBytes += len(optimized)
+	return m.epub.AddImage(dataURL("image/"+format, optimized), filename)
+}
+
+// inlineImageExtensions are the file extensions of the media types of inline
+// images.
+var inlineImageExtensions = map[string]string{
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+// addInline stores an image embedded in the markdown as a data URI as a file
+// of the package, which reading systems handle better than attribute values
+// of megabytes. The file is named after a hash of its content.
+func (m *imageEmbedder) addInline(src string) (string, error) {
+	mediaType, data, err := decodeDataURL(src)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := inlineImageExtensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("unsupported inline image type %q", mediaType)
+	}
+	if limit := m.options.maxInlineImageSize; limit > 0 && len(data) > limit*1024 {
+		return "", fmt.Errorf("inline image of %s exceeds --max-inline-image-size", kilobytes(uint64(len(data))))
+	}
+
+	if mediaType == "image/svg+xml" && m.options.rasterizeSVG {
+		if data, err = rasterizeSVG(data, m.options.svgDPI); err != nil {
+			return "", err
+		}
+		mediaType, ext = "image/png", ".png"
+	}
+	if imageProcessingEnabled(m.options) {
+		if optimized, format, changed := m.optimize(data); changed {
+			m.optimized++
+			m.originalBytes += len(data)
+			m.resultBytes += len(optimized)
+			data, mediaType = optimized, "image/"+format
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	filename := m.uniqueFilename(fmt.Sprintf("inline-%x%s", sum[:6], ext))
+	return m.epub.AddImage(dataURL(mediaType, data), filename)
+}
+
+// dataURL encodes data as a base64 data URI, which go-epub accepts as the
+// source of files added to the epub from memory.
+func dataURL(mediaType string, data []byte) string {
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func isDataURL(src string) bool {
+	return len(src) > 5 && strings.EqualFold(src[:5], "data:")
+}
+
+// decodeDataURL returns the media type and content of a data URI, either
+// base64 encoded or percent-encoded.
+func decodeDataURL(src string) (string, []byte, error) {
+	header, payload, found := strings.Cut(src[len("data:"):], ",")
+	if !found {
+		return "", nil, fmt.Errorf("malformed data URI")
+	}
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	isBase64 := false
+	for _, param := range params[1:] {
+		isBase64 = isBase64 || strings.EqualFold(strings.TrimSpace(param), "base64")
+	}
+
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("malformed data URI: %w", err)
+		}
+		return mediaType, []byte(data), nil
+	}
+	// Long data URIs are often wrapped over several lines
+	payload = strings.Join(strings.Fields(payload), "")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed base64 in data URI: %w", err)
+	}
+	return mediaType, data, nil
+}
+
+func (m *imageEmbedder) read(src string) ([]byte, error) {
+	if !isRemoteImage(src) {
+		return os.ReadFile(src)
+	}
+
+	resp, err := m.client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// optimize downscales, converts to grayscale and re-encodes a JPEG or PNG
+// image according to the options. It returns the encoded image, its format and
+// whether it differs from data; other formats are returned unchanged.
+func (m *imageEmbedder) optimize(data []byte) ([]byte, string, bool) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return data, format, false
+	}
+
+	transformed := false
+	if width := img.Bounds().Dx(); m.options.maxImageWidth > 0 && width > m.options.maxImageWidth {
+		height := img.Bounds().Dy() * m.options.maxImageWidth / width
+		img = downscale(img, m.options.maxImageWidth, max(height, 1))
+		transformed = true
+	}
+	if m.options.grayscale {
+		img = toGrayscale(img)
+		transformed = true
+	}
+	if !transformed && (format != "jpeg" || m.options.imageQuality == 0) {
+		return data, format, false
+	}
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		quality := m.options.imageQuality
+		if quality == 0 {
+			quality = defaultImageQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	}
+	if err != nil || (!transformed && buf.Len() >= len(data)) {
+		return data, format, false
+	}
+	return buf.Bytes(), format, true
+}
+
+// downscale resizes img to width by height pixels, each the average of the
+// pixels of img it covers.
+func downscale(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, top+1)
+		for x := range width {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := max(bounds.Min.X+(x+1)*bounds.Dx()/width, left+1)
+			var r, g, b, a, n uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			resized.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return resized
+}
+
+// toGrayscale converts img to shades of gray, keeping its transparency.
+func toGrayscale(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		gray := image.NewGray(bounds)
+		draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+		return gray
+	}
+
+	gray := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			y8 := color.GrayModel.Convert(color.RGBA{R: c.R, G: c.G, B: c.B, A: 0xff}).(color.Gray).Y
+			gray.SetNRGBA(x, y, color.NRGBA{R: y8, G: y8, B: y8, A: c.A})
+		}
+	}
+	return gray
+}
+
+func isRemoteImage(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// uniqueFilename derives a filename inside the epub from an image source,
+// adding a numeric suffix when the name is already taken.
+func (m *imageEmbedder) uniqueFilename(src string) string {
+	name := src
+	if u, err := url.Parse(src); err == nil && u.Scheme != "" {
+		name = u.Path
+	}
+	// Spaces are not valid in the manifest hrefs go-epub writes unescaped
+	name = strings.ReplaceAll(filepath.Base(name), " ", "-")
+	if len(name) > 200 || !fs.ValidPath(name) || name == "." || name == "/" {
+		name = "image" + strings.ToLower(path.Ext(name))
+	}
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; m.filenames[candidate]; i++ {
+		candidate = stem + "-" + strconv.Itoa(i) + ext
+	}
+	m.filenames[candidate] = true
+	return candidate
+}
+
+// report describes the effect of image optimization, if any image was
+// optimized.
+func (m *imageEmbedder) report() string {
+	if m.optimized == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d images, %d KB -> %d KB", m.optimized, m.originalBytes/1024, m.resultBytes/1024)
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-shiori/go-epub"
+)
+
+// testImage returns a width by height image with a red to blue gradient
+// encoded as format, jpeg or png.
+func testImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(255 * x / width), B: uint8(255 * y / height), A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOptimizeImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		options     generateOptions
+		changed     bool
+		wantWidth   int
+		wantHeight  int
+		wantGrayish bool
+	}{
+		{name: "no options", format: "png", wantWidth: 40, wantHeight: 20},
+		{name: "narrow enough", format: "png", options: generateOptions{maxImageWidth: 100}, wantWidth: 40, wantHeight: 20},
+		{name: "downscaled keeping the aspect ratio", format: "png", options: generateOptions{maxImageWidth: 10}, changed: true, wantWidth: 10, wantHeight: 5},
+		{name: "downscaled JPEG", format: "jpeg", options: generateOptions{maxImageWidth: 20}, changed: true, wantWidth: 20, wantHeight: 10},
+		{name: "grayscale", format: "png", options: generateOptions{grayscale: true}, changed: true, wantWidth: 40, wantHeight: 20, wantGrayish: true},
+		{name: "recompressed JPEG", format: "jpeg", options: generateOptions{imageQuality: 10}, changed: true, wantWidth: 40, wantHeight: 20},
+		{name: "quality alone does not touch PNG", format: "png", options: generateOptions{imageQuality: 10}, wantWidth: 40, wantHeight: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testImage(t, tt.format, 40, 20)
+			embedder := &imageEmbedder{options: tt.options}
+			got, format, changed := embedder.optimize(data)
+			if format != tt.format || changed != tt.changed {
+				t.Fatalf("optimize() format = %s, changed = %v, want %s, %v", format, changed, tt.format, tt.changed)
+			}
+			if !changed && !bytes.Equal(got, data) {
+				t.Error("optimize() changed the data of an unchanged image")
+			}
+
+			img, _, err := image.Decode(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.wantWidth || img.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("optimize() size = %v, want %dx%d", img.Bounds().Size(), tt.wantWidth, tt.wantHeight)
+			}
+			r, g, b, _ := img.At(img.Bounds().Max.X-1, 0).RGBA()
+			if gray := r == g && g == b; gray != tt.wantGrayish {
+				t.Errorf("optimize() pixel = %d,%d,%d, want gray %v", r, g, b, tt.wantGrayish)
+			}
+		})
+	}
+}
+
+func TestOptimizeImageOtherFormats(t *testing.T) {
+	data := []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>")
+	embedder := &imageEmbedder{options: generateOptions{grayscale: true}}
+	if got, _, changed := embedder.optimize(data); changed || !bytes.Equal(got, data) {
+		t.Errorf("optimize() of an SVG image = %s, %v, want it unchanged", got, changed)
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			if x%2 == 0 {
+				img.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+			} else {
+				img.Set(x, y, color.RGBA{B: 0xff, A: 0xff})
+			}
+		}
+	}
+
+	got := downscale(img, 2, 1)
+	if got.Bounds().Dx() != 2 || got.Bounds().Dy() != 1 {
+		t.Fatalf("downscale() size = %v, want 2x1", got.Bounds().Size())
+	}
+	for x := range 2 {
+		r, g, b, a := got.At(x, 0).RGBA()
+		if r>>8 != 0x7f || g != 0 || b>>8 != 0x7f || a>>8 != 0xff {
+			t.Errorf("downscale() pixel %d = %d,%d,%d,%d, want the average of red and blue", x, r>>8, g>>8, b>>8, a>>8)
+		}
+	}
+}
+
+func TestEmbedImages(t *testing.T) {
+	dir := t.TempDir()
+	png := string(testImage(t, "png", 4, 4))
+	writeFiles(t, dir, map[string]string{"one/map.png": png, "two/map.png": png})
+	one, two := filepath.Join(dir, "one/map.png"), filepath.Join(dir, "two/map.png")
+	html := `<img src="` + one + `" alt="a" /><img src="` + one + `" alt="b" /><img src="` + two + `" alt="c" />` +
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="d" /><img src="` + filepath.Join(dir, "missing.png") + `" alt="e" />`
+
+	book, err := epub.NewEpub("Book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newImageEmbedder(book, nil, generateOptions{}).embed(html)
+	for _, want := range []string{
+		`<img src="../images/map.png" alt="a" /><img src="../images/map.png" alt="b" /><img src="../images/map-2.png" alt="c" />`,
+		`<img src="../images/inline-4c4b6a3be131.png" alt="d" />`,
+		`src="` + filepath.Join(dir, "missing.png") + `"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("embed() = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestEmbedInlineImages(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString(testImage(t, "png", 4, 4))
+	tests := []struct {
+		name    string
+		html    string
+		options generateOptions
+		want    string
+	}{
+		{
+			name: "stored once per content",
+			html: `<img src="data:image/png;base64,` + png + `" alt="a" /><img src="data:image/png;base64,` + png + `" alt="b" />`,
+			want: `<img src="../images/inline-{sum}.png" alt="a" /><img src="../images/inline-{sum}.png" alt="b" />`,
+		},
+		{
+			name: "wrapped base64",
+			html: `<img src="data:image/png;base64,` + png[:10] + "\n" + png[10:] + `" alt="a" />`,
+			want: `<img src="../images/inline-{sum}.png" alt="a" />`,
+		},
+		{
+			name: "percent-encoded SVG",
+			html: `<img src="data:image/svg+xml,%3Csvg%20xmlns%3D%22http://www.w3.org/2000/svg%22/%3E" alt="a" />`,
+			want: `<img src="../images/inline-900fbe934249.svg" alt="a" />`,
+		},
+		{
+			name: "unsupported types are replaced by their alt text",
+			html: `<p><img src="data:text/html;base64,PGgxPg==" alt="R&amp;D" /></p>`,
+			want: `<p>R&amp;D</p>`,
+		},
+		{
+			name: "no size limit by default",
+			html: `<img src="data:image/png;base64,` + png + `" alt="a" />`,
+			want: `<img src="../images/inline-{sum}.png" alt="a" />`,
+		},
+		{
+			name:    "images over the size limit are replaced by their alt text",
+			html:    `<img src="data:image/svg+xml,` + strings.Repeat("%20", 2048) + `" alt="a" />`,
+			options: generateOptions{maxInlineImageSize: 1},
+			want:    `a`,
+		},
+	}
+
+	sum := sha256.Sum256(testImage(t, "png", 4, 4))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := epub.NewEpub("Book")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := newImageEmbedder(book, nil, tt.options).embed(tt.html)
+			if want := strings.ReplaceAll(tt.want, "{sum}", fmt.Sprintf("%x", sum[:6])); got != want {
+				t.Errorf("embed() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	tests := []struct {
+		src       string
+		mediaType string
+		data      string
+		err       string
+	}{
+		{src: "data:image/PNG;base64,aGk=", mediaType: "image/png", data: "hi"},
+		{src: "data:image/png;charset=utf-8;base64,aGk", mediaType: "image/png", data: "hi"},
+		{src: "data:image/svg+xml,%3Csvg%2F%3E", mediaType: "image/svg+xml", data: "<svg/>"},
+		{src: "data:image/png;base64", err: "malformed data URI"},
+		{src: "data:image/png;base64,!!", err: "malformed base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			mediaType, data, err := decodeDataURL(tt.src)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("decodeDataURL() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mediaType != tt.mediaType || string(data) != tt.data {
+				t.Errorf("decodeDataURL() = %s, %q, want %s, %q", mediaType, data, tt.mediaType, tt.data)
+			}
+		})
+	}
+}
+
+func TestValidateImageOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options generateOptions
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "all options", options: generateOptions{maxImageWidth: 800, imageQuality: 70, grayscale: true}},
+		{name: "negative width", options: generateOptions{maxImageWidth: -1}, wantErr: true},
+		{name: "default quality", options: generateOptions{imageQuality: 0}},
+		{name: "quality above 100", options: generateOptions{imageQuality: 101}, wantErr: true},
+		{name: "negative inline image size", options: generateOptions{maxInlineImageSize: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateImageOptions(tt.options); (err != nil) != tt.wantErr {
+				t.Errorf("validateImageOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
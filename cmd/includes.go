@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alexhokl/helper/iohelper"
+)
+
+var (
+	includeDirectivePattern = regexp.MustCompile(`^\s*<!--\s*include:\s*(.+?)\s*-->\s*$`)
+	codeFencePattern        = regexp.MustCompile("^\\s*(`{3,}|~{3,})")
+	markdownImagePattern    = regexp.MustCompile(`(!\[[^\]]*\]\(\s*)(<[^>\n]*>|[^)\s]+)`)
+	htmlImageSrcPattern     = regexp.MustCompile(`(<img\b[^>]*\bsrc=")([^"]+)(")`)
+)
+
+// codeFence tracks the fenced code blocks of markdown read line by line. A
+// block opened by a run of backticks or tildes is only closed by a run of
+// at least as many of the same character, so that a ``` line inside a ~~~
+// block is code.
+type codeFence struct {
+	marker []byte
+}
+
+// code reports whether line is a fence or part of a fenced code block.
+func (f *codeFence) code(line []byte) bool {
+	match := codeFencePattern.FindSubmatch(line)
+	if f.marker == nil {
+		if match != nil {
+			f.marker = match[1]
+			return true
+		}
+		return false
+	}
+	if match != nil && match[1][0] == f.marker[0] && len(match[1]) >= len(f.marker) &&
+		len(bytes.TrimSpace(line[len(match[0]):])) == 0 {
+		f.marker = nil
+	}
+	return true
+}
+
+// includeResolver expands <!-- include: path --> directives. Paths are
+// relative to the file containing the directive and included files may
+// include further files. In an Obsidian vault, ![[note]] embeds are expanded
+// the same way and the other Obsidian syntax is converted to markdown.
+type includeResolver struct {
+	stack    []string
+	openers  map[string]string
+	includes []includedFile
+	origins  []sourceLine
+	vault    *obsidianVault
+	warnings []string
+
+	// dependencies maps each file to the files it includes directly.
+	dependencies map[string][]string
+}
+
+// manuscript is a markdown file with its include directives expanded.
+type manuscript struct {
+	filename string
+	matter   frontMatter
+	content  []byte
+
+	// includes are the included files in the order they were included.
+	includes []includedFile
+
+	// origins holds the file and line each line of content comes from.
+	origins []sourceLine
+
+	// dependencies maps the manuscript and each included file to the files
+	// it includes directly, in the order they are first included.
+	dependencies map[string][]string
+
+	// warnings are the problems found while expanding, such as wikilinks to
+	// missing notes.
+	warnings []string
+}
+
+type includedFile struct {
+	filename string
+	matter   frontMatter
+
+	// startLine and endLine delimit the lines of the manuscript content
+	// taken from the file and the files it includes.
+	startLine int
+	endLine   int
+}
+
+// chapters returns the included files, which are the chapters of a
+// multi-file book. A book without included files is a single chapter.
+func (m *manuscript) chapters() []includedFile {
+	if len(m.includes) > 0 {
+		return m.includes
+	}
+	return []includedFile{{
+		filename:  m.filename,
+		matter:    m.matter,
+		startLine: 1,
+		endLine:   len(m.origins) + 1,
+	}}
+}
+
+type sourceLine struct {
+	filename string
+	line     int
+}
+
+// origin returns the file and line a line of the manuscript content comes
+// from.
+func (m *manuscript) origin(line int) sourceLine {
+	if line < 1 || line > len(m.origins) {
+		return sourceLine{filename: m.filename}
+	}
+	return m.origins[line-1]
+}
+
+// withLines returns a copy of m with the given content, each line i of which
+// comes from line sources[i] of the content of m, such as the content left
+// after selecting chapters or expanding templates. The origins and included
+// files follow their lines and included files none of whose lines are left
+// are dropped.
+func (m *manuscript) withLines(content []byte, sources []int) *manuscript {
+	changed := *m
+	changed.content = content
+	changed.origins = make([]sourceLine, len(sources))
+	changed.includes = nil
+
+	// positions maps the old line numbers to the first new line coming from
+	// them or, for lines left out, from the lines after them
+	positions := make([]int, len(m.origins)+2)
+	for i, source := range sources {
+		changed.origins[i] = m.origin(source)
+		if source >= 1 && source <= len(m.origins) && positions[source] == 0 {
+			positions[source] = i + 1
+		}
+	}
+	positions[len(m.origins)+1] = len(sources) + 1
+	for line := len(m.origins); line >= 1; line-- {
+		if positions[line] == 0 {
+			positions[line] = positions[line+1]
+		}
+	}
+
+	for _, file := range m.includes {
+		start := positions[min(file.startLine, len(positions)-1)]
+		end := positions[min(file.endLine, len(positions)-1)]
+		if start >= end {
+			continue
+		}
+		file.startLine, file.endLine = start, end
+		changed.includes = append(changed.includes, file)
+	}
+	return &changed
+}
+
+// loadMarkdown reads a markdown file, separates its front matter and expands
+// its include directives. Chapter openers declared in included files are
+// merged into the front matter of the manuscript. Obsidian syntax is
+// supported when the vault directory of options, or else a directory
+// containing the file, is an Obsidian vault. A directory is read with
+// loadDirectory.
+func loadMarkdown(filename string, options sourceOptions) (*manuscript, error) {
+	if iohelper.IsDirectoryExist(filename) {
+		return loadDirectory(filename, options)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read markdown file: %w", err)
+	}
+
+	matter, body, err := splitFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := newIncludeResolver(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	body, err = resolver.expand(body, filename, frontMatterLines(content, body)+1)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.manuscript(filename, matter, body), nil
+}
+
+// newIncludeResolver returns an includeResolver expanding the file or
+// directory filename, with the Obsidian vault of options, or else the vault
+// containing filename, if any.
+func newIncludeResolver(filename string, options sourceOptions) (*includeResolver, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", filename, err)
+	}
+	resolver := &includeResolver{
+		stack:        []string{absFilename},
+		openers:      make(map[string]string),
+		dependencies: make(map[string][]string),
+	}
+	vaultDir := options.vaultDir
+	if vaultDir == "" {
+		vaultDir = findVault(inputDir(filename))
+	}
+	if vaultDir != "" {
+		resolver.vault, err = loadVault(vaultDir, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolver, nil
+}
+
+// manuscript returns the manuscript of filename with the expanded body,
+// merging the chapter openers of the included files into matter.
+func (r *includeResolver) manuscript(filename string, matter frontMatter, body []byte) *manuscript {
+	for id, image := range r.openers {
+		if matter.ChapterOpeners == nil {
+			matter.ChapterOpeners = make(map[string]string)
+		}
+		if _, ok := matter.ChapterOpeners[id]; !ok {
+			matter.ChapterOpeners[id] = image
+		}
+	}
+	return &manuscript{
+		filename:     filename,
+		matter:       matter,
+		content:      body,
+		includes:     r.includes,
+		origins:      r.origins,
+		warnings:     r.warnings,
+		dependencies: r.dependencies,
+	}
+}
+
+// frontMatterLines returns the number of lines taken by the front matter of
+// content, given the body that follows it.
+func frontMatterLines(content, body []byte) int {
+	return bytes.Count(content[:len(content)-len(body)], []byte("\n"))
+}
+
+// expand replaces the include directives and note embeds in content, the
+// body of filename starting at line firstLine, with the content of the
+// included files.
+func (r *includeResolver) expand(content []byte, filename string, firstLine int) ([]byte, error) {
+	var out bytes.Buffer
+	dir := filepath.Dir(filename)
+	var fence codeFence
+	lineNumber := firstLine - 1
+	for line := range bytes.Lines(content) {
+		lineNumber++
+		inFence := fence.code(line)
+		target := ""
+		if match := includeDirectivePattern.FindSubmatch(line); match != nil {
+			target = filepath.Join(dir, string(match[1]))
+		} else if r.vault != nil {
+			target = r.vault.embeddedNote(line)
+		}
+		if inFence || target == "" {
+			origin := sourceLine{filename: filename, line: lineNumber}
+			if !inFence && r.vault != nil {
+				var warnings []string
+				line, warnings = r.vault.rewrite(line, origin)
+				r.warnings = append(r.warnings, warnings...)
+			}
+			out.Write(line)
+			r.origins = append(r.origins, origin)
+			continue
+		}
+
+		if err := r.includeInto(&out, filename, target); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// includeInto writes the expanded content of target, included by filename,
+// to out and records the dependency.
+func (r *includeResolver) includeInto(out *bytes.Buffer, filename, target string) error {
+	if !slices.Contains(r.dependencies[filename], target) {
+		r.dependencies[filename] = append(r.dependencies[filename], target)
+	}
+	included, err := r.include(target)
+	if err != nil {
+		return err
+	}
+	out.Write(included)
+	if !bytes.HasSuffix(included, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	return nil
+}
+
+func (r *includeResolver) include(filename string) ([]byte, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", filename, err)
+	}
+	for i, parent := range r.stack {
+		if parent == absFilename {
+			cycle := append(slices.Clone(r.stack[i:]), absFilename)
+			return nil, fmt.Errorf("include cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(absFilename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read included file %s: %w", filename, err)
+	}
+	matter, body, err := splitFrontMatter(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse included file %s: %w", filename, err)
+	}
+	index := len(r.includes)
+	r.includes = append(r.includes, includedFile{
+		filename:  filename,
+		matter:    matter,
+		startLine: len(r.origins) + 1,
+	})
+
+	dir := filepath.Dir(absFilename)
+	for id, image := range matter.ChapterOpeners {
+		r.openers[id] = rebaseLocalPath(image, dir)
+	}
+
+	r.stack = append(r.stack, absFilename)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	body, err = r.expand(body, filename, frontMatterLines(content, body)+1)
+	if err != nil {
+		return nil, err
+	}
+	r.includes[index].endLine = len(r.origins) + 1
+	return rebaseImagePaths(body, dir), nil
+}
+
+// rebaseImagePaths makes relative image paths in markdown absolute, so that
+// images of an included file resolve regardless of the including file.
+// Images shown in code blocks and code spans are left as written.
+func rebaseImagePaths(content []byte, dir string) []byte {
+	var out []byte
+	var fence codeFence
+	for line := range bytes.Lines(content) {
+		if fence.code(line) {
+			out = append(out, line...)
+			continue
+		}
+		var code [][]byte
+		line = protectCodeSpans(line, func(segment []byte) []byte {
+			code = append(code, segment)
+			return fmt.Appendf(nil, "\x00%d\x00", len(code)-1)
+		})
+		out = append(out, restoreCode(rebaseLineImagePaths(line, dir), code)...)
+	}
+	return out
+}
+
+func rebaseLineImagePaths(line []byte, dir string) []byte {
+	line = markdownImagePattern.ReplaceAllFunc(line, func(match []byte) []byte {
+		parts := markdownImagePattern.FindSubmatch(match)
+		path, bracketed := strings.CutPrefix(string(parts[2]), "<")
+		if bracketed {
+			path = strings.TrimSuffix(path, ">")
+		}
+		path = rebaseLocalPath(path, dir)
+		if bracketed || strings.Contains(path, " ") {
+			path = "<" + path + ">"
+		}
+		return []byte(string(parts[1]) + path)
+	})
+	return htmlImageSrcPattern.ReplaceAllFunc(line, func(match []byte) []byte {
+		parts := htmlImageSrcPattern.FindSubmatch(match)
+		return []byte(string(parts[1]) + rebaseLocalPath(string(parts[2]), dir) + string(parts[3]))
+	})
+}
+
+// rebaseLocalPath joins a relative local path to dir. URLs and absolute paths
+// are returned unchanged.
+func rebaseLocalPath(path, dir string) string {
+	if isRemoteOrAbsolute(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func isRemoteOrAbsolute(path string) bool {
+	return strings.HasPrefix(path, "http://") ||
+		strings.HasPrefix(path, "https://") ||
+		strings.HasPrefix(path, "data:") ||
+		filepath.IsAbs(path)
+}
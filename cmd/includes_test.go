@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadMarkdownIncludes(t *testing.T) {
+	// origin is a file, relative to the test directory, and a line
+	type origin struct {
+		filename string
+		line     int
+	}
+	tests := []struct {
+		name     string
+		files    map[string]string
+		want     string
+		origins  []origin
+		chapters []string
+		openers  map[string]string
+		err      string
+	}{
+		{
+			name: "includes are expanded",
+			files: map[string]string{
+				"book.md":            "# Book\n<!-- include: chapters/one.md -->\nEnd\n",
+				"chapters/one.md":    "# One\n<!-- include: two.md -->\n",
+				"chapters/two.md":    "# Two\nText\n",
+				"chapters/unused.md": "# Unused\n",
+			},
+			want:     "# Book\n# One\n# Two\nText\nEnd\n",
+			origins:  []origin{{"book.md", 1}, {"chapters/one.md", 1}, {"chapters/two.md", 1}, {"chapters/two.md", 2}, {"book.md", 3}},
+			chapters: []string{"chapters/one.md", "chapters/two.md"},
+		},
+		{
+			name: "front matter of included files is merged and skipped by origins",
+			files: map[string]string{
+				"book.md": "---\ntitle: Book\n---\n# Book\n<!-- include: one.md -->\n",
+				"one.md":  "---\nchapter-openers:\n  one: art.png\n---\n# One\n",
+			},
+			want:     "# Book\n# One\n",
+			origins:  []origin{{"book.md", 4}, {"one.md", 5}},
+			chapters: []string{"one.md"},
+			openers:  map[string]string{"one": "art.png"},
+		},
+		{
+			name: "directives in code fences are kept",
+			files: map[string]string{
+				"book.md": "# Book\n```markdown\n<!-- include: one.md -->\n```\n",
+				"one.md":  "# One\n",
+			},
+			want:    "# Book\n```markdown\n<!-- include: one.md -->\n```\n",
+			origins: []origin{{"book.md", 1}, {"book.md", 2}, {"book.md", 3}, {"book.md", 4}},
+		},
+		{
+			name: "fences close only with their own marker",
+			files: map[string]string{
+				"book.md": "~~~\n```\n<!-- include: one.md -->\n~~~\n<!-- include: one.md -->\n",
+				"one.md":  "# One\n",
+			},
+			want:     "~~~\n```\n<!-- include: one.md -->\n~~~\n# One\n",
+			origins:  []origin{{"book.md", 1}, {"book.md", 2}, {"book.md", 3}, {"book.md", 4}, {"one.md", 1}},
+			chapters: []string{"one.md"},
+		},
+		{
+			name: "included files without a final newline",
+			files: map[string]string{
+				"book.md": "<!-- include: one.md -->\n<!-- include: two.md -->\n",
+				"one.md":  "# One",
+				"two.md":  "# Two",
+			},
+			want:     "# One\n# Two\n",
+			origins:  []origin{{"one.md", 1}, {"two.md", 1}},
+			chapters: []string{"one.md", "two.md"},
+		},
+		{
+			name: "include cycles are errors",
+			files: map[string]string{
+				"book.md": "<!-- include: one.md -->\n",
+				"one.md":  "<!-- include: two.md -->\n",
+				"two.md":  "<!-- include: one.md -->\n",
+			},
+			err: "include cycle detected",
+		},
+		{
+			name: "files including themselves are errors",
+			files: map[string]string{
+				"book.md": "<!-- include: book.md -->\n",
+			},
+			err: "include cycle detected",
+		},
+		{
+			name: "missing included files are errors",
+			files: map[string]string{
+				"book.md": "<!-- include: missing.md -->\n",
+			},
+			err: "failed to read included file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("loadMarkdown() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadMarkdown() error = %v", err)
+			}
+
+			if got := string(book.content); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			var origins []origin
+			for line := 1; line <= len(book.origins); line++ {
+				source := book.origin(line)
+				relative, err := filepath.Rel(dir, source.filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				origins = append(origins, origin{filepath.ToSlash(relative), source.line})
+			}
+			if !slices.Equal(origins, tt.origins) {
+				t.Errorf("origins = %v, want %v", origins, tt.origins)
+			}
+			var chapters []string
+			for _, chapter := range book.includes {
+				relative, err := filepath.Rel(dir, chapter.filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				chapters = append(chapters, filepath.ToSlash(relative))
+			}
+			if !slices.Equal(chapters, tt.chapters) {
+				t.Errorf("chapters = %v, want %v", chapters, tt.chapters)
+			}
+			for id, image := range tt.openers {
+				if got, want := book.matter.ChapterOpeners[id], filepath.Join(dir, image); got != want {
+					t.Errorf("chapter opener %s = %s, want %s", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	lines := []string{"text\n", "````go\n", "```\n", "~~~\n", "```` info\n", "`````\n", "text\n", "  ~~~\n", "~~~~\n"}
+	want := []bool{false, true, true, true, true, true, false, true, true}
+	var fence codeFence
+	for i, line := range lines {
+		if got := fence.code([]byte(line)); got != want[i] {
+			t.Errorf("code(%q) = %v, want %v", line, got, want[i])
+		}
+	}
+}
+
+func TestRebaseImagePaths(t *testing.T) {
+	dir := filepath.FromSlash("/book/chapters")
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "relative markdown image",
+			content: "![Map](images/map.png)",
+			want:    "![Map](" + filepath.Join(dir, "images/map.png") + ")",
+		},
+		{
+			name:    "relative HTML image",
+			content: `<img src="map.png" alt="Map">`,
+			want:    `<img src="` + filepath.Join(dir, "map.png") + `" alt="Map">`,
+		},
+		{
+			name:    "remote and absolute images are kept",
+			content: "![A](https://example.org/a.png) ![B](/images/b.png)",
+			want:    "![A](https://example.org/a.png) ![B](/images/b.png)",
+		},
+		{
+			name:    "destinations in angle brackets",
+			content: "![Map](<images/old map.png>)",
+			want:    "![Map](<" + filepath.Join(dir, "images/old map.png") + ">)",
+		},
+		{
+			name:    "images in code are kept",
+			content: "Write `![Map](map.png)`\n~~~\n```\n![Map](map.png)\n~~~\n![Map](map.png)\n",
+			want:    "Write `![Map](map.png)`\n~~~\n```\n![Map](map.png)\n~~~\n![Map](" + filepath.Join(dir, "map.png") + ")\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(rebaseImagePaths([]byte(tt.content), dir)); got != tt.want {
+				t.Errorf("rebaseImagePaths() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
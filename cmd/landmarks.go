@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	packageFilename      = "EPUB/package.opf"
+	navFilename          = "EPUB/nav.xhtml"
+	coverSectionFilename = "cover.xhtml"
+)
+
+// landmarkPatches returns the patches that add an EPUB 3 landmarks nav and an
+// EPUB 2 guide, so that reading systems can locate the cover, the table of
+// contents and the start of the body matter.
+func landmarkPatches(contentFilename string) []epubPatch {
+	coverHref := "xhtml/" + coverSectionFilename
+	contentHref := "xhtml/" + contentFilename
+
+	landmarks := fmt.Sprintf(`    <nav epub:type="landmarks" id="landmarks" hidden="hidden">
+      <h2>Landmarks</h2>
+      <ol>
+        <li><a epub:type="cover" href="%s">Cover</a></li>
+        <li><a epub:type="toc" href="#toc">Table of Contents</a></li>
+        <li><a epub:type="bodymatter" href="%s">Start of Content</a></li>
+      </ol>
+    </nav>
+`, coverHref, contentHref)
+
+	guide := fmt.Sprintf(`  <guide>
+    <reference type="cover" title="Cover" href="%s"></reference>
+    <reference type="toc" title="Table of Contents" href="nav.xhtml"></reference>
+    <reference type="text" title="Start of Content" href="%s"></reference>
+  </guide>
+`, coverHref, contentHref)
+
+	return []epubPatch{
+		{
+			filename: navFilename,
+			apply: func(content []byte) ([]byte, error) {
+				content = bytes.Replace(content, []byte(`<nav epub:type="toc">`), []byte(`<nav epub:type="toc" id="toc">`), 1)
+				return insertBefore(content, "</body>", landmarks)
+			},
+		},
+		{
+			filename: packageFilename,
+			apply: func(content []byte) ([]byte, error) {
+				return insertBefore(content, "</package>", guide)
+			},
+		},
+	}
+}
+
+// wrapSection wraps body in a section element carrying the given epub:type so
+// that reading systems can identify the semantics of the content document.
+func wrapSection(body, epubType string) string {
+	return fmt.Sprintf("<section epub:type=\"%s\">\n%s\n</section>", epubType, body)
+}
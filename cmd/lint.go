@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alexhokl/helper/cli"
+	"github.com/alexhokl/helper/iohelper"
+	"github.com/spf13/cobra"
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	headingIncrementRule  = "heading-increment"
+	emptyHeadingRule      = "empty-heading"
+	chapterHeadingRule    = "chapter-heading"
+	frontMatterSchemaRule = "front-matter-schema"
+)
+
+var emptyATXHeadingPattern = regexp.MustCompile(`^ {0,3}#{1,6}(?:\s+#*)?\s*$`)
+
+// LintDiagnostic is a problem found in the manuscript by a lint rule. Line is
+// 0 for problems of a whole file.
+type LintDiagnostic struct {
+	Filename string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+func (d LintDiagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s (%s)", d.Filename, d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%s:%d: %s (%s)", d.Filename, d.Line, d.Message, d.Rule)
+}
+
+// LintRule is a check run by the lint command. Programs embedding the command
+// line add their own rules, such as house style checks, with
+// RegisterLintRule before calling Execute.
+type LintRule interface {
+	// Name identifies the rule in diagnostics.
+	Name() string
+	// Check returns the problems the rule finds in the document.
+	Check(doc *LintDocument) []LintDiagnostic
+}
+
+// LintDocument is a manuscript parsed for lint rules.
+type LintDocument struct {
+	book *manuscript
+	root gast.Node
+}
+
+// LintChapter is a file of the manuscript with its front matter. StartLine
+// and EndLine delimit its lines in the source of the document.
+type LintChapter struct {
+	Filename    string         `json:"file"`
+	FrontMatter map[string]any `json:"frontMatter"`
+	StartLine   int            `json:"startLine"`
+	EndLine     int            `json:"endLine"`
+}
+
+// Root returns the goldmark AST of the manuscript, with includes expanded.
+func (d *LintDocument) Root() gast.Node {
+	return d.root
+}
+
+// Source returns the manuscript the segments of the AST refer to.
+func (d *LintDocument) Source() []byte {
+	return d.book.content
+}
+
+// Chapters returns the files of the manuscript in reading order.
+func (d *LintDocument) Chapters() []LintChapter {
+	var chapters []LintChapter
+	for _, chapter := range d.book.chapters() {
+		chapters = append(chapters, LintChapter{
+			Filename:    chapter.filename,
+			FrontMatter: chapter.matter.fields,
+			StartLine:   chapter.startLine,
+			EndLine:     chapter.endLine,
+		})
+	}
+	return chapters
+}
+
+// Position returns the file and line a block node of the AST comes from.
+func (d *LintDocument) Position(node gast.Node) (string, int) {
+	origin := d.book.origin(d.line(node))
+	return origin.filename, origin.line
+}
+
+// line returns the line of the manuscript content a block node starts at.
+// Empty ATX headings have no content segment and are located by scanning
+// from the end of the previous block.
+func (d *LintDocument) line(node gast.Node) int {
+	source := d.book.content
+	if node.Lines().Len() > 0 {
+		return bytes.Count(source[:node.Lines().At(0).Start], []byte("\n")) + 1
+	}
+
+	start := 0
+	for previous := node.PreviousSibling(); previous != nil; previous = previous.PreviousSibling() {
+		if previous.Lines().Len() > 0 {
+			start = previous.Lines().At(previous.Lines().Len() - 1).Stop
+			break
+		}
+	}
+	line := bytes.Count(source[:start], []byte("\n")) + 1
+	for content := range bytes.Lines(source[start:]) {
+		if emptyATXHeadingPattern.Match(bytes.TrimRight(content, "\r\n")) {
+			return line
+		}
+		line++
+	}
+	return 0
+}
+
+// Diagnostic returns a problem found by rule at a block node of the AST.
+func (d *LintDocument) Diagnostic(node gast.Node, rule, message string) LintDiagnostic {
+	filename, line := d.Position(node)
+	return LintDiagnostic{
+		Filename: filename,
+		Line:     line,
+		Rule:     rule,
+		Message:  message,
+	}
+}
+
+// Headings returns the headings of the manuscript in order.
+func (d *LintDocument) Headings() []*gast.Heading {
+	var headings []*gast.Heading
+	_ = gast.Walk(d.root, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if heading, ok := node.(*gast.Heading); ok && entering {
+			headings = append(headings, heading)
+		}
+		return gast.WalkContinue, nil
+	})
+	return headings
+}
+
+// lintRuleFunc is a lint rule implemented by a function.
+type lintRuleFunc struct {
+	name  string
+	check func(*LintDocument) []LintDiagnostic
+}
+
+func (r lintRuleFunc) Name() string {
+	return r.name
+}
+
+func (r lintRuleFunc) Check(doc *LintDocument) []LintDiagnostic {
+	return r.check(doc)
+}
+
+// lintRules are the rules run by the lint command in order.
+var lintRules = []LintRule{
+	lintRuleFunc{headingIncrementRule, checkHeadingIncrement},
+	lintRuleFunc{emptyHeadingRule, checkEmptyHeadings},
+	lintRuleFunc{chapterHeadingRule, checkChapterHeadings},
+}
+
+// RegisterLintRule adds a rule run by the lint command after the built-in
+// ones.
+func RegisterLintRule(rule LintRule) {
+	lintRules = append(lintRules, rule)
+}
+
+// checkHeadingIncrement reports headings more than one level deeper than the
+// heading before them, which leave gaps in the navigation structure.
+func checkHeadingIncrement(d *LintDocument) []LintDiagnostic {
+	var diagnostics []LintDiagnostic
+	previousLevel := 0
+	for _, heading := range d.Headings() {
+		if previousLevel > 0 && heading.Level > previousLevel+1 {
+			diagnostics = append(diagnostics, d.Diagnostic(heading, headingIncrementRule,
+				fmt.Sprintf("heading skips from h%d to h%d", previousLevel, heading.Level)))
+		}
+		previousLevel = heading.Level
+	}
+	return diagnostics
+}
+
+// checkEmptyHeadings reports headings without text, which show up as blank
+// entries in the table of contents.
+func checkEmptyHeadings(d *LintDocument) []LintDiagnostic {
+	var diagnostics []LintDiagnostic
+	for _, heading := range d.Headings() {
+		if strings.TrimSpace(string(nodeText(heading, d.book.content))) == "" {
+			diagnostics = append(diagnostics, d.Diagnostic(heading, emptyHeadingRule, fmt.Sprintf("h%d heading is empty", heading.Level)))
+		}
+	}
+	return diagnostics
+}
+
+// checkChapterHeadings reports chapters without any heading, which cannot be
+// reached from the table of contents.
+func checkChapterHeadings(d *LintDocument) []LintDiagnostic {
+	var lines []int
+	for _, heading := range d.Headings() {
+		lines = append(lines, d.line(heading))
+	}
+
+	var diagnostics []LintDiagnostic
+	for _, chapter := range d.book.chapters() {
+		found := false
+		for _, line := range lines {
+			if line >= chapter.startLine && line < chapter.endLine {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diagnostics = append(diagnostics, LintDiagnostic{
+				Filename: chapter.filename,
+				Rule:     chapterHeadingRule,
+				Message:  "chapter has no heading",
+			})
+		}
+	}
+	return diagnostics
+}
+
+// nodeText returns the text of the inline children of node.
+func nodeText(node gast.Node, source []byte) []byte {
+	var buf bytes.Buffer
+	_ = gast.Walk(node, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if entering {
+			switch t := n.(type) {
+			case *gast.Text:
+				buf.Write(t.Segment.Value(source))
+			case *gast.String:
+				buf.Write(t.Value)
+			}
+		}
+		return gast.WalkContinue, nil
+	})
+	return buf.Bytes()
+}
+
+type lintOptions struct {
+	markdownFilename          string
+	extensions                []string
+	vaultDir                  string
+	followSymlinks            bool
+	caseInsensitive           bool
+	frontMatterSchemaFilename string
+	ruleExec                  []string
+}
+
+var lintOps lintOptions
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the specified markdown file for problems in the book structure",
+	RunE:  runLint,
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	flags := lintCmd.Flags()
+	flags.StringVarP(&lintOps.markdownFilename, "input", "i", "", "Path to markdown file, or directory of markdown files")
+	flags.StringSliceVar(&lintOps.extensions, "extensions", defaultMarkdownExtensions, fmt.Sprintf("Markdown extensions to enable (%s)", strings.Join(availableMarkdownExtensions(), ", ")))
+	flags.StringVar(&lintOps.vaultDir, "vault", "", "Obsidian vault of the markdown file (defaults to the closest parent directory with a .obsidian folder)")
+	flags.BoolVar(&lintOps.followSymlinks, "follow-symlinks", false, "Follow symbolic links when reading an input directory or a vault")
+	flags.BoolVar(&lintOps.caseInsensitive, "case-insensitive", false, "Match .epubignore patterns case-insensitively and fail on paths differing only by case")
+	flags.StringVar(&lintOps.frontMatterSchemaFilename, "front-matter-schema", "", "Path to a YAML schema the front matter of chapters must match")
+	flags.StringArrayVar(&lintOps.ruleExec, "rule-exec", nil, "Command implementing a custom lint rule, reading the document as JSON and writing diagnostics as JSON; may be repeated")
+
+	if err := lintCmd.MarkFlagRequired("input"); err != nil {
+		cli.LogUnableToMarkFlagAsRequired("input", err)
+	}
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	if err := validateLintOptions(lintOps); err != nil {
+		return err
+	}
+
+	book, err := loadMarkdown(lintOps.markdownFilename, sourceOptions{
+		followSymlinks:  lintOps.followSymlinks,
+		caseInsensitive: lintOps.caseInsensitive,
+		vaultDir:        lintOps.vaultDir,
+	})
+	if err != nil {
+		return err
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(enabledMarkdownExtensions(lintOps.extensions)...),
+	)
+	doc := &LintDocument{
+		book: book,
+		root: md.Parser().Parse(text.NewReader(book.content)),
+	}
+
+	var diagnostics []LintDiagnostic
+	rules := slices.Clone(lintRules)
+	for _, command := range lintOps.ruleExec {
+		rules = append(rules, execLintRule{command: command})
+	}
+	for _, rule := range rules {
+		diagnostics = append(diagnostics, rule.Check(doc)...)
+	}
+	if lintOps.frontMatterSchemaFilename != "" {
+		schema, err := loadFrontMatterSchema(lintOps.frontMatterSchemaFilename)
+		if err != nil {
+			return err
+		}
+		diagnostics = append(diagnostics, schema.diagnostics(book)...)
+	}
+
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic)
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("found %d problems", len(diagnostics))
+	}
+	fmt.Println("No problems found")
+	return nil
+}
+
+func validateLintOptions(options lintOptions) error {
+	if !iohelper.IsFileExist(options.markdownFilename) && !iohelper.IsDirectoryExist(options.markdownFilename) {
+		return fmt.Errorf("markdown file %s does not exist", options.markdownFilename)
+	}
+	return validateExtensionNames(options.extensions)
+}
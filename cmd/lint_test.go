@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "well structured book",
+			files: map[string]string{"book.md": "# Book\n\n## Part\n\n### Section\n\n## Part\n"},
+		},
+		{
+			name:  "skipped heading levels",
+			files: map[string]string{"book.md": "# Book\n\n### Section\n\n#### Sub\n\n###### Deep\n"},
+			want: []string{
+				"book.md:3: heading skips from h1 to h3 (heading-increment)",
+				"book.md:7: heading skips from h4 to h6 (heading-increment)",
+			},
+		},
+		{
+			name:  "empty headings",
+			files: map[string]string{"book.md": "# Book\n\n##\n\nText\n\n## ##\n"},
+			want: []string{
+				"book.md:3: h2 heading is empty (empty-heading)",
+				"book.md:7: h2 heading is empty (empty-heading)",
+			},
+		},
+		{
+			name: "chapters without headings",
+			files: map[string]string{
+				"book.md": "<!-- include: one.md -->\n<!-- include: two.md -->\n",
+				"one.md":  "# One\n",
+				"two.md":  "Text without a heading\n",
+			},
+			want: []string{"two.md: chapter has no heading (chapter-heading)"},
+		},
+		{
+			name: "problems are reported in the included files",
+			files: map[string]string{
+				"book.md": "# Book\n<!-- include: one.md -->\n",
+				"one.md":  "Intro\n\n#### Deep\n",
+			},
+			want: []string{"one.md:3: heading skips from h1 to h4 (heading-increment)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+			if err != nil {
+				t.Fatalf("loadMarkdown() error = %v", err)
+			}
+			md := goldmark.New(goldmark.WithExtensions(enabledMarkdownExtensions(defaultMarkdownExtensions)...))
+			doc := &LintDocument{book: book, root: md.Parser().Parse(text.NewReader(book.content))}
+
+			var got []string
+			for _, rule := range lintRules {
+				for _, diagnostic := range rule.Check(doc) {
+					got = append(got, strings.TrimPrefix(diagnostic.String(), dir+string(filepath.Separator)))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("diagnostics = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "no problems", content: "# Book\n\n## Chapter\n"},
+		{name: "problems", content: "# Book\n\n### Section\n\n##\n", err: "found 2 problems"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"book.md": tt.content})
+
+			rootCmd.SetArgs([]string{"lint", "--quiet", "-i", filepath.Join(dir, "book.md")})
+			err := Execute()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Execute() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Execute() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
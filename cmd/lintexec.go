@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	gast "github.com/yuin/goldmark/ast"
+)
+
+// lintExecInput is the document written as JSON to the standard input of
+// --rule-exec commands.
+type lintExecInput struct {
+	Filename string        `json:"file"`
+	Chapters []LintChapter `json:"chapters"`
+	Source   string        `json:"source"`
+	AST      lintExecNode  `json:"ast"`
+}
+
+// lintExecNode is a node of the goldmark AST. Block nodes have the file and
+// line they come from; text nodes, code blocks and code spans their text.
+type lintExecNode struct {
+	Kind        string         `json:"kind"`
+	Filename    string         `json:"file,omitempty"`
+	Line        int            `json:"line,omitempty"`
+	Level       int            `json:"level,omitempty"`
+	Text        string         `json:"text,omitempty"`
+	Destination string         `json:"destination,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Children    []lintExecNode `json:"children,omitempty"`
+}
+
+// lintExecOutput is the JSON written by --rule-exec commands to their
+// standard output.
+type lintExecOutput struct {
+	Diagnostics []LintDiagnostic `json:"diagnostics"`
+}
+
+// execLintRule is a lint rule implemented by an external command, which
+// reads the document from its standard input and writes the problems found
+// to its standard output:
+//
+//	{"diagnostics": [{"file": "chapter1.md", "line": 12, "rule": "house-style", "message": "use \"e-mail\""}]}
+//
+// Diagnostics without a file are reported against the manuscript and those
+// without a rule against the command.
+type execLintRule struct {
+	command string
+}
+
+func (r execLintRule) Name() string {
+	name, _, _ := strings.Cut(strings.TrimSpace(r.command), " ")
+	return filepath.Base(name)
+}
+
+func (r execLintRule) Check(doc *LintDocument) []LintDiagnostic {
+	input, err := json.Marshal(lintExecInput{
+		Filename: doc.book.filename,
+		Chapters: doc.Chapters(),
+		Source:   string(doc.Source()),
+		AST:      doc.execNode(doc.Root()),
+	})
+	if err != nil {
+		return []LintDiagnostic{r.failure(doc, fmt.Errorf("failed to encode document: %w", err))}
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := shellCommand(r.command)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return []LintDiagnostic{r.failure(doc, err)}
+	}
+
+	var output lintExecOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return []LintDiagnostic{r.failure(doc, fmt.Errorf("failed to parse output: %w", err))}
+	}
+	for i := range output.Diagnostics {
+		if output.Diagnostics[i].Filename == "" {
+			output.Diagnostics[i].Filename = doc.book.filename
+		}
+		if output.Diagnostics[i].Rule == "" {
+			output.Diagnostics[i].Rule = r.Name()
+		}
+	}
+	return output.Diagnostics
+}
+
+// failure reports a rule command that could not check the document, so that
+// lint does not pass while the rule was not applied.
+func (r execLintRule) failure(doc *LintDocument, err error) LintDiagnostic {
+	return LintDiagnostic{
+		Filename: doc.book.filename,
+		Rule:     r.Name(),
+		Message:  fmt.Sprintf("rule command %s failed: %v", r.command, err),
+	}
+}
+
+func (d *LintDocument) execNode(node gast.Node) lintExecNode {
+	source := d.Source()
+	n := lintExecNode{Kind: node.Kind().String()}
+	if node.Type() == gast.TypeBlock && node.Kind() != gast.KindDocument {
+		n.Filename, n.Line = d.Position(node)
+	}
+
+	switch t := node.(type) {
+	case *gast.Heading:
+		n.Level = t.Level
+	case *gast.Text:
+		n.Text = string(t.Segment.Value(source))
+	case *gast.String:
+		n.Text = string(t.Value)
+	case *gast.CodeSpan:
+		n.Text = string(nodeText(t, source))
+		return n
+	case *gast.Link:
+		n.Destination = string(t.Destination)
+	case *gast.Image:
+		n.Destination = string(t.Destination)
+	case *gast.AutoLink:
+		n.Destination = string(t.URL(source))
+	case *gast.FencedCodeBlock:
+		n.Language = string(t.Language(source))
+		n.Text = string(t.Lines().Value(source))
+	case *gast.CodeBlock, *gast.HTMLBlock:
+		n.Text = string(t.Lines().Value(source))
+	}
+
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		n.Children = append(n.Children, d.execNode(child))
+	}
+	return n
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+func testLintDocument(t *testing.T, files map[string]string) (*LintDocument, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := goldmark.New(goldmark.WithExtensions(enabledMarkdownExtensions(defaultMarkdownExtensions)...))
+	return &LintDocument{book: book, root: md.Parser().Parse(text.NewReader(book.content))}, dir
+}
+
+func TestExecLintRule(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the rule commands are shell scripts")
+	}
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+	}{
+		{
+			name:    "diagnostics default to the manuscript and the command",
+			command: `echo '{"diagnostics": [{"line": 2, "message": "use \"e-mail\""}, {"file": "one.md", "rule": "house-style", "message": "too long"}]}'`,
+			want:    []string{`book.md:2: use "e-mail" (echo)`, `one.md: too long (house-style)`},
+		},
+		{
+			name:    "no problems",
+			command: `echo '{"diagnostics": []}'`,
+		},
+		{
+			name:    "failing commands are problems",
+			command: `echo broken >&2; exit 3`,
+			want:    []string{"book.md: rule command echo broken >&2; exit 3 failed: exit status 3: broken (echo)"},
+		},
+		{
+			name:    "invalid output is a problem",
+			command: `echo none`,
+			want:    []string{"book.md: rule command echo none failed: failed to parse output: invalid character 'o' in literal null (expecting 'u') (echo)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, dir := testLintDocument(t, map[string]string{"book.md": "# Book\n\nSome email.\n"})
+			var got []string
+			for _, diagnostic := range (execLintRule{command: tt.command}).Check(doc) {
+				got = append(got, strings.TrimPrefix(diagnostic.String(), dir+string(filepath.Separator)))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecLintRuleInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the rule command is a shell script")
+	}
+	doc, dir := testLintDocument(t, map[string]string{
+		"book.md": "# Book\n<!-- include: one.md -->\n",
+		"one.md":  "---\nstatus: draft\n---\n## One\n\nSee [notes](notes.md).\n",
+	})
+	inputFilename := filepath.Join(t.TempDir(), "input.json")
+	command := "cat > " + inputFilename + "; echo '{}'"
+	if got := (execLintRule{command: command}).Check(doc); len(got) > 0 {
+		t.Fatalf("Check() = %v, want no problems", got)
+	}
+
+	content, err := os.ReadFile(inputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input lintExecInput
+	if err := json.Unmarshal(content, &input); err != nil {
+		t.Fatal(err)
+	}
+	if len(input.Chapters) != 1 || input.Chapters[0].FrontMatter["status"] != "draft" {
+		t.Errorf("input chapters = %+v, want the front matter of one.md", input.Chapters)
+	}
+
+	var heading, link *lintExecNode
+	var walk func(n *lintExecNode)
+	walk = func(n *lintExecNode) {
+		switch n.Kind {
+		case "Heading":
+			if n.Level == 2 {
+				heading = n
+			}
+		case "Link":
+			link = n
+		}
+		for i := range n.Children {
+			walk(&n.Children[i])
+		}
+	}
+	walk(&input.AST)
+	if heading == nil || heading.Filename != filepath.Join(dir, "one.md") || heading.Line != 4 {
+		t.Errorf("input heading = %+v, want one.md line 4", heading)
+	}
+	if link == nil || link.Destination != "notes.md" || len(link.Children) != 1 || link.Children[0].Text != "notes" {
+		t.Errorf("input link = %+v, want notes.md", link)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var validLogFormats = []string{logFormatText, logFormatJSON}
+
+type loggingOptions struct {
+	verbose bool
+	quiet   bool
+	format  string
+}
+
+var loggingOps loggingOptions
+
+// configureLogging sets the default slog logger according to the logging
+// flags. Progress is logged at info level, stage timings at debug level and
+// problems that do not stop the build at warn level.
+func configureLogging(options loggingOptions) error {
+	if options.verbose && options.quiet {
+		return fmt.Errorf("options --verbose and --quiet cannot be used together")
+	}
+	if !slices.Contains(validLogFormats, options.format) {
+		return fmt.Errorf("invalid log format %s, expected one of %s", options.format, strings.Join(validLogFormats, ", "))
+	}
+
+	level := slog.LevelInfo
+	if options.verbose {
+		level = slog.LevelDebug
+	}
+	if options.quiet {
+		level = slog.LevelWarn
+	}
+
+	var handler slog.Handler
+	if options.format == logFormatJSON {
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	} else {
+		handler = &consoleHandler{w: os.Stderr, level: level, mu: &sync.Mutex{}}
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// consoleHandler is a slog handler writing records as plain lines for people
+// reading the terminal: warnings and errors are prefixed and attributes
+// follow the message as key=value pairs. Times are left out.
+type consoleHandler struct {
+	w      io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+	mu     *sync.Mutex
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	switch {
+	case record.Level >= slog.LevelError:
+		line.WriteString("Error: ")
+	case record.Level >= slog.LevelWarn:
+		line.WriteString("Warning: ")
+	}
+	line.WriteString(record.Message)
+
+	writeAttr := func(attr slog.Attr) bool {
+		if !attr.Equal(slog.Attr{}) {
+			fmt.Fprintf(&line, " %s=%s", attr.Key, attr.Value.Resolve())
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		writeAttr(attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		attr.Key = h.prefix + attr.Key
+		return writeAttr(attr)
+	})
+	line.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.attrs = slices.Clone(h.attrs)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		handler.attrs = append(handler.attrs, attr)
+	}
+	return &handler
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	handler.prefix = h.prefix + name + "."
+	return &handler
+}
+
+// startStage logs the start of a build stage at debug level and returns the
+// function that logs its end with the time taken and the memory allocated and
+// in use, and reports it to the OnStage observers.
+func startStage(name string) func(attrs ...any) {
+	slog.Debug("stage started", "stage", name)
+	meter := newStageMeter(name)
+	return func(attrs ...any) {
+		event := meter.finish()
+		attrs = append([]any{
+			"stage", name,
+			"duration", roundDuration(event.Duration),
+			"allocated", kilobytes(event.AllocatedBytes),
+			"heap", kilobytes(event.HeapBytes),
+		}, attrs...)
+		slog.Debug("stage finished", attrs...)
+	}
+}
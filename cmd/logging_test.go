@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&consoleHandler{w: &buf, level: slog.LevelInfo, mu: &sync.Mutex{}})
+
+	logger.Debug("hidden")
+	logger.Info("Optimized images", "sizes", "1 MB to 200 kB")
+	logger.Warn("can't add image to the epub", "src", "map.png")
+	logger.With("file", "book.md").WithGroup("line").Error("failed", "number", 3)
+
+	want := "Optimized images sizes=1 MB to 200 kB\n" +
+		"Warning: can't add image to the epub src=map.png\n" +
+		"Error: failed file=book.md line.number=3\n"
+	if got := buf.String(); got != want {
+		t.Errorf("consoleHandler wrote %q, want %q", got, want)
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	tests := []struct {
+		name    string
+		options loggingOptions
+		err     string
+	}{
+		{name: "text", options: loggingOptions{format: logFormatText}},
+		{name: "quiet JSON", options: loggingOptions{format: logFormatJSON, quiet: true}},
+		{name: "verbose and quiet", options: loggingOptions{format: logFormatText, verbose: true, quiet: true}, err: "cannot be used together"},
+		{name: "unknown format", options: loggingOptions{format: "xml"}, err: "invalid log format xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := configureLogging(tt.options)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("configureLogging() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("configureLogging() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
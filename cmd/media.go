@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	nethtml "golang.org/x/net/html"
+	textlanguage "golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+var (
+	mediaTagPattern       = regexp.MustCompile(`<(audio|video)\b[^>]*>`)
+	mediaAttributePattern = regexp.MustCompile(`(\s(src|poster)=")([^"]*)(")`)
+)
+
+// mediaElements maps the file extensions of audio and video files to the
+// element they are played with.
+var mediaElements = map[string]string{
+	".aac": "audio", ".flac": "audio", ".m4a": "audio", ".mp3": "audio",
+	".oga": "audio", ".ogg": "audio", ".opus": "audio", ".wav": "audio",
+	".m4v": "video", ".mov": "video", ".mp4": "video", ".ogv": "video",
+	".webm": "video",
+}
+
+// mediaElement returns audio or video for the destination of an audio or
+// video file, and an empty string otherwise.
+func mediaElement(destination string) string {
+	if u, err := url.Parse(destination); err == nil {
+		destination = u.Path
+	}
+	return mediaElements[strings.ToLower(path.Ext(destination))]
+}
+
+// kindMedia is the goldmark node kind of audio and video clips.
+var kindMedia = gast.NewNodeKind("Media")
+
+// mediaNode is an audio or video clip written as a markdown image of an
+// audio or video file, such as ![Pronunciation of Straße](strasse.mp3). Its
+// alt text is the fallback content shown by reading systems that cannot play
+// it.
+type mediaNode struct {
+	gast.BaseInline
+	element     string
+	destination []byte
+	title       []byte
+}
+
+func (n *mediaNode) Kind() gast.NodeKind {
+	return kindMedia
+}
+
+func (n *mediaNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{
+		"Element":     n.element,
+		"Destination": string(n.destination),
+	}, nil)
+}
+
+type mediaTransformer struct{}
+
+// Transform replaces the images of audio and video files with media nodes,
+// keeping the attributes set with attribute lists, such as the poster image
+// of a video in ![Demo](demo.mp4){poster=demo.jpg}.
+func (t *mediaTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	var images []*gast.Image
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if image, ok := node.(*gast.Image); ok && entering && mediaElement(string(image.Destination)) != "" {
+			images = append(images, image)
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, image := range images {
+		media := &mediaNode{
+			element:     mediaElement(string(image.Destination)),
+			destination: image.Destination,
+			title:       image.Title,
+		}
+		for _, attr := range image.Attributes() {
+			media.SetAttribute(attr.Name, attr.Value)
+		}
+		for child := image.FirstChild(); child != nil; child = image.FirstChild() {
+			media.AppendChild(media, child)
+		}
+		image.Parent().ReplaceChild(image.Parent(), image, media)
+	}
+}
+
+type mediaHTMLRenderer struct{}
+
+func (r *mediaHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMedia, r.renderMedia)
+}
+
+func (r *mediaHTMLRenderer) renderMedia(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	n := node.(*mediaNode)
+	if !entering {
+		_, _ = w.WriteString("</" + n.element + ">")
+		return gast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<" + n.element + ` controls="controls" src="`)
+	_, _ = w.Write(util.EscapeHTML(util.URLEscape(n.destination, true)))
+	_ = w.WriteByte('"')
+	if len(n.title) > 0 {
+		_, _ = w.WriteString(` title="`)
+		_, _ = w.Write(util.EscapeHTML(n.title))
+		_ = w.WriteByte('"')
+	}
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, n, nil)
+	}
+	_ = w.WriteByte('>')
+	return gast.WalkContinue, nil
+}
+
+type mediaExtension struct{}
+
+// media is a goldmark extension that renders markdown images of audio and
+// video files as audio and video elements.
+var media = &mediaExtension{}
+
+func (e *mediaExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		// After the attribute lists have been applied to the images
+		util.Prioritized(&mediaTransformer{}, 600),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&mediaHTMLRenderer{}, 500),
+	))
+}
+
+// resolveLocalMediaSrcs rewrites the relative src and poster attributes of
+// audio and video elements to paths relative to markdownDir, like
+// resolveLocalImageSrcs does for images.
+func resolveLocalMediaSrcs(htmlContent, markdownDir string) string {
+	return mediaTagPattern.ReplaceAllStringFunc(htmlContent, func(tag string) string {
+		return mediaAttributePattern.ReplaceAllStringFunc(tag, func(attr string) string {
+			parts := mediaAttributePattern.FindStringSubmatch(attr)
+			src := parts[3]
+			if isRemoteImage(src) || isDataURL(src) || filepath.IsAbs(src) {
+				return attr
+			}
+			return parts[1] + filepath.Join(markdownDir, src) + parts[4]
+		})
+	})
+}
+
+// embedMedia adds the audio and video files, their caption tracks and the
+// poster images referenced in html to the epub and returns html pointing at
+// the added files. Files that cannot be added are reported and left
+// unchanged.
+func (m *imageEmbedder) embedMedia(html string) string {
+	return mediaTagPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		element := mediaTagPattern.FindStringSubmatch(tag)[1]
+		var source string
+		tag = mediaAttributePattern.ReplaceAllStringFunc(tag, func(attr string) string {
+			parts := mediaAttributePattern.FindStringSubmatch(attr)
+			src := nethtml.UnescapeString(parts[3])
+			if !isRemoteImage(src) {
+				if path, err := url.PathUnescape(src); err == nil {
+					src = path
+				}
+			}
+			if parts[2] == "src" {
+				source = src
+			}
+
+			internalPath, ok := m.paths[src]
+			if !ok {
+				var err error
+				kind := element
+				if parts[2] == "poster" {
+					kind = "poster image"
+					internalPath, err = m.add(src)
+				} else {
+					internalPath, err = m.addMedia(element, src)
+				}
+				if err != nil {
+					slog.Warn(fmt.Sprintf("can't add %s to the epub", kind), "src", src, "error", err)
+					return attr
+				}
+				m.paths[src] = internalPath
+			}
+			return parts[1] + internalPath + parts[4]
+		})
+		return tag + m.captionTracks(element, source)
+	})
+}
+
+// captionTracks adds the WebVTT caption files next to the local audio or
+// video file src to the epub and returns the track elements referencing
+// them. The captions of demo.mp4 are demo.vtt, in the language of the book,
+// and demo.<language>.vtt, such as demo.ja.vtt.
+func (m *imageEmbedder) captionTracks(element, src string) string {
+	if src == "" || isRemoteImage(src) || isDataURL(src) {
+		return ""
+	}
+	if tracks, ok := m.tracks[src]; ok {
+		return tracks
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	entries, err := os.ReadDir(filepath.Dir(src))
+	if err != nil {
+		return ""
+	}
+	var tracks strings.Builder
+	hasDefault := false
+	for _, entry := range entries {
+		language, ok := captionLanguage(entry.Name(), stem)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if language == "" {
+			language = m.options.language
+		}
+		filename := filepath.Join(filepath.Dir(src), entry.Name())
+		if err := checkWebVTT(filename); err != nil {
+			slog.Warn("can't add captions to the epub", "src", filename, "error", err)
+			continue
+		}
+		internalPath, err := m.mediaAdder(element)(filename, m.uniqueFilename(filename))
+		if err != nil {
+			slog.Warn("can't add captions to the epub", "src", filename, "error", err)
+			continue
+		}
+
+		fmt.Fprintf(&tracks, `<track kind="captions" src="%s" srclang="%s" label="%s"`,
+			nethtml.EscapeString(internalPath), nethtml.EscapeString(language), nethtml.EscapeString(languageName(language)))
+		if language == m.options.language && !hasDefault {
+			tracks.WriteString(` default="default"`)
+			hasDefault = true
+		}
+		tracks.WriteString("/>")
+	}
+	m.tracks[src] = tracks.String()
+	return tracks.String()
+}
+
+// captionLanguage reports whether name is a caption file of the media file
+// named stem and returns the language in its name, if any.
+func captionLanguage(name, stem string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, stem)
+	if !ok {
+		return "", false
+	}
+	rest, ok = strings.CutSuffix(strings.ToLower(rest), ".vtt")
+	if !ok {
+		return "", false
+	}
+	if rest == "" {
+		return "", true
+	}
+	language, ok := strings.CutPrefix(rest, ".")
+	if !ok || language == "" || strings.Contains(language, ".") {
+		return "", false
+	}
+	if _, err := textlanguage.Parse(language); err != nil {
+		return "", false
+	}
+	return language, true
+}
+
+// checkWebVTT returns an error unless filename starts with the WEBVTT
+// signature of WebVTT files.
+func checkWebVTT(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read caption file: %w", err)
+	}
+	content = bytes.TrimPrefix(content, []byte("\uFEFF"))
+	if !bytes.HasPrefix(content, []byte("WEBVTT")) {
+		return fmt.Errorf("not a WebVTT file")
+	}
+	return nil
+}
+
+// languageName returns the name of a language in that language, such as
+// 日本語 for ja, for the labels of caption tracks.
+func languageName(code string) string {
+	tag, err := textlanguage.Parse(code)
+	if err != nil {
+		return code
+	}
+	if name := display.Self.Name(tag); name != "" {
+		return name
+	}
+	return code
+}
+
+func (m *imageEmbedder) addMedia(element, src string) (string, error) {
+	internalPath, err := m.mediaAdder(element)(src, m.uniqueFilename(src))
+	if err == nil {
+		m.media++
+	}
+	return internalPath, err
+}
+
+// mediaAdder returns the function adding files of an audio or video element,
+// which places them in the audio or video folder of the epub.
+func (m *imageEmbedder) mediaAdder(element string) func(source, filename string) (string, error) {
+	if element == "video" {
+		return m.epub.AddVideo
+	}
+	return m.epub.AddAudio
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-shiori/go-epub"
+)
+
+// writeFiles writes files, mapping paths relative to dir to their content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCaptionLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		language string
+		ok       bool
+	}{
+		{name: "book language", file: "greeting.vtt", ok: true},
+		{name: "language in the name", file: "greeting.ja.vtt", language: "ja", ok: true},
+		{name: "region in the name", file: "greeting.pt-BR.vtt", language: "pt-br", ok: true},
+		{name: "upper case extension", file: "greeting.VTT", ok: true},
+		{name: "other clip", file: "farewell.vtt"},
+		{name: "other extension", file: "greeting.srt"},
+		{name: "clip itself", file: "greeting.mp4"},
+		{name: "nested suffixes", file: "greeting.en.old.vtt"},
+		{name: "invalid language", file: "greeting.notalanguage.vtt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language, ok := captionLanguage(tt.file, "greeting")
+			if language != tt.language || ok != tt.ok {
+				t.Errorf("captionLanguage(%s) = %q, %v, want %q, %v", tt.file, language, ok, tt.language, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEmbedMedia(t *testing.T) {
+	const webVTT = "WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n"
+	png := string(testImage(t, "png", 4, 4))
+	tests := []struct {
+		name     string
+		markdown string
+		files    map[string]string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "video without captions",
+			markdown: `![Greeting](video/greeting.mp4 "Watch")`,
+			files:    map[string]string{"video/greeting.mp4": "video"},
+			want: []string{
+				`<video controls="controls" src="../videos/greeting.mp4" title="Watch">Greeting</video>`,
+			},
+			unwanted: []string{"<track"},
+		},
+		{
+			name:     "captions in the book language and other languages",
+			markdown: `![Greeting](video/greeting.mp4)`,
+			files: map[string]string{
+				"video/greeting.mp4":    "video",
+				"video/greeting.vtt":    webVTT,
+				"video/greeting.ja.vtt": "\uFEFF" + webVTT,
+			},
+			want: []string{
+				`<track kind="captions" src="../videos/greeting.vtt" srclang="en" label="English" default="default"/>`,
+				`<track kind="captions" src="../videos/greeting.ja.vtt" srclang="ja" label="日本語"/>`,
+			},
+		},
+		{
+			name:     "files that are not WebVTT are left out",
+			markdown: `![Greeting](video/greeting.mp4)`,
+			files: map[string]string{
+				"video/greeting.mp4":    "video",
+				"video/greeting.fr.vtt": "1\n00:00:00,000 --> 00:00:01,000\nBonjour\n",
+			},
+			unwanted: []string{"<track"},
+		},
+		{
+			name:     "audio clip",
+			markdown: `Straße ![Pronunciation of Straße](audio/strasse.mp3 "Listen")`,
+			files:    map[string]string{"audio/strasse.mp3": "audio"},
+			want: []string{
+				`<audio controls="controls" src="../audios/strasse.mp3" title="Listen">Pronunciation of Straße</audio>`,
+			},
+		},
+		{
+			name:     "captions of audio clips go with the audio",
+			markdown: `![Interview](audio/interview.m4a)`,
+			files: map[string]string{
+				"audio/interview.m4a": "audio",
+				"audio/interview.vtt": webVTT,
+			},
+			want: []string{`<track kind="captions" src="../audios/interview.vtt" srclang="en" label="English" default="default"/>`},
+		},
+		{
+			name:     "video with a poster image",
+			markdown: `![Greeting](video/greeting.mp4){poster="video/greeting.png"}`,
+			files:    map[string]string{"video/greeting.mp4": "video", "video/greeting.png": png},
+			want:     []string{`src="../videos/greeting.mp4"`, `poster="../images/greeting.png"`},
+		},
+		{
+			name:     "missing clips are left unchanged",
+			markdown: `![Greeting](video/missing.mp4)`,
+			want:     []string{filepath.Join("video", "missing.mp4") + `">Greeting</video>`},
+		},
+		{
+			name:     "clips of the same name in different folders",
+			markdown: "![One](one/clip.mp4)\n\n![Two](two/clip.mp4)",
+			files:    map[string]string{"one/clip.mp4": "one", "two/clip.mp4": "two"},
+			want:     []string{`src="../videos/clip.mp4"`, `src="../videos/clip-2.mp4"`},
+		},
+		{
+			name:     "images are not clips",
+			markdown: `![Photo](photo.png)`,
+			unwanted: []string{"<video"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			htmlContent, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{extensions: defaultMarkdownExtensions})
+			if err != nil {
+				t.Fatal(err)
+			}
+			htmlContent = resolveLocalMediaSrcs(htmlContent, dir)
+
+			book, err := epub.NewEpub("Book")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := newImageEmbedder(book, nil, generateOptions{language: "en"}).embedMedia(htmlContent)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("embedMedia() = %s, want it to contain %s", got, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("embedMedia() = %s, want it not to contain %s", got, unwanted)
+				}
+			}
+		})
+	}
+}
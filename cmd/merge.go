@@ -0,0 +1,691 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alexhokl/helper/cli"
+	"github.com/alexhokl/helper/iohelper"
+	"github.com/spf13/cobra"
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	containerFilename  = "META-INF/container.xml"
+	encryptionFilename = "META-INF/encryption.xml"
+	ncxMediaType       = "application/x-dtbncx+xml"
+)
+
+//go:embed merge.css
+var mergeCSS string
+
+type mergeOptions struct {
+	epubFilename string
+	overwrite    bool
+	title        string
+	author       string
+	language     string
+}
+
+var mergeOps mergeOptions
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge <epub>...",
+	Short: "Combine the specified epub files into an anthology with a part for each book",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runMerge,
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	flags := mergeCmd.Flags()
+	flags.StringVarP(&mergeOps.epubFilename, "output", "o", "", "Path to output epub file")
+	flags.BoolVarP(&mergeOps.overwrite, "overwrite", "f", false, "Overwrite existing epub file")
+	flags.StringVarP(&mergeOps.title, "title", "t", "", "Title of the collection (defaults to the output filename)")
+	flags.StringVarP(&mergeOps.author, "author", "a", "", "Author of the collection (defaults to the authors of the books)")
+	flags.StringVarP(&mergeOps.language, "language", "l", "", "Language code of the collection (defaults to the language of the first book)")
+
+	if err := mergeCmd.MarkFlagRequired("output"); err != nil {
+		cli.LogUnableToMarkFlagAsRequired("output", err)
+	}
+}
+
+// epubContainer is META-INF/container.xml, which locates the package
+// document.
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage is the part of a package document needed to merge the book.
+type opfPackage struct {
+	Metadata struct {
+		Titles    []string `xml:"title"`
+		Creators  []string `xml:"creator"`
+		Languages []string `xml:"language"`
+	} `xml:"metadata"`
+	Items []opfItem `xml:"manifest>item"`
+	Spine struct {
+		Direction string       `xml:"page-progression-direction,attr"`
+		Itemrefs  []opfItemref `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+	Fallback   string `xml:"fallback,attr"`
+}
+
+type opfItemref struct {
+	IDRef      string `xml:"idref,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// ncxNavPoint is an entry of an EPUB 2 NCX table of contents.
+type ncxNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []ncxNavPoint `xml:"navPoint"`
+}
+
+// tocEntry is an entry of the table of contents of a book. Href is the path
+// of the target within the archive, with its fragment.
+type tocEntry struct {
+	title    string
+	href     string
+	children []tocEntry
+}
+
+// mergedBook is an epub read for merging.
+type mergedBook struct {
+	filename  string
+	title     string
+	creators  []string
+	language  string
+	direction string
+	opfDir    string
+	pkg       opfPackage
+	files     []*zip.File
+	toc       []tocEntry
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	if iohelper.IsFileExist(mergeOps.epubFilename) && !mergeOps.overwrite {
+		return fmt.Errorf("epub file %s already exists, use option -f to overwrite", mergeOps.epubFilename)
+	}
+	for _, filename := range args {
+		if filepath.Clean(filename) == filepath.Clean(mergeOps.epubFilename) {
+			return fmt.Errorf("epub file %s cannot be both merged and written", filename)
+		}
+	}
+
+	var books []*mergedBook
+	for _, filename := range args {
+		reader, err := zip.OpenReader(filename)
+		if err != nil {
+			return fmt.Errorf("failed to open epub %s: %w", filename, err)
+		}
+		defer reader.Close()
+
+		book, err := readMergedBook(filename, &reader.Reader)
+		if err != nil {
+			return err
+		}
+		books = append(books, book)
+	}
+
+	data, err := mergeBooks(books, mergeOps)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeOps.epubFilename, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write epub file: %w", err)
+	}
+	slog.Info("Successfully created "+mergeOps.epubFilename, "books", len(books))
+	return nil
+}
+
+// readMergedBook reads the package document and table of contents of an
+// epub.
+func readMergedBook(filename string, reader *zip.Reader) (*mergedBook, error) {
+	book := &mergedBook{filename: filename}
+	entries := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		entries[file.Name] = file
+		if file.Name == encryptionFilename {
+			return nil, fmt.Errorf("cannot merge %s as it has encrypted or obfuscated files", filename)
+		}
+		if file.Name != "mimetype" && !strings.HasPrefix(file.Name, "META-INF/") && !file.FileInfo().IsDir() {
+			book.files = append(book.files, file)
+		}
+	}
+
+	read := func(name string) ([]byte, error) {
+		file, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("epub %s has no %s", filename, name)
+		}
+		return readZipFile(file)
+	}
+
+	content, err := read(containerFilename)
+	if err != nil {
+		return nil, err
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(content, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("epub %s has no package document in %s", filename, containerFilename)
+	}
+	opfFilename := container.Rootfiles[0].FullPath
+	book.opfDir = path.Dir(opfFilename)
+
+	content, err = read(opfFilename)
+	if err != nil {
+		return nil, err
+	}
+	if err := xml.Unmarshal(content, &book.pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse package document of %s: %w", filename, err)
+	}
+	book.files = slices.DeleteFunc(book.files, func(file *zip.File) bool { return file.Name == opfFilename })
+
+	metadata := book.pkg.Metadata
+	book.title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if len(metadata.Titles) > 0 && strings.TrimSpace(metadata.Titles[0]) != "" {
+		book.title = strings.TrimSpace(metadata.Titles[0])
+	}
+	for _, creator := range metadata.Creators {
+		if creator = strings.TrimSpace(creator); creator != "" {
+			book.creators = append(book.creators, creator)
+		}
+	}
+	if len(metadata.Languages) > 0 {
+		book.language = strings.TrimSpace(metadata.Languages[0])
+	}
+	book.direction = book.pkg.Spine.Direction
+
+	// Prefer the EPUB 3 navigation document to the EPUB 2 NCX
+	for _, item := range book.pkg.Items {
+		if !slices.Contains(strings.Fields(item.Properties), "nav") {
+			continue
+		}
+		name := book.itemPath(item)
+		content, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		book.toc, err = navTOC(content, path.Dir(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse navigation document of %s: %w", filename, err)
+		}
+	}
+	if len(book.toc) == 0 {
+		for _, item := range book.pkg.Items {
+			if item.MediaType != ncxMediaType {
+				continue
+			}
+			name := book.itemPath(item)
+			content, err := read(name)
+			if err != nil {
+				return nil, err
+			}
+			var ncx struct {
+				NavPoints []ncxNavPoint `xml:"navMap>navPoint"`
+			}
+			if err := xml.Unmarshal(content, &ncx); err != nil {
+				return nil, fmt.Errorf("failed to parse NCX of %s: %w", filename, err)
+			}
+			book.toc = ncxTOC(ncx.NavPoints, path.Dir(name))
+		}
+	}
+	return book, nil
+}
+
+// replacedItems returns the manifest items of the NCX and of the navigation
+// documents not in the spine.
+func (b *mergedBook) replacedItems() []opfItem {
+	var items []opfItem
+	for _, item := range b.pkg.Items {
+		inSpine := slices.ContainsFunc(b.pkg.Spine.Itemrefs, func(itemref opfItemref) bool { return itemref.IDRef == item.ID })
+		if item.MediaType == ncxMediaType || (slices.Contains(strings.Fields(item.Properties), "nav") && !inSpine) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// itemPath returns the path within the archive of a manifest item.
+func (b *mergedBook) itemPath(item opfItem) string {
+	return resolveHref(b.opfDir, item.Href)
+}
+
+// resolveHref returns the archive path of an href relative to dir, keeping
+// its fragment.
+func resolveHref(dir, href string) string {
+	target, fragment, _ := strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	resolved := path.Join(dir, target)
+	if fragment != "" {
+		resolved += "#" + fragment
+	}
+	return resolved
+}
+
+// navTOC returns the entries of the toc nav of a navigation document.
+func navTOC(content []byte, dir string) ([]tocEntry, error) {
+	doc, err := nethtml.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	var toc *nethtml.Node
+	var find func(*nethtml.Node)
+	find = func(node *nethtml.Node) {
+		if toc != nil {
+			return
+		}
+		if node.Type == nethtml.ElementNode && node.Data == "nav" && slices.Contains(strings.Fields(htmlAttr(node, "epub:type")), "toc") {
+			toc = node
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			find(child)
+		}
+	}
+	find(doc)
+	if toc == nil {
+		return nil, nil
+	}
+	for child := toc.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == nethtml.ElementNode && child.Data == "ol" {
+			return navList(child, dir), nil
+		}
+	}
+	return nil, nil
+}
+
+func navList(ol *nethtml.Node, dir string) []tocEntry {
+	var entries []tocEntry
+	for li := ol.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != nethtml.ElementNode || li.Data != "li" {
+			continue
+		}
+		var entry tocEntry
+		for child := li.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != nethtml.ElementNode {
+				continue
+			}
+			switch child.Data {
+			case "a", "span":
+				entry.title = strings.Join(strings.Fields(htmlText(child)), " ")
+				if href := htmlAttr(child, "href"); href != "" {
+					entry.href = resolveHref(dir, href)
+				}
+			case "ol":
+				entry.children = navList(child, dir)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func ncxTOC(points []ncxNavPoint, dir string) []tocEntry {
+	var entries []tocEntry
+	for _, point := range points {
+		entries = append(entries, tocEntry{
+			title:    strings.Join(strings.Fields(point.Label), " "),
+			href:     resolveHref(dir, point.Content.Src),
+			children: ncxTOC(point.Children, dir),
+		})
+	}
+	return entries
+}
+
+func htmlAttr(node *nethtml.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func htmlText(node *nethtml.Node) string {
+	if node.Type == nethtml.TextNode {
+		return node.Data
+	}
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(htmlText(child))
+	}
+	return text.String()
+}
+
+// mergeBooks returns an epub containing the books in order, each preceded by
+// a part page with its title and authors. The files of each book are kept
+// under EPUB/books/<number>/ with their paths unchanged, so that the links
+// between them still resolve. The table of contents lists the parts with the
+// entries of each book under them.
+func mergeBooks(books []*mergedBook, options mergeOptions) ([]byte, error) {
+	title := options.title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(options.epubFilename), filepath.Ext(options.epubFilename))
+	}
+	language := options.language
+	if language == "" {
+		language = books[0].language
+	}
+	if language == "" {
+		language = "en"
+	}
+	var creators []string
+	if options.author != "" {
+		creators = []string{options.author}
+	} else {
+		for _, book := range books {
+			for _, creator := range book.creators {
+				if !slices.Contains(creators, creator) {
+					creators = append(creators, creator)
+				}
+			}
+		}
+	}
+
+	identifier, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	modified := time.Now().UTC().Truncate(time.Second)
+	write := func(name string, content []byte, method uint16) error {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+		if err != nil {
+			return fmt.Errorf("failed to create archive entry %s: %w", name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := writeMimetype(writer); err != nil {
+		return nil, err
+	}
+	if err := write(containerFilename, []byte(mergedContainer), zip.Deflate); err != nil {
+		return nil, err
+	}
+	if err := write("EPUB/css/merge.css", []byte(mergeCSS), zip.Deflate); err != nil {
+		return nil, err
+	}
+
+	var manifest, spine strings.Builder
+	var toc []tocEntry
+	for i, book := range books {
+		number := i + 1
+		prefix := fmt.Sprintf("books/%03d/", number)
+		idPrefix := fmt.Sprintf("b%03d-", number)
+
+		partFilename := fmt.Sprintf("parts/part%03d.xhtml", number)
+		if err := write("EPUB/"+partFilename, []byte(partPage(book, language)), zip.Deflate); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&manifest, "    <item id=\"part%03d\" href=\"%s\" media-type=\"application/xhtml+xml\" />\n", number, partFilename)
+		fmt.Fprintf(&spine, "    <itemref idref=\"part%03d\" />\n", number)
+
+		// The navigation of the collection replaces the NCX and the
+		// navigation documents of the books outside their spines
+		skipped := book.replacedItems()
+		var skippedFiles []string
+		for _, item := range skipped {
+			skippedFiles = append(skippedFiles, book.itemPath(item))
+		}
+		for _, file := range book.files {
+			if slices.Contains(skippedFiles, file.Name) {
+				continue
+			}
+			content, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if err := write("EPUB/"+prefix+file.Name, content, zip.Deflate); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, item := range book.pkg.Items {
+			if slices.Contains(skipped, item) {
+				continue
+			}
+			fmt.Fprintf(&manifest, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"", html.EscapeString(idPrefix+item.ID), html.EscapeString(hrefOf(prefix+book.itemPath(item))), html.EscapeString(item.MediaType))
+			// The collection has no single cover image and its own
+			// navigation document
+			properties := slices.DeleteFunc(strings.Fields(item.Properties), func(property string) bool {
+				return property == "nav" || property == "cover-image"
+			})
+			if len(properties) > 0 {
+				fmt.Fprintf(&manifest, " properties=\"%s\"", html.EscapeString(strings.Join(properties, " ")))
+			}
+			if item.Fallback != "" {
+				fmt.Fprintf(&manifest, " fallback=\"%s\"", html.EscapeString(idPrefix+item.Fallback))
+			}
+			manifest.WriteString(" />\n")
+		}
+		for _, itemref := range book.pkg.Spine.Itemrefs {
+			fmt.Fprintf(&spine, "    <itemref idref=\"%s\"", html.EscapeString(idPrefix+itemref.IDRef))
+			if itemref.Linear != "" {
+				fmt.Fprintf(&spine, " linear=\"%s\"", html.EscapeString(itemref.Linear))
+			}
+			if itemref.Properties != "" {
+				fmt.Fprintf(&spine, " properties=\"%s\"", html.EscapeString(itemref.Properties))
+			}
+			spine.WriteString(" />\n")
+		}
+
+		toc = append(toc, tocEntry{
+			title:    book.title,
+			href:     partFilename,
+			children: prefixTOC(book.toc, prefix),
+		})
+	}
+
+	if err := write("EPUB/nav.xhtml", []byte(mergedNav(title, language, toc)), zip.Deflate); err != nil {
+		return nil, err
+	}
+	if err := write("EPUB/toc.ncx", []byte(mergedNCX(title, identifier, toc)), zip.Deflate); err != nil {
+		return nil, err
+	}
+
+	var metadata strings.Builder
+	fmt.Fprintf(&metadata, "    <dc:identifier id=\"pub-id\">urn:uuid:%s</dc:identifier>\n", identifier)
+	fmt.Fprintf(&metadata, "    <dc:title>%s</dc:title>\n", html.EscapeString(title))
+	fmt.Fprintf(&metadata, "    <dc:language>%s</dc:language>\n", html.EscapeString(language))
+	for _, creator := range creators {
+		fmt.Fprintf(&metadata, "    <dc:creator>%s</dc:creator>\n", html.EscapeString(creator))
+	}
+	fmt.Fprintf(&metadata, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.Format(time.RFC3339))
+
+	direction := ""
+	if books[0].direction != "" {
+		direction = fmt.Sprintf(" page-progression-direction=\"%s\"", html.EscapeString(books[0].direction))
+	}
+	pkg := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="pub-id" xml:lang="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+%s  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav" />
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml" />
+    <item id="merge-css" href="css/merge.css" media-type="text/css" />
+%s  </manifest>
+  <spine toc="ncx"%s>
+%s  </spine>
+</package>
+`, html.EscapeString(language), metadata.String(), manifest.String(), direction, spine.String())
+	if err := write(packageFilename, []byte(pkg), zip.Deflate); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize epub archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+const mergedContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml" />
+  </rootfiles>
+</container>
+`
+
+// hrefOf returns a path relative to the package document as a URL.
+func hrefOf(name string) string {
+	target, fragment, _ := strings.Cut(name, "#")
+	href := (&url.URL{Path: target}).String()
+	if fragment != "" {
+		href += "#" + fragment
+	}
+	return href
+}
+
+func prefixTOC(entries []tocEntry, prefix string) []tocEntry {
+	var prefixed []tocEntry
+	for _, entry := range entries {
+		if entry.href != "" {
+			entry.href = prefix + entry.href
+		}
+		entry.children = prefixTOC(entry.children, prefix)
+		prefixed = append(prefixed, entry)
+	}
+	return prefixed
+}
+
+func partPage(book *mergedBook, language string) string {
+	authors := ""
+	if len(book.creators) > 0 {
+		authors = fmt.Sprintf("\n      <p class=\"part-author\">%s</p>", html.EscapeString(strings.Join(book.creators, ", ")))
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="%[1]s" xml:lang="%[1]s">
+  <head>
+    <title>%[2]s</title>
+    <link rel="stylesheet" type="text/css" href="../css/merge.css" />
+  </head>
+  <body>
+    <section epub:type="part" class="part">
+      <h1 class="part-title">%[2]s</h1>%[3]s
+    </section>
+  </body>
+</html>
+`, html.EscapeString(language), html.EscapeString(book.title), authors)
+}
+
+func mergedNav(title, language string, toc []tocEntry) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="%[1]s" xml:lang="%[1]s">
+  <head>
+    <title>%[2]s</title>
+  </head>
+  <body>
+    <nav epub:type="toc">
+      <h1>%[2]s</h1>
+%[3]s    </nav>
+  </body>
+</html>
+`, html.EscapeString(language), html.EscapeString(title), navEntries(toc, "      "))
+}
+
+func navEntries(entries []tocEntry, indent string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var list strings.Builder
+	list.WriteString(indent + "<ol>\n")
+	for _, entry := range entries {
+		list.WriteString(indent + "  <li>\n")
+		if entry.href != "" {
+			fmt.Fprintf(&list, "%s    <a href=\"%s\">%s</a>\n", indent, html.EscapeString(hrefOf(entry.href)), html.EscapeString(entry.title))
+		} else {
+			fmt.Fprintf(&list, "%s    <span>%s</span>\n", indent, html.EscapeString(entry.title))
+		}
+		list.WriteString(navEntries(entry.children, indent+"    "))
+		list.WriteString(indent + "  </li>\n")
+	}
+	list.WriteString(indent + "</ol>\n")
+	return list.String()
+}
+
+func mergedNCX(title, identifier string, toc []tocEntry) string {
+	var points strings.Builder
+	order := 0
+	var write func(entries []tocEntry, indent string)
+	write = func(entries []tocEntry, indent string) {
+		for _, entry := range entries {
+			// NCX entries must have a target, so entries of a book
+			// without one are left out
+			if entry.href == "" {
+				write(entry.children, indent)
+				continue
+			}
+			order++
+			fmt.Fprintf(&points, "%s<navPoint id=\"navpoint-%d\" playOrder=\"%d\">\n", indent, order, order)
+			fmt.Fprintf(&points, "%s  <navLabel><text>%s</text></navLabel>\n", indent, html.EscapeString(entry.title))
+			fmt.Fprintf(&points, "%s  <content src=\"%s\" />\n", indent, html.EscapeString(hrefOf(entry.href)))
+			write(entry.children, indent+"  ")
+			fmt.Fprintf(&points, "%s</navPoint>\n", indent)
+		}
+	}
+	write(toc, "    ")
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="urn:uuid:%s" />
+  </head>
+  <docTitle>
+    <text>%s</text>
+  </docTitle>
+  <navMap>
+%s  </navMap>
+</ncx>
+`, identifier, html.EscapeString(title), points.String())
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate identifier: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
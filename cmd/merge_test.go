@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeBooks(t *testing.T) {
+	tests := []struct {
+		name   string
+		titles []string
+	}{
+		{name: "two books", titles: []string{"First", "Second"}},
+		{name: "three books", titles: []string{"First", "Second", "Third"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var books []*mergedBook
+			for _, title := range tt.titles {
+				data := testEpub(t, title, "Text of "+title)
+				reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				book, err := readMergedBook(title+".epub", reader)
+				if err != nil {
+					t.Fatalf("readMergedBook() error = %v", err)
+				}
+				books = append(books, book)
+			}
+
+			data, err := mergeBooks(books, mergeOptions{epubFilename: "collection.epub"})
+			if err != nil {
+				t.Fatalf("mergeBooks() error = %v", err)
+			}
+			reader := checkMimetype(t, data)
+
+			var names []string
+			mimetypes := 0
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+				if file.Name == "mimetype" {
+					mimetypes++
+				}
+			}
+			if mimetypes != 1 {
+				t.Errorf("archive has %d mimetype entries, want 1", mimetypes)
+			}
+			if !slices.Contains(names, containerFilename) {
+				t.Errorf("archive has no %s: %v", containerFilename, names)
+			}
+		})
+	}
+}
+
+func TestMergeBooksContents(t *testing.T) {
+	var books []*mergedBook
+	for _, title := range []string{"First", "Second"} {
+		data := testEpub(t, title, "Text of "+title)
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		book, err := readMergedBook(title+".epub", reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		books = append(books, book)
+	}
+
+	data, err := mergeBooks(books, mergeOptions{epubFilename: "collection.epub", author: "Editor & Co"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := zipContents(t, checkMimetype(t, data))
+
+	pkg := contents[packageFilename]
+	for _, want := range []string{
+		"<dc:title>collection</dc:title>",
+		"<dc:creator>Editor &amp; Co</dc:creator>",
+		`<item id="part001" href="parts/part001.xhtml"`,
+	} {
+		if !strings.Contains(pkg, want) {
+			t.Errorf("package document = %s, want it to contain %s", pkg, want)
+		}
+	}
+	// Each part page comes before the content of its book
+	spine := pkg[strings.Index(pkg, "<spine"):]
+	order := []string{`"part001"`, `"b001-`, `"part002"`, `"b002-`}
+	last := -1
+	for _, idref := range order {
+		i := strings.Index(spine, idref)
+		if i < 0 || i < last {
+			t.Errorf("spine = %s, want the order %v", spine, order)
+			break
+		}
+		last = i
+	}
+
+	if nav := contents["EPUB/nav.xhtml"]; !strings.Contains(nav, `<a href="parts/part002.xhtml">Second</a>`) {
+		t.Errorf("navigation document = %s, want a part entry for Second", nav)
+	}
+	found := 0
+	for name, content := range contents {
+		if strings.HasPrefix(name, "EPUB/books/001/") && strings.Contains(content, "Text of First") {
+			found++
+		}
+		if strings.HasPrefix(name, "EPUB/books/002/") && strings.Contains(content, "Text of Second") {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("archive has the content of %d books, want 2", found)
+	}
+}
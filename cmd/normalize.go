@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	tagPattern         = regexp.MustCompile(`^<(/?)([A-Za-z][A-Za-z0-9-]*)((?:\s+[^<>]*?)?)\s*(/?)>`)
+	idAttributePattern = regexp.MustCompile(`(\sid=")([^"]*)(")`)
+	emptyAnchorPattern = regexp.MustCompile(`<a\b([^>]*)>\s*</a>`)
+
+	// fragmentReferencePattern matches the references to IDs of the same
+	// document in attributes: fragment links and SVG paint servers such as
+	// fill="url(#gradient)".
+	fragmentReferencePattern = regexp.MustCompile(`\s(?:xlink:)?href="#([^"]*)"|url\(#([^)"]*)\)`)
+)
+
+// foreignElements are the roots of SVG and MathML content, whose element
+// names are case-sensitive, such as linearGradient and foreignObject.
+var foreignElements = map[string]bool{"svg": true, "math": true}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true,
+	"code": true, "del": true, "dfn": true, "em": true, "i": true, "ins": true,
+	"kbd": true, "mark": true, "q": true, "s": true, "samp": true, "small": true,
+	"span": true, "strong": true, "sub": true, "sup": true, "time": true,
+	"u": true, "var": true,
+}
+
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"details": true, "div": true, "dl": true, "dd": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"ul": true,
+}
+
+// impliedEndTag lists the open elements an element implicitly closes, as
+// the HTML parser does for a list item following another, and the elements
+// beyond which it does not look for them.
+type impliedEndTag struct {
+	closes map[string]bool
+	scope  map[string]bool
+}
+
+var impliedEndTags = map[string]impliedEndTag{
+	"li": {closes: map[string]bool{"li": true}, scope: map[string]bool{"ul": true, "ol": true}},
+	"dt": {closes: map[string]bool{"dt": true, "dd": true}, scope: map[string]bool{"dl": true}},
+	"dd": {closes: map[string]bool{"dt": true, "dd": true}, scope: map[string]bool{"dl": true}},
+	"tr": {closes: map[string]bool{"tr": true, "td": true, "th": true}, scope: map[string]bool{"table": true, "thead": true, "tbody": true, "tfoot": true}},
+	"td": {closes: map[string]bool{"td": true, "th": true}, scope: map[string]bool{"tr": true, "table": true}},
+	"th": {closes: map[string]bool{"td": true, "th": true}, scope: map[string]bool{"tr": true, "table": true}},
+}
+
+// normalizeReport counts the fixes applied by an htmlNormalizer.
+type normalizeReport struct {
+	voidTags     int
+	selfClosing  int
+	emptyAnchors int
+	nestedBlocks int
+	duplicateIDs int
+}
+
+func (r normalizeReport) changed() bool {
+	return r.voidTags+r.selfClosing+r.emptyAnchors+r.nestedBlocks+r.duplicateIDs > 0
+}
+
+func (r normalizeReport) String() string {
+	var parts []string
+	if r.voidTags > 0 {
+		parts = append(parts, fmt.Sprintf("%d void tags closed", r.voidTags))
+	}
+	if r.selfClosing > 0 {
+		parts = append(parts, fmt.Sprintf("%d self-closing tags expanded", r.selfClosing))
+	}
+	if r.emptyAnchors > 0 {
+		parts = append(parts, fmt.Sprintf("%d empty anchors fixed", r.emptyAnchors))
+	}
+	if r.nestedBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("%d block elements inside inline elements converted", r.nestedBlocks))
+	}
+	if r.duplicateIDs > 0 {
+		parts = append(parts, fmt.Sprintf("%d duplicate IDs renamed", r.duplicateIDs))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// htmlNormalizer rewrites rendered HTML into a form that reading systems
+// parse reliably. A single normalizer should be used for every section of a
+// book so that IDs stay unique across sections.
+type htmlNormalizer struct {
+	ids    map[string]bool
+	report normalizeReport
+
+	// occurrences maps the IDs of the section being normalized to where
+	// they were emitted and what they were renamed to, and references holds
+	// where fragment references were emitted, so that references can follow
+	// renamed IDs.
+	occurrences map[string][]idOccurrence
+	references  []fragmentReference
+}
+
+// idOccurrence is an id attribute at offset of the normalized output.
+type idOccurrence struct {
+	offset  int
+	renamed string
+}
+
+// fragmentReference is a reference to id at offset of the normalized output.
+type fragmentReference struct {
+	offset int
+	id     string
+}
+
+func newHTMLNormalizer() *htmlNormalizer {
+	return &htmlNormalizer{ids: make(map[string]bool)}
+}
+
+// openElement is an element on the normalizer's stack. name is the element
+// as written in the source and emitted is the name it was rewritten to.
+type openElement struct {
+	name    string
+	emitted string
+}
+
+func (n *htmlNormalizer) normalize(htmlContent string) string {
+	var out strings.Builder
+	var stack []openElement
+	n.occurrences = make(map[string][]idOccurrence)
+	n.references = nil
+
+	for i := 0; i < len(htmlContent); {
+		if htmlContent[i] != '<' {
+			next := strings.IndexByte(htmlContent[i:], '<')
+			if next == -1 {
+				next = len(htmlContent) - i
+			}
+			out.WriteString(htmlContent[i : i+next])
+			i += next
+			continue
+		}
+
+		rest := htmlContent[i:]
+		if strings.HasPrefix(rest, "<!--") {
+			end := strings.Index(rest, "-->")
+			if end == -1 {
+				end = len(rest) - len("-->")
+			}
+			out.WriteString(rest[:end+len("-->")])
+			i += end + len("-->")
+			continue
+		}
+
+		parts := tagPattern.FindStringSubmatch(rest)
+		if parts == nil {
+			out.WriteByte('<')
+			i++
+			continue
+		}
+		i += len(parts[0])
+
+		closing := parts[1] == "/"
+		name := strings.ToLower(parts[2])
+		attrs := strings.TrimRight(parts[3], " \t\r\n")
+		selfClosed := parts[4] == "/"
+		foreign := foreignElements[name] || insideForeign(stack)
+
+		if closing {
+			if voidElements[name] {
+				n.report.voidTags++
+				continue
+			}
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].name == name {
+					for k := len(stack) - 1; k >= j; k-- {
+						out.WriteString("</" + stack[k].emitted + ">")
+					}
+					stack = stack[:j]
+					break
+				}
+			}
+			continue
+		}
+
+		if !foreign {
+			stack = closeImplied(&out, stack, name)
+		}
+		attrs = n.uniqueID(attrs, out.Len())
+
+		if foreign {
+			// Element names of SVG and MathML keep their case, and
+			// the block and void elements of HTML do not apply
+			n.recordReferences(out.Len()+len("<"+parts[2]), attrs)
+			if selfClosed {
+				out.WriteString("<" + parts[2] + attrs + "/>")
+				continue
+			}
+			out.WriteString("<" + parts[2] + attrs + ">")
+			stack = append(stack, openElement{name: name, emitted: parts[2]})
+			continue
+		}
+
+		if voidElements[name] {
+			if !selfClosed {
+				n.report.voidTags++
+			}
+			n.recordReferences(out.Len()+len("<"+name), attrs)
+			out.WriteString("<" + name + attrs + " />")
+			continue
+		}
+
+		emitted := name
+		if blockElements[name] && insideInline(stack) {
+			emitted = "span"
+			n.report.nestedBlocks++
+		}
+
+		n.recordReferences(out.Len()+len("<"+emitted), attrs)
+		out.WriteString("<" + emitted + attrs + ">")
+		if selfClosed {
+			n.report.selfClosing++
+			out.WriteString("</" + emitted + ">")
+			continue
+		}
+		stack = append(stack, openElement{name: name, emitted: emitted})
+	}
+
+	for k := len(stack) - 1; k >= 0; k-- {
+		out.WriteString("</" + stack[k].emitted + ">")
+	}
+
+	return n.fixEmptyAnchors(n.rewriteReferences(out.String()))
+}
+
+// uniqueID renames the id attribute in attrs, emitted at offset, if it has
+// already been used in this book, and records it otherwise.
+func (n *htmlNormalizer) uniqueID(attrs string, offset int) string {
+	return idAttributePattern.ReplaceAllStringFunc(attrs, func(match string) string {
+		parts := idAttributePattern.FindStringSubmatch(match)
+		id := parts[2]
+		if !n.ids[id] {
+			n.ids[id] = true
+			n.occurrences[id] = append(n.occurrences[id], idOccurrence{offset: offset, renamed: id})
+			return match
+		}
+		n.report.duplicateIDs++
+		candidate := id
+		for suffix := 1; n.ids[candidate]; suffix++ {
+			candidate = fmt.Sprintf("%s-%d", id, suffix)
+		}
+		n.ids[candidate] = true
+		n.occurrences[id] = append(n.occurrences[id], idOccurrence{offset: offset, renamed: candidate})
+		return parts[1] + candidate + parts[3]
+	})
+}
+
+// recordReferences records the fragment references in attrs, emitted at
+// offset.
+func (n *htmlNormalizer) recordReferences(offset int, attrs string) {
+	for _, loc := range fragmentReferencePattern.FindAllStringSubmatchIndex(attrs, -1) {
+		start, end := loc[2], loc[3]
+		if start == -1 {
+			start, end = loc[4], loc[5]
+		}
+		n.references = append(n.references, fragmentReference{offset: offset + start, id: attrs[start:end]})
+	}
+}
+
+// rewriteReferences points the fragment references of htmlContent to IDs
+// of the section that were renamed at the occurrence of the ID nearest to
+// the reference, which is the one in the same chapter when chapters each
+// define and reference the same ID.
+func (n *htmlNormalizer) rewriteReferences(htmlContent string) string {
+	var out strings.Builder
+	last := 0
+	for _, reference := range n.references {
+		occurrences := n.occurrences[reference.id]
+		if len(occurrences) == 0 {
+			continue
+		}
+		nearest := occurrences[0]
+		for _, occurrence := range occurrences[1:] {
+			if distance(occurrence.offset, reference.offset) < distance(nearest.offset, reference.offset) {
+				nearest = occurrence
+			}
+		}
+		if nearest.renamed == reference.id {
+			continue
+		}
+		out.WriteString(htmlContent[last:reference.offset])
+		out.WriteString(nearest.renamed)
+		last = reference.offset + len(reference.id)
+	}
+	out.WriteString(htmlContent[last:])
+	return out.String()
+}
+
+func distance(a, b int) int {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
+
+// fixEmptyAnchors removes anchors without content. Anchors carrying an id
+// are kept as empty spans so that links targeting them still resolve.
+func (n *htmlNormalizer) fixEmptyAnchors(htmlContent string) string {
+	return emptyAnchorPattern.ReplaceAllStringFunc(htmlContent, func(match string) string {
+		n.report.emptyAnchors++
+		attrs := emptyAnchorPattern.FindStringSubmatch(match)[1]
+		if id := idAttributePattern.FindString(attrs); id != "" {
+			return "<span" + id + "></span>"
+		}
+		return ""
+	})
+}
+
+// closeImplied writes the end tags of the elements of stack that an element
+// name opening next implicitly closes, and returns the remaining stack.
+func closeImplied(out *strings.Builder, stack []openElement, name string) []openElement {
+	closeFrom := func(j int) []openElement {
+		for k := len(stack) - 1; k >= j; k-- {
+			out.WriteString("</" + stack[k].emitted + ">")
+		}
+		return stack[:j]
+	}
+
+	// Block elements end a paragraph, which cannot contain them
+	if blockElements[name] && len(stack) > 0 && stack[len(stack)-1].name == "p" {
+		stack = closeFrom(len(stack) - 1)
+	}
+
+	implied, ok := impliedEndTags[name]
+	if !ok {
+		return stack
+	}
+	closed := -1
+	for j := len(stack) - 1; j >= 0 && !implied.scope[stack[j].name]; j-- {
+		if implied.closes[stack[j].name] {
+			closed = j
+		}
+	}
+	if closed == -1 {
+		return stack
+	}
+	return closeFrom(closed)
+}
+
+func insideForeign(stack []openElement) bool {
+	for _, element := range stack {
+		if foreignElements[element.name] {
+			return true
+		}
+	}
+	return false
+}
+
+func insideInline(stack []openElement) bool {
+	for _, element := range stack {
+		if inlineElements[element.emitted] {
+			return true
+		}
+	}
+	return false
+}
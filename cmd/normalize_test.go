@@ -0,0 +1,116 @@
+package cmd
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		sections []string
+		want     string
+		report   normalizeReport
+	}{
+		{
+			name:     "void tags are closed",
+			sections: []string{`<p>a<br>b<img src="x.png" alt=""></p>`},
+			want:     `<p>a<br />b<img src="x.png" alt="" /></p>`,
+			report:   normalizeReport{voidTags: 2},
+		},
+		{
+			name:     "self-closing tags are expanded",
+			sections: []string{`<p>a</p><div class="x"/>`},
+			want:     `<p>a</p><div class="x"></div>`,
+			report:   normalizeReport{selfClosing: 1},
+		},
+		{
+			name:     "unclosed elements are closed",
+			sections: []string{`<ul><li>a<li>b`},
+			want:     `<ul><li>a</li><li>b</li></ul>`,
+		},
+		{
+			name:     "implied end tags close siblings only",
+			sections: []string{`<ul><li>a<ul><li>b<li>c</ul><li><p>d<ul><li>e</ul></ul><dl><dt>f<dd>g<dt>h</dl>`},
+			want:     `<ul><li>a<ul><li>b</li><li>c</li></ul></li><li><p>d</p><ul><li>e</li></ul></li></ul><dl><dt>f</dt><dd>g</dd><dt>h</dt></dl>`,
+		},
+		{
+			name:     "implied end tags of tables",
+			sections: []string{`<table><tr><td>a<td>b<tr><th>c</table>`},
+			want:     `<table><tr><td>a</td><td>b</td></tr><tr><th>c</th></tr></table>`,
+		},
+		{
+			name:     "block elements inside inline elements become spans",
+			sections: []string{`<a href="x"><div>a</div></a>`},
+			want:     `<a href="x"><span>a</span></a>`,
+			report:   normalizeReport{nestedBlocks: 1},
+		},
+		{
+			name:     "empty anchors are removed or kept as spans",
+			sections: []string{`<p><a href="x"></a><a id="target"> </a>text</p>`},
+			want:     `<p><span id="target"></span>text</p>`,
+			report:   normalizeReport{emptyAnchors: 2},
+		},
+		{
+			name:     "element names are lower cased",
+			sections: []string{`<P>a<BR></P>`},
+			want:     `<p>a<br /></p>`,
+			report:   normalizeReport{voidTags: 1},
+		},
+		{
+			name: "duplicate IDs are renamed and links follow them",
+			sections: []string{
+				`<h2 id="notes">Notes</h2><p><a href="#notes">here</a></p>`,
+				`<h2 id="notes">Notes</h2><p><a href="#notes">here</a></p>`,
+			},
+			want:   `<h2 id="notes-1">Notes</h2><p><a href="#notes-1">here</a></p>`,
+			report: normalizeReport{duplicateIDs: 1},
+		},
+		{
+			name: "links follow the nearest occurrence of an ID",
+			sections: []string{
+				`<p id="a">first</p>`,
+				`<p><a href="#a">one</a></p><p id="a">second</p><p id="a">third</p><p><a href="#a">two</a></p>`,
+			},
+			want:   `<p><a href="#a-1">one</a></p><p id="a-1">second</p><p id="a-2">third</p><p><a href="#a-2">two</a></p>`,
+			report: normalizeReport{duplicateIDs: 2},
+		},
+		{
+			name:     "links to IDs of other sections are kept",
+			sections: []string{`<p id="a">first</p>`, `<p><a href="#a">back</a></p>`},
+			want:     `<p><a href="#a">back</a></p>`,
+		},
+		{
+			name: "SVG keeps its element case and paint server references",
+			sections: []string{
+				`<svg><defs><linearGradient id="g"/></defs><rect fill="url(#g)"/></svg>`,
+				`<svg><defs><linearGradient id="g"/></defs><rect fill="url(#g)"/><use xlink:href="#g"/></svg>`,
+			},
+			want:   `<svg><defs><linearGradient id="g-1"/></defs><rect fill="url(#g-1)"/><use xlink:href="#g-1"/></svg>`,
+			report: normalizeReport{duplicateIDs: 1},
+		},
+		{
+			name:     "MathML keeps its element case",
+			sections: []string{`<math><mi>x</mi><annotation-xml encoding="MathML-Content"><ci>x</ci></annotation-xml></math>`},
+			want:     `<math><mi>x</mi><annotation-xml encoding="MathML-Content"><ci>x</ci></annotation-xml></math>`,
+		},
+		{
+			name:     "comments are kept",
+			sections: []string{`<!-- <br> --><p>a</p>`},
+			want:     `<!-- <br> --><p>a</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizer := newHTMLNormalizer()
+			var got string
+			for _, section := range tt.sections {
+				got = normalizer.normalize(section)
+			}
+			if got != tt.want {
+				t.Errorf("normalize() = %s, want %s", got, tt.want)
+			}
+			if normalizer.report != tt.report {
+				t.Errorf("report = %+v, want %+v", normalizer.report, tt.report)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func validateNumberingOptions(options generateOptions) error {
+	for _, level := range options.numberExclude {
+		if !slices.Contains(headingLevels, level) {
+			return fmt.Errorf("invalid heading level %s, expected one of %s", level, strings.Join(headingLevels, ", "))
+		}
+	}
+	return nil
+}
+
+// numberHeadings prefixes headings with hierarchical numbers such as 1, 1.1
+// and 1.1.1. Excluded levels are neither numbered nor restart the numbering
+// of deeper levels, so chapters can be numbered continuously across parts. A
+// leading h1 repeating the book title is left unnumbered, so that it still
+// matches the title, and levels without a heading above a deeper heading,
+// such as the title's, are left out of its number.
+func numberHeadings(htmlContent, title string, exclude []string) string {
+	var counters [7]int
+	first := true
+	return headingTagPattern.ReplaceAllStringFunc(htmlContent, func(match string) string {
+		parts := headingTagPattern.FindStringSubmatch(match)
+		isTitle := first && parts[1] == "1" && headingText(parts[3]) == title
+		first = false
+		level, err := strconv.Atoi(parts[1])
+		if err != nil || isTitle || slices.Contains(exclude, "h"+parts[1]) {
+			return match
+		}
+
+		counters[level]++
+		for deeper := level + 1; deeper < len(counters); deeper++ {
+			counters[deeper] = 0
+		}
+		var number []string
+		for l := 1; l <= level; l++ {
+			if counters[l] > 0 && !slices.Contains(exclude, "h"+strconv.Itoa(l)) {
+				number = append(number, strconv.Itoa(counters[l]))
+			}
+		}
+
+		return fmt.Sprintf(`<h%s%s><span class="heading-number">%s</span> %s</h%s>`,
+			parts[1], parts[2], strings.Join(number, "."), parts[3], parts[1])
+	})
+}
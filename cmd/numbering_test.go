@@ -0,0 +1,62 @@
+package cmd
+
+import "testing"
+
+func TestNumberHeadings(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		title   string
+		exclude []string
+		want    string
+	}{
+		{
+			name: "hierarchical numbers",
+			html: `<h1 id="a">A</h1><h2 id="b">B</h2><h2>C</h2><h3>D</h3><h1>E</h1><h2>F</h2>`,
+			want: `<h1 id="a"><span class="heading-number">1</span> A</h1>` +
+				`<h2 id="b"><span class="heading-number">1.1</span> B</h2>` +
+				`<h2><span class="heading-number">1.2</span> C</h2>` +
+				`<h3><span class="heading-number">1.2.1</span> D</h3>` +
+				`<h1><span class="heading-number">2</span> E</h1>` +
+				`<h2><span class="heading-number">2.1</span> F</h2>`,
+		},
+		{
+			name:    "excluded levels do not restart deeper numbering",
+			html:    `<h1>Part I</h1><h2>One</h2><h1>Part II</h1><h2>Two</h2>`,
+			exclude: []string{"h1"},
+			want: `<h1>Part I</h1><h2><span class="heading-number">1</span> One</h2>` +
+				`<h1>Part II</h1><h2><span class="heading-number">2</span> Two</h2>`,
+		},
+		{
+			name:  "the title heading is not numbered",
+			html:  `<h1 id="book">Field <em>Guide</em></h1><h2>Notes</h2><h1>Chapter Two</h1><h2>Details</h2>`,
+			title: "Field Guide",
+			want: `<h1 id="book">Field <em>Guide</em></h1><h2><span class="heading-number">1</span> Notes</h2>` +
+				`<h1><span class="heading-number">1</span> Chapter Two</h1>` +
+				`<h2><span class="heading-number">1.1</span> Details</h2>`,
+		},
+		{
+			name:  "only a leading h1 is the title heading",
+			html:  `<h2>Preface</h2><h1>Field Guide</h1>`,
+			title: "Field Guide",
+			want:  `<h2><span class="heading-number">1</span> Preface</h2><h1><span class="heading-number">1</span> Field Guide</h1>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := numberHeadings(tt.html, tt.title, tt.exclude); got != tt.want {
+				t.Errorf("numberHeadings() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNumberingOptions(t *testing.T) {
+	if err := validateNumberingOptions(generateOptions{numberExclude: []string{"h1", "h6"}}); err != nil {
+		t.Errorf("validateNumberingOptions() error = %v", err)
+	}
+	if err := validateNumberingOptions(generateOptions{numberExclude: []string{"h7"}}); err == nil {
+		t.Error("validateNumberingOptions(h7) error = nil, want an error")
+	}
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alexhokl/helper/iohelper"
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	obsidianConfigDir = ".obsidian"
+
+	// wikilinkScheme prefixes the destination of links written as wikilinks
+	// until the note they point to is resolved to a heading of the book.
+	wikilinkScheme = "obsidian:"
+)
+
+var (
+	wikilinkPattern      = regexp.MustCompile(`(!?)\[\[([^\[\]|]+?)(?:\|([^\[\]]*))?\]\]`)
+	noteEmbedLinePattern = regexp.MustCompile(`^\s*!\[\[([^\[\]|#^]+?)(?:\|[^\[\]]*)?\]\]\s*$`)
+	obsidianTagPattern   = regexp.MustCompile(`(^|\s)#[\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*`)
+	embedSizePattern     = regexp.MustCompile(`^\d+(?:x\d+)?$`)
+
+	// codeSpanOrTagPattern matches the parts of a line where Obsidian syntax
+	// is not interpreted.
+	codeSpanOrTagPattern = regexp.MustCompile("`[^`]*`|<[^>]*>")
+)
+
+var vaultImageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// obsidianVault indexes the notes and attachments of an Obsidian vault by the
+// names wikilinks refer to them with. Names are matched case-insensitively.
+type obsidianVault struct {
+	root string
+
+	// notes maps note names, vault relative paths without the .md extension
+	// and front matter aliases to the notes.
+	notes map[string][]string
+
+	// attachments maps file names and vault relative paths to the files that
+	// are not notes.
+	attachments map[string][]string
+}
+
+// findVault returns dir or the closest directory containing it that is an
+// Obsidian vault, or an empty string when dir is not in a vault.
+func findVault(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for dir := absDir; ; dir = filepath.Dir(dir) {
+		if iohelper.IsDirectoryExist(filepath.Join(dir, obsidianConfigDir)) {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// loadVault indexes the files of the vault at root, as found by walkSources.
+func loadVault(root string, options sourceOptions) (*obsidianVault, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault path %s: %w", root, err)
+	}
+	vault := &obsidianVault{
+		root:        absRoot,
+		notes:       make(map[string][]string),
+		attachments: make(map[string][]string),
+	}
+
+	err = walkSources(absRoot, options, func(path, rel string) error {
+		if !isMarkdownFile(path) {
+			vault.add(vault.attachments, path, filepath.Base(path), rel)
+			return nil
+		}
+		names := []string{trimNoteExtension(filepath.Base(path)), trimNoteExtension(rel)}
+		aliases, err := noteAliases(path)
+		if err != nil {
+			return err
+		}
+		vault.add(vault.notes, path, append(names, aliases...)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault %s: %w", root, err)
+	}
+
+	// Obsidian resolves an ambiguous name to the file with the shortest path
+	for _, index := range []map[string][]string{vault.notes, vault.attachments} {
+		for _, paths := range index {
+			slices.SortFunc(paths, func(a, b string) int {
+				return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+			})
+		}
+	}
+	return vault, nil
+}
+
+func (v *obsidianVault) add(index map[string][]string, path string, names ...string) {
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if !slices.Contains(index[key], path) {
+			index[key] = append(index[key], path)
+		}
+	}
+}
+
+// noteAliases returns the aliases declared in the front matter of a note,
+// which Obsidian accepts as a single string or a list.
+func noteAliases(filename string) ([]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note %s: %w", filename, err)
+	}
+	matter, _, err := splitFrontMatter(content)
+	if err != nil {
+		// A note with broken front matter is only an error when it is
+		// part of the book
+		return nil, nil
+	}
+	switch aliases := matter.fields["aliases"].(type) {
+	case string:
+		return []string{aliases}, nil
+	case []any:
+		var names []string
+		for _, alias := range aliases {
+			if name, ok := alias.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+	return nil, nil
+}
+
+func trimNoteExtension(name string) string {
+	if isMarkdownFile(name) {
+		return name[:len(name)-len(markdownExtension)]
+	}
+	return name
+}
+
+// note returns the path of the note a wikilink names, or an empty string.
+func (v *obsidianVault) note(name string) string {
+	return v.lookup(v.notes, trimNoteExtension(name))
+}
+
+// attachment returns the path of the attachment a wikilink names, or an
+// empty string.
+func (v *obsidianVault) attachment(name string) string {
+	return v.lookup(v.attachments, name)
+}
+
+func (v *obsidianVault) lookup(index map[string][]string, name string) string {
+	name = strings.ToLower(strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(name)), "/"))
+	if paths := index[name]; len(paths) > 0 {
+		return paths[0]
+	}
+	if paths := index[strings.ToLower(filepath.Base(name))]; len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// embeddedNote returns the path of the note when line consists of a single
+// ![[note]] embed, which is expanded like an include directive.
+func (v *obsidianVault) embeddedNote(line []byte) string {
+	match := noteEmbedLinePattern.FindSubmatch(line)
+	if match == nil {
+		return ""
+	}
+	return v.note(string(match[1]))
+}
+
+// rewrite converts the Obsidian syntax of a line of origin to markdown.
+// Inline tags are removed as they only organize the vault, image embeds
+// become images and wikilinks become links resolved by a wikilinkResolver.
+// Code spans and HTML tags are left unchanged. Wikilinks to files missing
+// from the vault are replaced by their text and reported in the warnings.
+func (v *obsidianVault) rewrite(line []byte, origin sourceLine) ([]byte, []string) {
+	var warnings []string
+	rewriteText := func(segment string) string {
+		segment = obsidianTagPattern.ReplaceAllString(segment, "$1")
+		return wikilinkPattern.ReplaceAllStringFunc(segment, func(wikilink string) string {
+			parts := wikilinkPattern.FindStringSubmatch(wikilink)
+			embed, target, label := parts[1] == "!", strings.TrimSpace(parts[2]), strings.TrimSpace(parts[3])
+
+			isImage := slices.Contains(vaultImageExtensions, strings.ToLower(filepath.Ext(target)))
+			if embed && (isImage || mediaElement(target) != "") {
+				path := v.attachment(target)
+				if path == "" {
+					kind := "image"
+					if !isImage {
+						kind = mediaElement(target)
+					}
+					warnings = append(warnings, fmt.Sprintf("%s:%d: %s %s not found in vault", origin.filename, origin.line, kind, target))
+					return ""
+				}
+				alt := label
+				if alt == "" || embedSizePattern.MatchString(alt) {
+					alt = strings.TrimSuffix(filepath.Base(target), filepath.Ext(target))
+				}
+				return fmt.Sprintf("![%s](<%s>)", alt, path)
+			}
+
+			name, heading, _ := strings.Cut(target, "#")
+			name, heading = strings.TrimSpace(name), strings.TrimSpace(heading)
+			if strings.HasPrefix(heading, "^") {
+				// Block references have no counterpart in the book
+				heading = ""
+			}
+			text := cmp.Or(label, name)
+			if label == "" && heading != "" {
+				text = strings.TrimPrefix(name+" > "+heading, " > ")
+			}
+
+			path := origin.filename
+			if name != "" {
+				path = v.note(name)
+			}
+			if path == "" {
+				warnings = append(warnings, fmt.Sprintf("%s:%d: wikilink [[%s]] does not match a note in the vault", origin.filename, origin.line, target))
+				return text
+			}
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return text
+			}
+			destination := wikilinkScheme + absPath
+			if heading != "" {
+				destination += "#" + heading
+			}
+			return fmt.Sprintf("[%s](<%s>)", text, destination)
+		})
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range codeSpanOrTagPattern.FindAllIndex(line, -1) {
+		out.WriteString(rewriteText(string(line[last:loc[0]])))
+		out.Write(line[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.WriteString(rewriteText(string(line[last:])))
+	return []byte(out.String()), warnings
+}
+
+// wikilinkResolver is a goldmark extension that points the links converted
+// from wikilinks to the headings of the notes they name. A link to a note
+// goes to its first heading and a link to a heading of a note goes to that
+// heading. Links to notes that are not part of the book are replaced by their
+// text.
+type wikilinkResolver struct {
+	book     *manuscript
+	warnings []string
+}
+
+func newWikilinkResolver(book *manuscript) *wikilinkResolver {
+	return &wikilinkResolver{book: book}
+}
+
+func (r *wikilinkResolver) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(r, 500),
+	))
+}
+
+func (r *wikilinkResolver) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	targets := make(map[string]string)
+	var links []*gast.Link
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *gast.Heading:
+			id, ok := n.AttributeString("id")
+			value, isBytes := id.([]byte)
+			if !ok || !isBytes || n.Lines().Len() == 0 {
+				return gast.WalkContinue, nil
+			}
+			filename := r.sourceFilename(source, n.Lines().At(0).Start)
+			for _, key := range []string{filename + "#", filename + "#" + strings.ToLower(string(nodeText(n, source)))} {
+				if _, exists := targets[key]; !exists {
+					targets[key] = string(value)
+				}
+			}
+		case *gast.Link:
+			if bytes.HasPrefix(n.Destination, []byte(wikilinkScheme)) {
+				links = append(links, n)
+			}
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, link := range links {
+		filename, heading, _ := strings.Cut(strings.TrimPrefix(string(link.Destination), wikilinkScheme), "#")
+		if id, ok := targets[filename+"#"+strings.ToLower(heading)]; ok {
+			link.Destination = []byte("#" + id)
+			continue
+		}
+
+		target := filepath.Base(filename)
+		if heading != "" {
+			target += "#" + heading
+		}
+		r.warnings = append(r.warnings, fmt.Sprintf("wikilink to %s is not part of the book, keeping its text only", target))
+		parent := link.Parent()
+		for child := link.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, link, child)
+			child = next
+		}
+		parent.RemoveChild(parent, link)
+	}
+}
+
+// sourceFilename returns the absolute path of the file the manuscript
+// content at offset comes from.
+func (r *wikilinkResolver) sourceFilename(source []byte, offset int) string {
+	origin := r.book.origin(bytes.Count(source[:offset], []byte("\n")) + 1)
+	filename, err := filepath.Abs(origin.filename)
+	if err != nil {
+		return origin.filename
+	}
+	return filename
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testVault writes an Obsidian vault with a book note embedding two
+// chapters.
+func testVault(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".obsidian/app.json": "{}",
+		"Book.md":            "# Book\n\n![[Chapter One]]\n![[chapters/Chapter Two]]\n",
+		"chapters/Chapter One.md": "---\naliases: [First]\n---\n# Chapter One\n\n" +
+			"Read [[Chapter Two#Harbour]] and [[Second|the next one]] #draft.\n\n" +
+			"![[map.png|Map of the bay]] ![[map.png|300]] `[[not a link]]`\n",
+		"chapters/Chapter Two.md": "---\naliases: Second\n---\n# Chapter Two\n\n## Harbour\n\nBack to [[First]], on to [[Appendix]] and [[Missing]].\n",
+		"Appendix.md":             "# Appendix\n",
+		"attachments/map.png":     string(testImage(t, "png", 4, 4)),
+	})
+	return dir
+}
+
+func TestLoadMarkdownVault(t *testing.T) {
+	dir := testVault(t)
+	book, err := loadMarkdown(filepath.Join(dir, "Book.md"), sourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := string(book.content)
+	image := filepath.Join(dir, "attachments/map.png")
+	for _, want := range []string{
+		"# Chapter One\n",
+		"# Chapter Two\n",
+		"![Map of the bay](<" + image + ">) ![map](<" + image + ">) `[[not a link]]`",
+		"the next one](<" + wikilinkScheme + filepath.Join(dir, "chapters/Chapter Two.md") + ">) .",
+		"[Chapter Two > Harbour](<" + wikilinkScheme + filepath.Join(dir, "chapters/Chapter Two.md") + "#Harbour>)",
+		"on to [Appendix](<" + wikilinkScheme + filepath.Join(dir, "Appendix.md") + ">) and Missing.",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content = %s, want it to contain %s", content, want)
+		}
+	}
+	if strings.Contains(content, "#draft") {
+		t.Errorf("content = %s, want tags removed", content)
+	}
+	if len(book.warnings) != 1 || !strings.Contains(book.warnings[0], "wikilink [[Missing]] does not match a note in the vault") {
+		t.Errorf("warnings = %q, want the missing note", book.warnings)
+	}
+
+	wikilinks := newWikilinkResolver(book)
+	html, err := convertMarkdownToHTML(book.content, newHeadingIDs(headingIDGitHub), wikilinks, generateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<a href="#harbour">Chapter Two &gt; Harbour</a>`,
+		`<a href="#chapter-two">the next one</a>`,
+		`Back to <a href="#chapter-one">First</a>`,
+		`on to Appendix and Missing.`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("convertMarkdownToHTML() = %s, want it to contain %s", html, want)
+		}
+	}
+	if len(wikilinks.warnings) != 1 || !strings.Contains(wikilinks.warnings[0], "wikilink to Appendix.md is not part of the book") {
+		t.Errorf("wikilink warnings = %q, want the appendix", wikilinks.warnings)
+	}
+}
+
+func TestLoadDirectoryVault(t *testing.T) {
+	dir := testVault(t)
+	book, err := loadMarkdown(dir, sourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(book.content)
+	if !strings.HasPrefix(content, "# Appendix\n") {
+		t.Errorf("content = %s, want the notes in the order of their paths", content)
+	}
+	for _, heading := range []string{"# Book\n", "# Chapter One\n", "# Chapter Two\n"} {
+		if count := strings.Count(content, heading); count != 1 {
+			t.Errorf("content has %s %d times, want embedded notes once", heading, count)
+		}
+	}
+}
+
+func TestFindVault(t *testing.T) {
+	dir := testVault(t)
+	if got := findVault(filepath.Join(dir, "chapters")); got != dir {
+		t.Errorf("findVault() = %s, want %s", got, dir)
+	}
+	if got := findVault(t.TempDir()); got != "" {
+		t.Errorf("findVault() outside a vault = %s, want empty", got)
+	}
+}
+
+func TestVaultMediaEmbeds(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".obsidian/app.json": "{}",
+		"Book.md":            "# Book\n\nStraße ![[strasse.mp3|Pronunciation]] ![[greeting.mp4]] ![[farewell.mp4]]\n",
+		"audio/strasse.mp3":  "audio",
+		"video/greeting.mp4": "video",
+	})
+	book, err := loadMarkdown(filepath.Join(dir, "Book.md"), sourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Straße ![Pronunciation](<" + filepath.Join(dir, "audio/strasse.mp3") + ">) ![greeting](<" + filepath.Join(dir, "video/greeting.mp4") + ">) \n"
+	if content := string(book.content); !strings.Contains(content, want) {
+		t.Errorf("content = %q, want it to contain %q", content, want)
+	}
+	if len(book.warnings) != 1 || !strings.Contains(book.warnings[0], "Book.md:3: video farewell.mp4 not found in vault") {
+		t.Errorf("warnings = %q, want the missing video", book.warnings)
+	}
+}
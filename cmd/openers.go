@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+)
+
+// insertChapterOpeners places the opener image configured for a heading ID
+// above that heading. It returns a warning for every opener whose heading
+// does not exist.
+func insertChapterOpeners(htmlContent string, openers map[string]string) (string, []string) {
+	var warnings []string
+
+	ids := make([]string, 0, len(openers))
+	for id := range openers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		re := regexp.MustCompile(`<h[1-6]\b[^>]*\sid="` + regexp.QuoteMeta(id) + `"`)
+		location := re.FindStringIndex(htmlContent)
+		if location == nil {
+			warnings = append(warnings, fmt.Sprintf("chapter opener for #%s has no matching heading", id))
+			continue
+		}
+		opener := fmt.Sprintf("<div class=\"chapter-opener\"><img src=\"%s\" alt=\"\" role=\"presentation\" /></div>\n", html.EscapeString(openers[id]))
+		htmlContent = htmlContent[:location[0]] + opener + htmlContent[location[0]:]
+	}
+
+	return htmlContent, warnings
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// bookOutline is the chapter and heading tree of a book as exported by
+// --export-outline.
+type bookOutline struct {
+	Title    string           `json:"title"`
+	Chapters []outlineChapter `json:"chapters"`
+}
+
+type outlineChapter struct {
+	Title    string            `json:"title"`
+	Href     string            `json:"href"`
+	Headings []*outlineHeading `json:"headings"`
+}
+
+type outlineHeading struct {
+	Level    int               `json:"level"`
+	Title    string            `json:"title"`
+	ID       string            `json:"id"`
+	Href     string            `json:"href"`
+	Children []*outlineHeading `json:"children,omitempty"`
+}
+
+// buildOutline nests the headings of a chapter by level. Hrefs are relative to
+// the root of the epub content directory.
+func buildOutline(title, sectionFilename, htmlContent string) bookOutline {
+	chapterHref := "xhtml/" + sectionFilename
+	chapter := outlineChapter{
+		Title:    title,
+		Href:     chapterHref,
+		Headings: []*outlineHeading{},
+	}
+
+	var parents []*outlineHeading
+	for _, h := range extractHeadings(htmlContent) {
+		node := &outlineHeading{
+			Level: h.level,
+			Title: h.text,
+			ID:    h.id,
+			Href:  chapterHref + "#" + h.id,
+		}
+		for len(parents) > 0 && parents[len(parents)-1].Level >= h.level {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) == 0 {
+			chapter.Headings = append(chapter.Headings, node)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.Children = append(parent.Children, node)
+		}
+		parents = append(parents, node)
+	}
+
+	return bookOutline{
+		Title:    title,
+		Chapters: []outlineChapter{chapter},
+	}
+}
+
+func exportOutline(filename string, outline bookOutline) error {
+	data, err := json.MarshalIndent(outline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode outline: %w", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write outline file: %w", err)
+	}
+	return nil
+}
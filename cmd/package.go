@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// epubPatch rewrites a single file of a packaged epub. go-epub does not expose
+// every part of the package document or navigation document, so features that
+// need them are applied to the packaged archive after go-epub has written it.
+type epubPatch struct {
+	filename string
+	apply    func(content []byte) ([]byte, error)
+}
+
+// patchEpub returns a copy of the epub archive data with patches applied in
+// order. The mimetype entry is rewritten first with writeMimetype, and the
+// order and compression methods of the other entries are preserved. Patches
+// of files not in the archive are applied to empty content and add the files
+// at the end.
+func patchEpub(data []byte, patches []epubPatch) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open epub archive: %w", err)
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	if err := writeMimetype(writer); err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{"mimetype": true}
+	var modified time.Time
+	for _, file := range reader.File {
+		if file.Name == "mimetype" {
+			continue
+		}
+		existing[file.Name] = true
+		modified = file.Modified
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, patch := range patches {
+			if patch.filename != file.Name {
+				continue
+			}
+			content, err = patch.apply(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to patch %s: %w", file.Name, err)
+			}
+		}
+
+		header := file.FileHeader
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive entry %s: %w", file.Name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write archive entry %s: %w", file.Name, err)
+		}
+	}
+
+	var added []string
+	for _, patch := range patches {
+		if !existing[patch.filename] && !slices.Contains(added, patch.filename) {
+			added = append(added, patch.filename)
+		}
+	}
+	for _, filename := range added {
+		var content []byte
+		for _, patch := range patches {
+			if patch.filename != filename {
+				continue
+			}
+			content, err = patch.apply(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create %s: %w", filename, err)
+			}
+		}
+
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: filename, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive entry %s: %w", filename, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write archive entry %s: %w", filename, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize epub archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMimetype writes the mimetype entry of an epub, which must be the first
+// entry of the archive, stored uncompressed and without extra fields such as
+// the extended timestamp archive/zip writes for a modification time.
+func writeMimetype(writer *zip.Writer) error {
+	w, err := writer.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to create archive entry mimetype: %w", err)
+	}
+	if _, err := w.Write([]byte("application/epub+zip")); err != nil {
+		return fmt.Errorf("failed to write archive entry mimetype: %w", err)
+	}
+	return nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive entry %s: %w", file.Name, err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive entry %s: %w", file.Name, err)
+	}
+	return content, nil
+}
+
+// insertBefore inserts addition before the first occurrence of marker. When
+// marker is only preceded by indentation on its line, addition is inserted at
+// the start of that line so that the indentation is kept.
+func insertBefore(content []byte, marker, addition string) ([]byte, error) {
+	index := bytes.Index(content, []byte(marker))
+	if index == -1 {
+		return nil, fmt.Errorf("marker %s not found", marker)
+	}
+	lineStart := bytes.LastIndexByte(content[:index], '\n') + 1
+	if len(bytes.TrimSpace(content[lineStart:index])) == 0 {
+		index = lineStart
+	}
+	result := make([]byte, 0, len(content)+len(addition))
+	result = append(result, content[:index]...)
+	result = append(result, addition...)
+	result = append(result, content[index:]...)
+	return result, nil
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-shiori/go-epub"
+)
+
+// testEpub returns a packaged epub with a section of body.
+func testEpub(t *testing.T, title, body string) []byte {
+	t.Helper()
+	book, err := epub.NewEpub(title)
+	if err != nil {
+		t.Fatalf("failed to create epub: %v", err)
+	}
+	book.SetAuthor("Jane Doe")
+	if _, err := book.AddSection("<h1>"+title+"</h1><p>"+body+"</p>", title, "", ""); err != nil {
+		t.Fatalf("failed to add section: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := book.WriteTo(&buf); err != nil {
+		t.Fatalf("failed to write epub: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// checkMimetype fails t unless the first entry of the epub archive data is
+// the mimetype stored uncompressed and without extra fields, so that its
+// content starts at byte 38 as readers sniffing the file type expect.
+func checkMimetype(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	first := reader.File[0]
+	if first.Name != "mimetype" {
+		t.Fatalf("first entry is %s, want mimetype", first.Name)
+	}
+	if first.Method != zip.Store {
+		t.Errorf("mimetype method is %d, want %d (stored)", first.Method, zip.Store)
+	}
+	if len(first.Extra) != 0 {
+		t.Errorf("mimetype central directory extra field has %d bytes, want none", len(first.Extra))
+	}
+	if got := string(data[30:min(len(data), 58)]); got != "mimetypeapplication/epub+zip" {
+		t.Errorf("archive bytes 30 to 58 are %q, want mimetypeapplication/epub+zip", got)
+	}
+	return reader
+}
+
+// zipContents returns the content of each entry of the archive.
+func zipContents(t *testing.T, reader *zip.Reader) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	for _, file := range reader.File {
+		content, err := readZipFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[file.Name] = string(content)
+	}
+	return contents
+}
+
+func TestPatchEpub(t *testing.T) {
+	tests := []struct {
+		name    string
+		patches []epubPatch
+		want    map[string][]string
+		err     string
+	}{
+		{
+			name: "no patches",
+		},
+		{
+			name: "patch existing file",
+			patches: []epubPatch{
+				{filename: packageFilename, apply: func(content []byte) ([]byte, error) {
+					return insertBefore(content, "</metadata>", "<meta property=\"test\">patched</meta>\n")
+				}},
+			},
+			want: map[string][]string{packageFilename: {`<meta property="test">patched</meta>`}},
+		},
+		{
+			name: "patches of the same file apply in order",
+			patches: []epubPatch{
+				{filename: packageFilename, apply: func(content []byte) ([]byte, error) {
+					return insertBefore(content, "</package>", "<!-- first -->")
+				}},
+				{filename: packageFilename, apply: func(content []byte) ([]byte, error) {
+					return insertBefore(content, "<!-- first -->", "<!-- second -->")
+				}},
+			},
+			want: map[string][]string{packageFilename: {"<!-- second --><!-- first --></package>"}},
+		},
+		{
+			name: "patches of missing files add them",
+			patches: []epubPatch{
+				{filename: "EPUB/extra.txt", apply: func(content []byte) ([]byte, error) {
+					return append(content, "first"...), nil
+				}},
+				{filename: "EPUB/extra.txt", apply: func(content []byte) ([]byte, error) {
+					return append(content, " second"...), nil
+				}},
+			},
+			want: map[string][]string{"EPUB/extra.txt": {"first second"}},
+		},
+		{
+			name:    "landmarks and guide",
+			patches: landmarkPatches("section0001.xhtml"),
+			want: map[string][]string{
+				navFilename: {
+					`<nav epub:type="toc" id="toc">`,
+					`<nav epub:type="landmarks" id="landmarks" hidden="hidden">`,
+					`<a epub:type="bodymatter" href="xhtml/section0001.xhtml">`,
+				},
+				packageFilename: {`<reference type="text" title="Start of Content" href="xhtml/section0001.xhtml"></reference>`},
+			},
+		},
+		{
+			name: "failing patch",
+			patches: []epubPatch{
+				{filename: navFilename, apply: func(content []byte) ([]byte, error) {
+					return insertBefore(content, "<missing>", "")
+				}},
+			},
+			err: "failed to patch " + navFilename,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := patchEpub(testEpub(t, "Book", "Text"), tt.patches)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("patchEpub() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("patchEpub() error = %v", err)
+			}
+			reader := checkMimetype(t, data)
+
+			mimetypes := 0
+			for _, file := range reader.File {
+				if file.Name == "mimetype" {
+					mimetypes++
+				}
+			}
+			if mimetypes != 1 {
+				t.Errorf("archive has %d mimetype entries, want 1", mimetypes)
+			}
+			contents := zipContents(t, reader)
+			for filename, wants := range tt.want {
+				for _, want := range wants {
+					if !strings.Contains(contents[filename], want) {
+						t.Errorf("%s = %q, want it to contain %q", filename, contents[filename], want)
+					}
+				}
+			}
+		})
+	}
+}
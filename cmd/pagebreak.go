@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var pageBreakPattern = regexp.MustCompile(`^(?:<!--\s*pagebreak\s*-->|\\newpage)$`)
+
+func validatePageBreakOptions(options generateOptions) error {
+	for _, level := range options.pageBreakBefore {
+		if !slices.Contains(headingLevels, level) {
+			return fmt.Errorf("invalid page break level %s, expected one of %s", level, strings.Join(headingLevels, ", "))
+		}
+	}
+	return nil
+}
+
+// pageBreakCSS returns the rules that start a new page before the heading
+// levels of --page-break-before. Chapter openers already start a new page,
+// so a heading following one does not break again.
+func pageBreakCSS(options generateOptions) string {
+	if len(options.pageBreakBefore) == 0 {
+		return ""
+	}
+
+	var openers []string
+	for _, level := range options.pageBreakBefore {
+		openers = append(openers, ".chapter-opener + "+level)
+	}
+	return fmt.Sprintf(`
+%s {
+    page-break-before: always;
+    break-before: page;
+}
+
+%s {
+    page-break-before: auto;
+    break-before: auto;
+}
+`, strings.Join(options.pageBreakBefore, ", "), strings.Join(openers, ", "))
+}
+
+// kindPageBreak is the goldmark node kind of explicit page breaks.
+var kindPageBreak = gast.NewNodeKind("PageBreak")
+
+// pageBreakNode is an explicit page break, written as a paragraph or HTML
+// block consisting of \newpage or <!-- pagebreak -->.
+type pageBreakNode struct {
+	gast.BaseBlock
+}
+
+func (n *pageBreakNode) Kind() gast.NodeKind {
+	return kindPageBreak
+}
+
+func (n *pageBreakNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+type pageBreakTransformer struct{}
+
+// Transform replaces page break markers with page break nodes before raw HTML
+// is rendered, so that the comment marker works with every --html policy.
+func (t *pageBreakTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var markers []gast.Node
+	_ = gast.Walk(doc, func(node gast.Node, entering bool) (gast.WalkStatus, error) {
+		if !entering {
+			return gast.WalkContinue, nil
+		}
+		switch node.Kind() {
+		case gast.KindParagraph, gast.KindHTMLBlock:
+			if pageBreakPattern.MatchString(strings.TrimSpace(string(node.Lines().Value(source)))) {
+				markers = append(markers, node)
+			}
+			return gast.WalkSkipChildren, nil
+		}
+		return gast.WalkContinue, nil
+	})
+
+	for _, marker := range markers {
+		marker.Parent().ReplaceChild(marker.Parent(), marker, &pageBreakNode{})
+	}
+}
+
+type pageBreakHTMLRenderer struct{}
+
+func (r *pageBreakHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindPageBreak, r.renderPageBreak)
+}
+
+func (r *pageBreakHTMLRenderer) renderPageBreak(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<div class=\"page-break\"></div>\n")
+	}
+	return gast.WalkSkipChildren, nil
+}
+
+type pageBreakExtension struct{}
+
+// pageBreak is a goldmark extension that renders page break markers.
+var pageBreak = &pageBreakExtension{}
+
+func (e *pageBreakExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&pageBreakTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&pageBreakHTMLRenderer{}, 500),
+	))
+}
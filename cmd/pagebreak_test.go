@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPageBreakMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "comment marker",
+			markdown: "One\n\n<!-- pagebreak -->\n\nTwo",
+			want:     "<p>One</p>\n<div class=\"page-break\"></div>\n<p>Two</p>",
+		},
+		{
+			name:     "LaTeX marker",
+			markdown: "One\n\n\\newpage\n\nTwo",
+			want:     "<p>One</p>\n<div class=\"page-break\"></div>\n<p>Two</p>",
+		},
+		{
+			name:     "markers inside paragraphs are text",
+			markdown: "One \\newpage two",
+			want:     "<p>One \\newpage two</p>",
+		},
+		{
+			name:     "markers in code are kept",
+			markdown: "    \\newpage",
+			want:     "<pre><code>\\newpage\n</code></pre>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(tt.markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{extensions: []string{"pagebreak"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageBreakCSS(t *testing.T) {
+	if got := pageBreakCSS(generateOptions{}); got != "" {
+		t.Errorf("pageBreakCSS() without levels = %q, want empty", got)
+	}
+
+	got := pageBreakCSS(generateOptions{pageBreakBefore: []string{"h1", "h2"}})
+	for _, want := range []string{
+		"h1, h2 {\n    page-break-before: always;",
+		".chapter-opener + h1, .chapter-opener + h2 {\n    page-break-before: auto;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("pageBreakCSS() = %s, want it to contain %s", got, want)
+		}
+	}
+
+	if err := validatePageBreakOptions(generateOptions{pageBreakBefore: []string{"h7"}}); err == nil {
+		t.Error("validatePageBreakOptions(h7) error = nil, want an error")
+	}
+}
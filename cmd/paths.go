@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const applicationName = "markdown-to-epub"
+
+// configDir returns the directory of the config file, following the
+// conventions of the operating system: $XDG_CONFIG_HOME/markdown-to-epub
+// (~/.config by default) on Linux, ~/Library/Application Support on macOS
+// and %AppData% on Windows.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(dir, applicationName), nil
+}
+
+// cacheDir returns the directory of cached downloads such as remote configs
+// and themes: $XDG_CACHE_HOME/markdown-to-epub (~/.cache by default) on
+// Linux, ~/Library/Caches on macOS and %LocalAppData% on Windows.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(dir, applicationName), nil
+}
+
+// stateDir returns the directory of state kept between runs:
+// $XDG_STATE_HOME/markdown-to-epub (~/.local/state by default) on Linux,
+// ~/Library/Application Support on macOS and %LocalAppData% on Windows.
+func stateDir() (string, error) {
+	var dir string
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		dir, err = os.UserConfigDir()
+	case "windows":
+		dir, err = os.UserCacheDir()
+	default:
+		dir = os.Getenv("XDG_STATE_HOME")
+		if !filepath.IsAbs(dir) {
+			var home string
+			home, err = os.UserHomeDir()
+			dir = filepath.Join(home, ".local", "state")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to locate state directory: %w", err)
+	}
+	return filepath.Join(dir, applicationName), nil
+}
+
+// initConfig reads the file given with --config, or else the config file in
+// the config directory, such as config.yaml. A config file that cannot be
+// parsed is an error, as is a missing file given with --config.
+func initConfig() error {
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+		return readConfig()
+	}
+	dir, err := configDir()
+	if err != nil {
+		slog.Warn("can't read config file", "error", err)
+		return nil
+	}
+	if legacy, err := migrateLegacyConfig(dir); err != nil {
+		slog.Warn("can't move config file to the config directory, reading it from its old location", "error", err)
+		viper.SetConfigFile(legacy)
+		return readConfig()
+	}
+	viper.AddConfigPath(dir)
+	viper.SetConfigName("config")
+	if err := readConfig(); err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return err
+	}
+	return nil
+}
+
+func readConfig() error {
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", viper.ConfigFileUsed(), err)
+	}
+	return nil
+}
+
+// legacyConfigNames are the names, without extension, of config files in
+// the home directory of earlier versions: ~/.markdown-to-epub.yaml, and
+// ~/.strava-cli.yaml of the first versions.
+var legacyConfigNames = []string{"." + applicationName, ".strava-cli"}
+
+// migrateLegacyConfig moves a config file from its former location in the
+// home directory, such as ~/.markdown-to-epub.yaml, into dir. A config file
+// already in dir takes precedence and the former one is left alone. It
+// returns the former file when it cannot be moved.
+func migrateLegacyConfig(dir string) (string, error) {
+	legacy := findLegacyConfigFile()
+	if legacy == "" {
+		return "", nil
+	}
+	if existing := findConfigFile(dir); existing != "" {
+		slog.Warn("ignoring config file in the home directory", "file", legacy, "using", existing)
+		return "", nil
+	}
+
+	target := filepath.Join(dir, "config"+filepath.Ext(legacy))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return legacy, err
+	}
+	if err := os.Rename(legacy, target); err != nil {
+		return legacy, err
+	}
+	slog.Info("Moved config file", "from", legacy, "to", target)
+	return "", nil
+}
+
+// findLegacyConfigFile returns the config file in the home directory, if any.
+func findLegacyConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range legacyConfigNames {
+		for _, ext := range viper.SupportedExts {
+			filename := filepath.Join(home, name+"."+ext)
+			if _, err := os.Stat(filename); err == nil {
+				return filename
+			}
+		}
+	}
+	return ""
+}
+
+// findConfigFile returns the config file in dir, if any.
+func findConfigFile(dir string) string {
+	for _, ext := range viper.SupportedExts {
+		filename := filepath.Join(dir, "config."+ext)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return ""
+}
+
+// configFilename returns the config file initConfig reads: the file given
+// with --config, the config file in dir, a config file in the home directory
+// not moved yet, or else the config file to create.
+func configFilename(dir string) string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+	if filename := findConfigFile(dir); filename != "" {
+		return filename
+	}
+	if legacy := findLegacyConfigFile(); legacy != "" {
+		return legacy
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// configurePathLogging replaces the config loading of the root command for
+// the path commands, so that they print locations without reading, moving
+// or downloading config files, and still work when the config file is
+// broken.
+func configurePathLogging(cmd *cobra.Command, args []string) error {
+	return configureLogging(loggingOps)
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:               "config",
+	Short:             "Show the config file location",
+	PersistentPreRunE: configurePathLogging,
+}
+
+// configPathCmd represents the config path command
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the config file in use, or of the config file to create",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := configDir()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), configFilename(dir))
+		return nil
+	},
+}
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:               "cache",
+	Short:             "Show the cache directory location",
+	PersistentPreRunE: configurePathLogging,
+}
+
+// cachePathCmd represents the cache path command
+var cachePathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the cache directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := cacheDir()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), dir)
+		return nil
+	},
+}
+
+// stateCmd represents the state command
+var stateCmd = &cobra.Command{
+	Use:               "state",
+	Short:             "Show the state directory location",
+	PersistentPreRunE: configurePathLogging,
+}
+
+// statePathCmd represents the state path command
+var statePathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the state directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := stateDir()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), dir)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPathCmd)
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cachePathCmd)
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(statePathCmd)
+}
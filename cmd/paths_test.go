@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigCacheAndStateDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the XDG base directories apply to Linux")
+	}
+	isolateConfig(t)
+	home := os.Getenv("HOME")
+
+	config, err := configDir()
+	if err != nil || config != filepath.Join(home, "config", applicationName) {
+		t.Errorf("configDir() = %s, %v, want it under XDG_CONFIG_HOME", config, err)
+	}
+	cache, err := cacheDir()
+	if err != nil || cache != filepath.Join(home, "cache", applicationName) {
+		t.Errorf("cacheDir() = %s, %v, want it under XDG_CACHE_HOME", cache, err)
+	}
+	state, err := stateDir()
+	if err != nil || state != filepath.Join(home, "state", applicationName) {
+		t.Errorf("stateDir() = %s, %v, want it under XDG_STATE_HOME", state, err)
+	}
+
+	t.Setenv("XDG_STATE_HOME", "")
+	state, err = stateDir()
+	if err != nil || state != filepath.Join(home, ".local", "state", applicationName) {
+		t.Errorf("stateDir() = %s, %v, want it under ~/.local/state", state, err)
+	}
+}
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		want     map[string]string
+		unwanted []string
+	}{
+		{
+			name:     "moved into the config directory",
+			files:    map[string]string{".markdown-to-epub.yaml": "author: Jane"},
+			want:     map[string]string{"config/markdown-to-epub/config.yaml": "author: Jane"},
+			unwanted: []string{".markdown-to-epub.yaml"},
+		},
+		{
+			name:     "other formats keep their extension",
+			files:    map[string]string{".markdown-to-epub.json": `{"author": "Jane"}`},
+			want:     map[string]string{"config/markdown-to-epub/config.json": `{"author": "Jane"}`},
+			unwanted: []string{".markdown-to-epub.json"},
+		},
+		{
+			name:     "config file of the first versions",
+			files:    map[string]string{".strava-cli.yaml": "author: Jane"},
+			want:     map[string]string{"config/markdown-to-epub/config.yaml": "author: Jane"},
+			unwanted: []string{".strava-cli.yaml"},
+		},
+		{
+			name: "the newer config file in the home directory takes precedence",
+			files: map[string]string{
+				".markdown-to-epub.yaml": "author: New",
+				".strava-cli.yaml":       "author: Old",
+			},
+			want: map[string]string{
+				"config/markdown-to-epub/config.yaml": "author: New",
+				".strava-cli.yaml":                    "author: Old",
+			},
+		},
+		{
+			name: "a config file in the config directory takes precedence",
+			files: map[string]string{
+				".markdown-to-epub.yaml":              "author: Old",
+				"config/markdown-to-epub/config.yaml": "author: New",
+			},
+			want: map[string]string{
+				".markdown-to-epub.yaml":              "author: Old",
+				"config/markdown-to-epub/config.yaml": "author: New",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			home := os.Getenv("HOME")
+			writeFiles(t, home, tt.files)
+
+			dir, err := configDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if legacy, err := migrateLegacyConfig(dir); legacy != "" || err != nil {
+				t.Fatalf("migrateLegacyConfig() = %s, %v", legacy, err)
+			}
+			for name, want := range tt.want {
+				if content, err := os.ReadFile(filepath.Join(home, name)); err != nil || string(content) != want {
+					t.Errorf("%s = %q (%v), want %q", name, content, err, want)
+				}
+			}
+			for _, name := range tt.unwanted {
+				if _, err := os.Stat(filepath.Join(home, name)); err == nil {
+					t.Errorf("%s exists, want it moved", name)
+				}
+			}
+		})
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	isolateConfig(t)
+	dir, err := configDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{"config.yaml": "author: Jane"})
+
+	initConfig()
+	if got := viper.ConfigFileUsed(); got != filepath.Join(dir, "config.yaml") {
+		t.Errorf("config file used = %s, want config.yaml in the config directory", got)
+	}
+	if got := viper.GetString("author"); got != "Jane" {
+		t.Errorf("author = %s, want Jane", got)
+	}
+}
+
+func TestPathCommands(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the XDG base directories apply to Linux")
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  string
+	}{
+		{
+			name: "config file to create",
+			args: []string{"config", "path"},
+			want: "config/markdown-to-epub/config.yaml",
+		},
+		{
+			name:  "broken config file",
+			files: map[string]string{"config/markdown-to-epub/config.yaml": "author: [Jane\n"},
+			args:  []string{"config", "path"},
+			want:  "config/markdown-to-epub/config.yaml",
+		},
+		{
+			name:  "config file in the home directory is not moved",
+			files: map[string]string{".strava-cli.yaml": "author: Jane\n"},
+			args:  []string{"config", "path"},
+			want:  ".strava-cli.yaml",
+		},
+		{
+			name:  "remote base configs are not downloaded",
+			files: map[string]string{"config/markdown-to-epub/config.yaml": "extends:\n  - url: http://127.0.0.1:1/base.yaml\n    sha256: 00\n"},
+			args:  []string{"cache", "path"},
+			want:  "cache/markdown-to-epub",
+		},
+		{
+			name:  "state path",
+			files: map[string]string{"config/markdown-to-epub/config.yaml": "toc-depth: deep\n"},
+			args:  []string{"state", "path"},
+			want:  "state/markdown-to-epub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			home := os.Getenv("HOME")
+			writeFiles(t, home, tt.files)
+
+			var out bytes.Buffer
+			rootCmd.SetOut(&out)
+			t.Cleanup(func() { rootCmd.SetOut(nil) })
+			rootCmd.SetArgs(tt.args)
+			if err := Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got, want := strings.TrimSpace(out.String()), filepath.Join(home, tt.want); got != want {
+				t.Errorf("%v printed %s, want %s", tt.args, got, want)
+			}
+			for name := range tt.files {
+				if _, err := os.Stat(filepath.Join(home, name)); err != nil {
+					t.Errorf("%s was moved: %v", name, err)
+				}
+			}
+		})
+	}
+}
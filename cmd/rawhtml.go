@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	htmlPassthrough = "passthrough"
+	htmlSanitize    = "sanitize"
+	htmlStrip       = "strip"
+)
+
+var validHTMLPolicies = []string{htmlPassthrough, htmlSanitize, htmlStrip}
+
+func validateHTMLOptions(options generateOptions) error {
+	if !slices.Contains(validHTMLPolicies, options.htmlPolicy) {
+		return fmt.Errorf("invalid HTML policy %s, expected one of %s", options.htmlPolicy, strings.Join(validHTMLPolicies, ", "))
+	}
+	return nil
+}
+
+// allowedElements lists the elements kept by the sanitizer together with the
+// attributes they may carry in addition to the global ones.
+var allowedElements = map[string][]string{
+	"a": {"href"}, "abbr": nil, "address": nil, "article": nil, "aside": nil,
+	"b": nil, "bdi": nil, "bdo": nil, "blockquote": {"cite"}, "br": nil,
+	"caption": nil, "cite": nil, "code": nil, "col": {"span"},
+	"colgroup": {"span"}, "dd": nil, "del": {"datetime"}, "details": nil,
+	"dfn": nil, "div": nil, "dl": nil, "dt": nil, "em": nil,
+	"figcaption": nil, "figure": nil, "footer": nil, "h1": nil, "h2": nil,
+	"h3": nil, "h4": nil, "h5": nil, "h6": nil, "header": nil, "hr": nil,
+	"i": nil, "img": {"src", "alt", "width", "height"},
+	"ins": {"datetime"}, "kbd": nil, "li": {"value"}, "mark": nil,
+	"ol": {"start", "reversed", "type"}, "p": nil, "pre": nil, "q": {"cite"},
+	"rp": nil, "rt": nil, "ruby": nil, "s": nil, "samp": nil, "section": nil,
+	"small": nil, "span": nil, "strong": nil, "sub": nil, "summary": nil,
+	"sup": nil, "table": nil, "tbody": nil, "td": {"colspan", "rowspan"},
+	"tfoot": nil, "th": {"colspan", "rowspan", "scope"}, "thead": nil,
+	"time": {"datetime"}, "tr": nil, "u": nil, "ul": nil, "var": nil,
+	"wbr": nil,
+}
+
+// globalAttributes are the attributes allowed on every element. style is not
+// one of them, since inline CSS can overlay content or fetch remote URLs;
+// classes styled by the book's stylesheet are kept instead.
+var globalAttributes = []string{"id", "class", "title", "lang", "dir", "role", "epub:type"}
+
+// droppedElements are removed by the sanitizer together with their content.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "noscript": true, "template": true, "form": true,
+}
+
+// htmlSanitizer rewrites raw HTML into well-formed XHTML made of allowed
+// elements and attributes only. It keeps state between calls so that content
+// of a dropped element spanning several raw HTML nodes is skipped, and so
+// that end tags only close the elements it opened.
+type htmlSanitizer struct {
+	skipping string
+	open     []string
+}
+
+func (s *htmlSanitizer) sanitize(raw []byte) string {
+	var out strings.Builder
+	tokenizer := nethtml.NewTokenizer(bytes.NewReader(raw))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			return out.String()
+		}
+		token := tokenizer.Token()
+
+		if s.skipping != "" {
+			if tokenType == nethtml.EndTagToken && token.Data == s.skipping {
+				s.skipping = ""
+			}
+			continue
+		}
+
+		switch tokenType {
+		case nethtml.TextToken:
+			out.WriteString(nethtml.EscapeString(token.Data))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedElements[token.Data] {
+				if tokenType == nethtml.StartTagToken {
+					s.skipping = token.Data
+				}
+				continue
+			}
+			allowed, ok := allowedElements[token.Data]
+			if !ok {
+				continue
+			}
+			out.WriteString("<" + token.Data)
+			for _, attr := range token.Attr {
+				if !slices.Contains(globalAttributes, attr.Key) && !slices.Contains(allowed, attr.Key) && !strings.HasPrefix(attr.Key, "aria-") {
+					continue
+				}
+				if (attr.Key == "href" || attr.Key == "src" || attr.Key == "cite") && !isSafeURL(attr.Val) &&
+					!(token.Data == "img" && attr.Key == "src" && isRasterDataURL(attr.Val)) {
+					continue
+				}
+				fmt.Fprintf(&out, " %s=\"%s\"", attr.Key, nethtml.EscapeString(attr.Val))
+			}
+			if voidElements[token.Data] {
+				out.WriteString(" />")
+			} else if tokenType == nethtml.SelfClosingTagToken {
+				out.WriteString("></" + token.Data + ">")
+			} else {
+				out.WriteString(">")
+				s.open = append(s.open, token.Data)
+			}
+		case nethtml.EndTagToken:
+			for i := len(s.open) - 1; i >= 0; i-- {
+				if s.open[i] != token.Data {
+					continue
+				}
+				for j := len(s.open) - 1; j >= i; j-- {
+					out.WriteString("</" + s.open[j] + ">")
+				}
+				s.open = s.open[:i]
+				break
+			}
+		}
+	}
+}
+
+// isSafeURL reports whether a URL attribute value uses a scheme that cannot
+// execute script.
+func isSafeURL(value string) bool {
+	scheme, _, found := strings.Cut(strings.ToLower(strings.TrimSpace(value)), ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	return slices.Contains([]string{"http", "https", "mailto"}, scheme)
+}
+
+// isRasterDataURL reports whether a URL attribute value is an inline JPEG,
+// PNG, GIF or WebP image, which the image embedder stores in the package.
+func isRasterDataURL(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, mediaType := range []string{"image/jpeg", "image/png", "image/gif", "image/webp"} {
+		if strings.HasPrefix(value, "data:"+mediaType+";") || strings.HasPrefix(value, "data:"+mediaType+",") {
+			return true
+		}
+	}
+	return false
+}
+
+// rawHTMLRenderer renders raw HTML nodes according to the --html policy. The
+// passthrough policy is handled by goldmark's own renderer in unsafe mode.
+type rawHTMLRenderer struct {
+	policy    string
+	sanitizer htmlSanitizer
+}
+
+func (r *rawHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(gast.KindHTMLBlock, r.renderHTMLBlock)
+	reg.Register(gast.KindRawHTML, r.renderRawHTML)
+}
+
+func (r *rawHTMLRenderer) renderHTMLBlock(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	n := node.(*gast.HTMLBlock)
+	if entering {
+		var raw []byte
+		for i := 0; i < n.Lines().Len(); i++ {
+			line := n.Lines().At(i)
+			raw = append(raw, line.Value(source)...)
+		}
+		r.write(w, raw)
+	} else if n.HasClosure() {
+		r.write(w, n.ClosureLine.Value(source))
+	}
+	return gast.WalkContinue, nil
+}
+
+func (r *rawHTMLRenderer) renderRawHTML(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkSkipChildren, nil
+	}
+	n := node.(*gast.RawHTML)
+	var raw []byte
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw = append(raw, segment.Value(source)...)
+	}
+	r.write(w, raw)
+	return gast.WalkSkipChildren, nil
+}
+
+func (r *rawHTMLRenderer) write(w util.BufWriter, raw []byte) {
+	if r.policy == htmlSanitize {
+		_, _ = w.WriteString(r.sanitizer.sanitize(raw))
+	}
+}
+
+type rawHTMLExtension struct {
+	policy string
+}
+
+// rawHTMLPolicy returns a goldmark extension that renders raw HTML in the
+// markdown according to policy.
+func rawHTMLPolicy(policy string) goldmark.Extender {
+	return &rawHTMLExtension{policy: policy}
+}
+
+func (e *rawHTMLExtension) Extend(m goldmark.Markdown) {
+	// Other policies keep goldmark's safe mode, which also drops links to
+	// javascript: URLs written in markdown
+	if e.policy == htmlPassthrough {
+		m.Renderer().AddOptions(html.WithUnsafe())
+		return
+	}
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&rawHTMLRenderer{policy: e.policy}, 500),
+	))
+}
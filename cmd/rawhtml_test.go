@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []string
+		want string
+	}{
+		{
+			name: "allowed elements and attributes are kept",
+			raw:  []string{`<p class="note" id="n1" aria-label="Note">Text <em>here</em></p>`},
+			want: `<p class="note" id="n1" aria-label="Note">Text <em>here</em></p>`,
+		},
+		{
+			name: "style attributes are dropped",
+			raw:  []string{`<p style="position:fixed;background:url(https://example.org/t.png)">Text</p>`},
+			want: `<p>Text</p>`,
+		},
+		{
+			name: "event handler attributes are dropped",
+			raw:  []string{`<a href="https://example.org" onclick="steal()">link</a>`},
+			want: `<a href="https://example.org">link</a>`,
+		},
+		{
+			name: "script URLs are dropped",
+			raw:  []string{`<a href=" JavaScript:alert(1)">link</a><img src="javascript:alert(1)" alt="x">`},
+			want: `<a>link</a><img alt="x" />`,
+		},
+		{
+			name: "relative and mail URLs are kept",
+			raw:  []string{`<a href="chapter.xhtml#notes">notes</a><a href="mailto:jane@example.org">mail</a>`},
+			want: `<a href="chapter.xhtml#notes">notes</a><a href="mailto:jane@example.org">mail</a>`,
+		},
+		{
+			name: "raster data images are kept",
+			raw:  []string{`<img src="data:image/png;base64,iVBORw0KGgo=" alt="dot">`},
+			want: `<img src="data:image/png;base64,iVBORw0KGgo=" alt="dot" />`,
+		},
+		{
+			name: "other data URLs are dropped",
+			raw:  []string{`<img src="data:image/svg+xml;base64,PHN2Zz4=" alt="svg"><a href="data:text/html,x">x</a>`},
+			want: `<img alt="svg" /><a>x</a>`,
+		},
+		{
+			name: "dropped elements lose their content",
+			raw:  []string{`<p>a</p><script>alert(1)</script><style>p{}</style><p>b</p>`},
+			want: `<p>a</p><p>b</p>`,
+		},
+		{
+			name: "dropped elements spanning several nodes lose their content",
+			raw:  []string{`<iframe src="https://example.org">`, `<p>inside</p>`, `</iframe><p>after</p>`},
+			want: `<p>after</p>`,
+		},
+		{
+			name: "unknown elements are unwrapped",
+			raw:  []string{`<custom-box><b>bold</b></custom-box>`},
+			want: `<b>bold</b>`,
+		},
+		{
+			name: "text is escaped and void elements are closed",
+			raw:  []string{`<p>a &amp; b <br> &lt;c&gt;</p><span/>`},
+			want: `<p>a &amp; b <br /> &lt;c&gt;</p><span></span>`,
+		},
+		{
+			name: "end tags of elements not opened are dropped",
+			raw:  []string{`</div><p>a</b></p></span>`},
+			want: `<p>a</p>`,
+		},
+		{
+			name: "end tags close the elements opened inside",
+			raw:  []string{`<div><span><span>`, `a</span>`, `</div>`},
+			want: `<div><span><span>a</span></span></div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sanitizer := &htmlSanitizer{}
+			var got string
+			for _, raw := range tt.raw {
+				got += sanitizer.sanitize([]byte(raw))
+			}
+			if got != tt.want {
+				t.Errorf("sanitize() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawHTMLPolicy(t *testing.T) {
+	markdown := "<div onclick=\"x()\">a</div>\n\n[link](javascript:alert(1))"
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{policy: htmlPassthrough, want: "<div onclick=\"x()\">a</div>\n<p><a href=\"javascript:alert(1)\">link</a></p>"},
+		{policy: htmlSanitize, want: "<div>a</div>\n<p><a href=\"\">link</a></p>"},
+		{policy: htmlStrip, want: "<p><a href=\"\">link</a></p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := convertMarkdownToHTML([]byte(markdown), newHeadingIDs(headingIDGitHub), newWikilinkResolver(&manuscript{}), generateOptions{htmlPolicy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("convertMarkdownToHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ssmlNamespace       = "http://www.w3.org/2001/10/synthesis"
+	defaultPLSAlphabet  = "ipa"
+	plsMediaType        = "application/pls+xml"
+	lexiconDir          = "lexicons"
+	sceneBreakClassName = "scene-break"
+)
+
+var ssmlAttributePattern = regexp.MustCompile(`\sssml:[A-Za-z]+\s*=`)
+
+// phonemeSkippedElements are elements whose text is not annotated with
+// pronunciations: code is not prose and ruby readings are pronunciations
+// already.
+var phonemeSkippedElements = map[string]bool{
+	"code": true, "pre": true, "kbd": true, "samp": true, "rt": true, "rp": true,
+}
+
+// plsDocument is a W3C Pronunciation Lexicon Specification document.
+type plsDocument struct {
+	XMLName  xml.Name    `xml:"lexicon"`
+	Alphabet string      `xml:"alphabet,attr"`
+	Lang     string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Lexemes  []plsLexeme `xml:"lexeme"`
+}
+
+type plsLexeme struct {
+	Graphemes []string     `xml:"grapheme"`
+	Phonemes  []plsPhoneme `xml:"phoneme"`
+}
+
+type plsPhoneme struct {
+	Alphabet string `xml:"alphabet,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type pronunciation struct {
+	phoneme  string
+	alphabet string
+}
+
+// lexicon maps words to their pronunciations.
+type lexicon map[string]pronunciation
+
+// loadLexicon reads the graphemes and their first phoneme from a PLS file.
+// Lexemes pronounced by alias only have no phoneme and are ignored.
+func loadLexicon(filename string) (lexicon, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lexicon: %w", err)
+	}
+
+	var document plsDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse lexicon %s: %w", filename, err)
+	}
+
+	words := make(lexicon)
+	for _, lexeme := range document.Lexemes {
+		if len(lexeme.Phonemes) == 0 {
+			continue
+		}
+		phoneme := lexeme.Phonemes[0]
+		alphabet := cmp.Or(phoneme.Alphabet, document.Alphabet, defaultPLSAlphabet)
+		for _, grapheme := range lexeme.Graphemes {
+			if grapheme = strings.TrimSpace(grapheme); grapheme != "" {
+				words[grapheme] = pronunciation{phoneme: strings.TrimSpace(phoneme.Value), alphabet: alphabet}
+			}
+		}
+	}
+	return words, nil
+}
+
+// annotatePronunciations wraps the words of the lexicon found in the text of
+// htmlContent in spans carrying SSML phoneme attributes. Longer words are
+// matched first and words must not be part of a longer word, except in
+// scripts written without spaces.
+func annotatePronunciations(htmlContent string, words lexicon) string {
+	if len(words) == 0 {
+		return htmlContent
+	}
+
+	graphemes := make([]string, 0, len(words))
+	for grapheme := range words {
+		graphemes = append(graphemes, grapheme)
+	}
+	slices.SortFunc(graphemes, func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	escaped := make(map[string]string, len(graphemes))
+	alternatives := make([]string, len(graphemes))
+	for i, grapheme := range graphemes {
+		escaped[html.EscapeString(grapheme)] = grapheme
+		alternatives[i] = regexp.QuoteMeta(html.EscapeString(grapheme))
+	}
+	pattern := regexp.MustCompile(strings.Join(alternatives, "|"))
+
+	var out strings.Builder
+	skipDepth := 0
+	last := 0
+	for _, loc := range htmlTagPattern.FindAllStringIndex(htmlContent, -1) {
+		text := htmlContent[last:loc[0]]
+		if skipDepth == 0 {
+			text = annotateText(text, pattern, escaped, words)
+		}
+		out.WriteString(text)
+
+		tag := htmlContent[loc[0]:loc[1]]
+		if match := tagPattern.FindStringSubmatch(tag); match != nil && phonemeSkippedElements[strings.ToLower(match[2])] && match[4] == "" {
+			if match[1] == "/" {
+				skipDepth = max(skipDepth-1, 0)
+			} else {
+				skipDepth++
+			}
+		}
+		out.WriteString(tag)
+		last = loc[1]
+	}
+	out.WriteString(annotateText(htmlContent[last:], pattern, escaped, words))
+	return out.String()
+}
+
+func annotateText(text string, pattern *regexp.Regexp, escaped map[string]string, words lexicon) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(text, -1) {
+		if !isWordBoundary(text, loc[0], loc[1]) {
+			continue
+		}
+		word := text[loc[0]:loc[1]]
+		p := words[escaped[word]]
+		out.WriteString(text[last:loc[0]])
+		fmt.Fprintf(&out, `<span ssml:alphabet="%s" ssml:ph="%s">%s</span>`, html.EscapeString(p.alphabet), html.EscapeString(p.phoneme), word)
+		last = loc[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// isWordBoundary reports whether text[start:end] is not part of a longer word.
+func isWordBoundary(text string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return !continuesWord(before) && !continuesWord(after)
+}
+
+func continuesWord(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isUnspacedScript(r)
+}
+
+// markSceneBreaks classes thematic breaks as scene breaks, which the read
+// aloud stylesheet turns into pauses.
+func markSceneBreaks(htmlContent string) string {
+	return strings.ReplaceAll(htmlContent, "<hr />", `<hr class="`+sceneBreakClassName+`" />`)
+}
+
+// readAloudCSS returns the CSS Speech rules used by text-to-speech reading
+// systems: a long pause at scene breaks and a short one around headings.
+func readAloudCSS(options generateOptions) string {
+	if !options.readAloud {
+		return ""
+	}
+	return `
+hr.` + sceneBreakClassName + ` {
+    pause: x-strong;
+}
+
+h1, h2, h3, h4, h5, h6 {
+    pause-after: strong;
+}
+`
+}
+
+// ssmlNamespacePatch declares the SSML namespace on the root element of a
+// content document using SSML attributes such as ssml:ph and ssml:alphabet,
+// whether added from the lexicon or written in raw HTML or a cover template.
+func ssmlNamespacePatch(sectionFilename string) epubPatch {
+	return epubPatch{
+		filename: "EPUB/xhtml/" + sectionFilename,
+		apply: func(content []byte) ([]byte, error) {
+			if !ssmlAttributePattern.Match(content) || bytes.Contains(content, []byte("xmlns:ssml=")) {
+				return content, nil
+			}
+			root := []byte(`xmlns="http://www.w3.org/1999/xhtml"`)
+			if !bytes.Contains(content, root) {
+				return nil, fmt.Errorf("root element of %s not found", sectionFilename)
+			}
+			return bytes.Replace(content, root, []byte(`xmlns="http://www.w3.org/1999/xhtml" xmlns:ssml="`+ssmlNamespace+`"`), 1), nil
+		},
+	}
+}
+
+// lexiconPatches returns the patches that embed a PLS file in the epub and
+// reference it from the content documents, so that text-to-speech engines
+// supporting lexicons pronounce its words correctly everywhere. The language
+// of the lexicon defaults to the language of the book.
+func lexiconPatches(filename string, sectionFilenames []string, language string) ([]epubPatch, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lexicon: %w", err)
+	}
+	var document plsDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse lexicon %s: %w", filename, err)
+	}
+
+	href := lexiconDir + "/" + strings.ReplaceAll(filepath.Base(filename), " ", "-")
+	item := fmt.Sprintf("    <item id=\"lexicon\" href=\"%s\" media-type=\"%s\"></item>\n", html.EscapeString(href), plsMediaType)
+	link := fmt.Sprintf("    <link rel=\"pronunciation\" type=\"%s\" hreflang=\"%s\" href=\"../%s\"></link>\n",
+		plsMediaType, html.EscapeString(cmp.Or(document.Lang, language)), html.EscapeString(href))
+
+	patches := []epubPatch{
+		{
+			filename: epubContentDir + href,
+			apply: func([]byte) ([]byte, error) {
+				return content, nil
+			},
+		},
+		{
+			filename: packageFilename,
+			apply: func(content []byte) ([]byte, error) {
+				return insertBefore(content, "</manifest>", item)
+			},
+		},
+	}
+	for _, sectionFilename := range sectionFilenames {
+		patches = append(patches, epubPatch{
+			filename: "EPUB/xhtml/" + sectionFilename,
+			apply: func(content []byte) ([]byte, error) {
+				return insertBefore(content, "</head>", link)
+			},
+		})
+	}
+	return patches, nil
+}
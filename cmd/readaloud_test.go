@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLexicon(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"lexicon.pls": `<?xml version="1.0" encoding="UTF-8"?>
+<lexicon version="1.0" xmlns="http://www.w3.org/2005/01/pronunciation-lexicon" alphabet="x-sampa" xml:lang="en">
+  <lexeme>
+    <grapheme>Nguyen</grapheme>
+    <grapheme>NGUYEN</grapheme>
+    <phoneme>wIn</phoneme>
+  </lexeme>
+  <lexeme>
+    <grapheme>Worcester</grapheme>
+    <phoneme alphabet="ipa">ˈwʊstər</phoneme>
+  </lexeme>
+  <lexeme>
+    <grapheme>W3C</grapheme>
+    <alias>World Wide Web Consortium</alias>
+  </lexeme>
+</lexicon>`})
+
+	got, err := loadLexicon(filepath.Join(dir, "lexicon.pls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lexicon{
+		"Nguyen":    {phoneme: "wIn", alphabet: "x-sampa"},
+		"NGUYEN":    {phoneme: "wIn", alphabet: "x-sampa"},
+		"Worcester": {phoneme: "ˈwʊstər", alphabet: "ipa"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("loadLexicon() = %v, want %v", got, want)
+	}
+	for word, p := range want {
+		if got[word] != p {
+			t.Errorf("loadLexicon()[%s] = %v, want %v", word, got[word], p)
+		}
+	}
+}
+
+func TestAnnotatePronunciations(t *testing.T) {
+	words := lexicon{
+		"Lee":       {phoneme: "li", alphabet: "ipa"},
+		"Lee Chong": {phoneme: "li tʃɒŋ", alphabet: "ipa"},
+		"AT&T":      {phoneme: "eɪ ti ən ti", alphabet: "ipa"},
+		"東京":        {phoneme: "toːkjoː", alphabet: "ipa"},
+	}
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "longer words first",
+			html: "<p>Lee Chong met Lee.</p>",
+			want: `<p><span ssml:alphabet="ipa" ssml:ph="li tʃɒŋ">Lee Chong</span> met <span ssml:alphabet="ipa" ssml:ph="li">Lee</span>.</p>`,
+		},
+		{
+			name: "parts of longer words are left alone",
+			html: "<p>Leeds</p>",
+			want: "<p>Leeds</p>",
+		},
+		{
+			name: "escaped words",
+			html: "<p>AT&amp;T</p>",
+			want: `<p><span ssml:alphabet="ipa" ssml:ph="eɪ ti ən ti">AT&amp;T</span></p>`,
+		},
+		{
+			name: "scripts without spaces",
+			html: "<p>東京都</p>",
+			want: `<p><span ssml:alphabet="ipa" ssml:ph="toːkjoː">東京</span>都</p>`,
+		},
+		{
+			name: "code and attributes are skipped",
+			html: `<p title="Lee"><code>Lee</code></p>`,
+			want: `<p title="Lee"><code>Lee</code></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := annotatePronunciations(tt.html, words); got != tt.want {
+				t.Errorf("annotatePronunciations() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSMLNamespacePatch(t *testing.T) {
+	const root = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">`
+	const declared = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:ssml="` + ssmlNamespace + `" xmlns:epub="http://www.idpf.org/2007/ops">`
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		err     bool
+	}{
+		{
+			name:    "documents with SSML attributes",
+			content: root + `<p><span ssml:ph="liː">Leigh</span></p>`,
+			want:    declared + `<p><span ssml:ph="liː">Leigh</span></p>`,
+		},
+		{
+			name:    "documents without SSML attributes are kept",
+			content: root + `<p>ssml:ph="liː"</p>`,
+			want:    root + `<p>ssml:ph="liː"</p>`,
+		},
+		{
+			name:    "declared namespaces are kept",
+			content: declared + `<span ssml:ph="liː">Leigh</span>`,
+			want:    declared + `<span ssml:ph="liː">Leigh</span>`,
+		},
+		{
+			name:    "documents without a root element",
+			content: `<html><span ssml:ph="liː">Leigh</span>`,
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ssmlNamespacePatch("content.xhtml").apply([]byte(tt.content))
+			if tt.err {
+				if err == nil {
+					t.Error("ssmlNamespacePatch() error = nil, want an error without a root element")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ssmlNamespacePatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAloudCSS(t *testing.T) {
+	if got := readAloudCSS(generateOptions{}); got != "" {
+		t.Errorf("readAloudCSS() without --read-aloud = %q, want empty", got)
+	}
+	if got := readAloudCSS(generateOptions{readAloud: true}); !strings.Contains(got, "hr."+sceneBreakClassName) {
+		t.Errorf("readAloudCSS() = %s, want the scene break pause", got)
+	}
+	if got := markSceneBreaks("<p>a</p><hr /><p>b</p>"); got != `<p>a</p><hr class="scene-break" /><p>b</p>` {
+		t.Errorf("markSceneBreaks() = %s", got)
+	}
+}
+
+func TestLexiconPatches(t *testing.T) {
+	dir := t.TempDir()
+	lexiconPLS := `<lexicon version="1.0" xmlns="http://www.w3.org/2005/01/pronunciation-lexicon" alphabet="ipa" xml:lang="en-GB"><lexeme><grapheme>Leigh</grapheme><phoneme>liː</phoneme></lexeme></lexicon>`
+	writeFiles(t, dir, map[string]string{"my names.pls": lexiconPLS})
+
+	patches, err := lexiconPatches(filepath.Join(dir, "my names.pls"), []string{"section0001.xhtml"}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := patchEpub(testEpub(t, "Book", "Leigh"), patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := zipContents(t, checkMimetype(t, data))
+	if got := contents["EPUB/lexicons/my-names.pls"]; got != lexiconPLS {
+		t.Errorf("embedded lexicon = %q, want %q", got, lexiconPLS)
+	}
+	for filename, want := range map[string]string{
+		packageFilename:                `<item id="lexicon" href="lexicons/my-names.pls" media-type="application/pls+xml"></item>`,
+		"EPUB/xhtml/section0001.xhtml": `<link rel="pronunciation" type="application/pls+xml" hreflang="en-GB" href="../lexicons/my-names.pls"></link>`,
+	} {
+		if !strings.Contains(contents[filename], want) {
+			t.Errorf("%s = %s, want it to contain %s", filename, contents[filename], want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alexhokl/helper/iohelper"
+	"gopkg.in/yaml.v3"
+)
+
+// redactionMask replaces each line of redacted text.
+const redactionMask = "███"
+
+// redactionProfiles are the built-in rule sets accepted by --redact.
+var redactionProfiles = map[string][]redactionRule{
+	"secrets": {
+		{Name: "aws-access-key-id", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+		{Name: "slack-token", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+		{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+		{Name: "private-key", Pattern: `(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`},
+		{Name: "bearer-token", Pattern: `(?i)\bbearer\s+([A-Za-z0-9._~+/-]{20,}=*)`},
+		{Name: "credential-assignment", Pattern: `(?i)\b(?:password|passwd|secret|api[_-]?key|access[_-]?token)\s*[:=]\s*["']?([^\s"']{6,})`},
+	},
+}
+
+// redactionRules is a YAML file of rules given to --redact:
+//
+//	rules:
+//	  - name: internal-host
+//	    pattern: '\b[a-z0-9-]+\.corp\.example\.com\b'
+//	  - name: ticket-password
+//	    pattern: 'pw: (\S+)'
+type redactionRules struct {
+	Rules []redactionRule `yaml:"rules"`
+}
+
+// redactionRule masks the text matched by Pattern, or only the text of its
+// first group when it has groups.
+type redactionRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+
+	regexp *regexp.Regexp
+}
+
+func availableRedactionProfiles() []string {
+	var names []string
+	for name := range redactionProfiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func validateRedactOptions(options generateOptions) error {
+	for _, value := range options.redact {
+		if _, ok := redactionProfiles[value]; !ok && !iohelper.IsFileExist(value) {
+			return fmt.Errorf("redaction rules %s is neither a file nor one of the profiles %s", value, strings.Join(availableRedactionProfiles(), ", "))
+		}
+	}
+	return nil
+}
+
+// loadRedactionRules returns the rules of the built-in profiles and rule
+// files named by values, with their patterns compiled.
+func loadRedactionRules(values []string) ([]redactionRule, error) {
+	var rules []redactionRule
+	for _, value := range values {
+		if profile, ok := redactionProfiles[value]; ok {
+			rules = append(rules, profile...)
+			continue
+		}
+
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redaction rules: %w", err)
+		}
+		var file redactionRules
+		if err := yaml.Unmarshal(content, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse redaction rules %s: %w", value, err)
+		}
+		for i, rule := range file.Rules {
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("redaction rule %d in %s has no pattern", i+1, value)
+			}
+			if rule.Name == "" {
+				rule.Name = rule.Pattern
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of redaction rule %s: %w", rules[i].Name, err)
+		}
+		rules[i].regexp = re
+	}
+	return rules, nil
+}
+
+// redact masks the text matched by the rules in the manuscript content and
+// logs the file and line of each redaction, never the redacted text. Line
+// breaks within matches are kept so that lines still map to their origins.
+func redact(content []byte, rules []redactionRule, book *manuscript) []byte {
+	for _, rule := range rules {
+		var out bytes.Buffer
+		last := 0
+		for _, loc := range rule.regexp.FindAllSubmatchIndex(content, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start == end {
+				continue
+			}
+			origin := book.origin(bytes.Count(content[:start], []byte("\n")) + 1)
+			slog.Info("Redacted", "rule", rule.Name, "file", origin.filename, "line", origin.line)
+
+			out.Write(content[last:start])
+			out.WriteString(maskLines(content[start:end]))
+			last = end
+		}
+		out.Write(content[last:])
+		content = out.Bytes()
+	}
+	return content
+}
+
+func maskLines(text []byte) string {
+	lines := strings.Split(string(text), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = redactionMask
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	configExtendsKey = "extends"
+	configThemeKey   = "theme"
+	remoteTimeout    = 30 * time.Second
+)
+
+// remoteCommandKeys are the config keys naming commands to run, which remote
+// base configs cannot set, so that a pinned config of a shared style does
+// not run commands on the machines of those extending it.
+var remoteCommandKeys = []string{"exec", "rule-exec", "hooks"}
+
+// remoteResource is a file referenced by URL from the config file and pinned
+// by its SHA-256 checksum:
+//
+//	url: https://example.org/publishing/base.yaml
+//	sha256: 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+type remoteResource struct {
+	url    string
+	sha256 string
+}
+
+// resolveRemoteConfig merges the remote base configs listed under extends
+// into settings, the local keys taking precedence, and resolves the top level
+// theme.
+func resolveRemoteConfig(settings map[string]any) (map[string]any, error) {
+	extends, err := remoteResources(settings[configExtendsKey], configExtendsKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(extends) - 1; i >= 0; i-- {
+		content, err := fetchPinned(extends[i])
+		if err != nil {
+			return nil, err
+		}
+		base := viper.New()
+		base.SetConfigType("yaml")
+		if err := base.ReadConfig(bytes.NewReader(content)); err != nil {
+			return nil, fmt.Errorf("failed to parse remote config %s: %w", extends[i].url, err)
+		}
+		baseSettings := base.AllSettings()
+		if _, ok := baseSettings[configExtendsKey]; ok {
+			return nil, fmt.Errorf("remote config %s cannot extend other configs", extends[i].url)
+		}
+		if err := checkRemoteCommands(baseSettings, extends[i].url); err != nil {
+			return nil, err
+		}
+		settings = mergeSettings(baseSettings, settings)
+	}
+
+	if err := resolveTheme(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// checkRemoteCommands fails when the settings of the remote config at url,
+// or of its profiles, name commands to run.
+func checkRemoteCommands(settings map[string]any, url string) error {
+	scopes := map[string]map[string]any{"": settings}
+	if profiles, ok := settings[configProfilesKey].(map[string]any); ok {
+		for name, profile := range profiles {
+			if profileSettings, ok := profile.(map[string]any); ok {
+				scopes[configProfilesKey+"."+name+"."] = profileSettings
+			}
+		}
+	}
+	for prefix, scope := range scopes {
+		for _, key := range remoteCommandKeys {
+			if _, ok := scope[key]; ok {
+				return fmt.Errorf("remote config %s cannot set %s%s, commands are only read from local config files", url, prefix, key)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveTheme downloads the stylesheet named by the theme key of settings
+// and sets the css key to it, unless a css key is given alongside.
+func resolveTheme(settings map[string]any) error {
+	value, ok := settings[configThemeKey]
+	if !ok {
+		return nil
+	}
+	themes, err := remoteResources(value, configThemeKey)
+	if err != nil {
+		return err
+	}
+	if len(themes) != 1 {
+		return fmt.Errorf("config key %s must name a single stylesheet", configThemeKey)
+	}
+	filename, err := fetchPinnedFile(themes[0])
+	if err != nil {
+		return err
+	}
+	if _, ok := settings["css"]; !ok {
+		settings["css"] = filename
+	}
+	return nil
+}
+
+// remoteResources reads the url and sha256 of a config value, which is a
+// single resource or a list of them.
+func remoteResources(value any, key string) ([]remoteResource, error) {
+	var entries []any
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		entries = v
+	default:
+		entries = []any{v}
+	}
+
+	var resources []remoteResource
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("entries of config key %s must have a url and a sha256 checksum", key)
+		}
+		resource := remoteResource{
+			url:    strings.TrimSpace(fmt.Sprint(fields["url"])),
+			sha256: strings.ToLower(strings.TrimSpace(fmt.Sprint(fields["sha256"]))),
+		}
+		if fields["url"] == nil || !strings.HasPrefix(resource.url, "https://") {
+			return nil, fmt.Errorf("entries of config key %s must have an https url", key)
+		}
+		if decoded, err := hex.DecodeString(resource.sha256); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("remote file %s must be pinned with a sha256 checksum of 64 hexadecimal digits", resource.url)
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// fetchPinned returns the content of a remote resource, downloading it once
+// and reusing the copy in the cache directory afterwards.
+func fetchPinned(resource remoteResource) ([]byte, error) {
+	filename, err := fetchPinnedFile(resource)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filename)
+}
+
+// fetchPinnedFile returns the path of the cached copy of a remote resource,
+// downloading it first when there is none. The download must match the
+// pinned checksum, so that a changed remote file fails the build instead of
+// silently changing the books.
+func fetchPinnedFile(resource remoteResource) (string, error) {
+	cache, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "remote")
+	ext := ""
+	if u, err := url.Parse(resource.url); err == nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	filename := filepath.Join(dir, resource.sha256+ext)
+	if content, err := os.ReadFile(filename); err == nil && checksum(content) == resource.sha256 {
+		return filename, nil
+	}
+
+	slog.Info("Downloading", "url", resource.url)
+	client := &http.Client{
+		Timeout: remoteTimeout,
+		Transport: &userAgentTransport{
+			userAgent: epubUserAgent,
+			base:      http.DefaultTransport,
+		},
+	}
+	resp, err := client.Get(resource.url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", resource.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: unexpected status %s", resource.url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", resource.url, err)
+	}
+	if sum := checksum(content); sum != resource.sha256 {
+		return "", fmt.Errorf("checksum of %s is %s, expected %s", resource.url, sum, resource.sha256)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(filename, content, 0o644); err != nil {
+		return "", fmt.Errorf("failed to cache %s: %w", resource.url, err)
+	}
+	return filename, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// mergeSettings returns base overridden by the keys of local. Maps such as
+// profiles and vars are merged key by key.
+func mergeSettings(base, local map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(local))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range local {
+		baseMap, baseIsMap := merged[key].(map[string]any)
+		localMap, localIsMap := value.(map[string]any)
+		if baseIsMap && localIsMap {
+			merged[key] = mergeSettings(baseMap, localMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
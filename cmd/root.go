@@ -2,7 +2,6 @@
 package cmd
 
 import (
-	"github.com/alexhokl/helper/cli"
 	"github.com/spf13/cobra"
 )
 
@@ -13,18 +12,34 @@ var rootCmd = &cobra.Command{
 	Use:          "markdown-to-epub",
 	Short:        "A CLI application to convert markdown files to epub",
 	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Log config file migration and downloads of remote configs per the
+		// command line, then according to the config file
+		if err := configureLogging(loggingOps); err != nil {
+			return err
+		}
+		if err := initConfig(); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd, profile); err != nil {
+			return err
+		}
+		return configureLogging(loggingOps)
+	},
 }
 
-func Execute() {
-	_ = rootCmd.Execute()
+// Execute runs the command given on the command line and returns its error,
+// which cobra has already printed, so that callers can exit with a non-zero
+// status.
+func Execute() error {
+	return rootCmd.Execute()
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.strava-cli.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is config.yaml in the config directory shown by config path)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Named profile of the config file to take option defaults from")
+	rootCmd.PersistentFlags().BoolVarP(&loggingOps.verbose, "verbose", "v", false, "Log the stages of the build with their timings")
+	rootCmd.PersistentFlags().BoolVarP(&loggingOps.quiet, "quiet", "q", false, "Log warnings and errors only")
+	rootCmd.PersistentFlags().StringVar(&loggingOps.format, "log-format", logFormatText, "Log format (text or json)")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
-
-func initConfig() {
-	cli.ConfigureViper(cfgFile, "strava-cli", false, "")
-}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// kindRuby is the goldmark node kind of ruby annotations.
+var kindRuby = gast.NewNodeKind("Ruby")
+
+// rubyNode is a ruby annotation written as {base|reading}. When the base is
+// followed by one reading per character, as in {漢字|かん|じ}, each reading
+// annotates its own character.
+type rubyNode struct {
+	gast.BaseInline
+	base     []byte
+	readings [][]byte
+}
+
+func (n *rubyNode) Kind() gast.NodeKind {
+	return kindRuby
+}
+
+func (n *rubyNode) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{
+		"Base": string(n.base),
+	}, nil)
+}
+
+type rubyParser struct{}
+
+func (p *rubyParser) Trigger() []byte {
+	return []byte{'{'}
+}
+
+func (p *rubyParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	line, _ := block.PeekLine()
+	end := bytes.IndexByte(line, '}')
+	if end == -1 {
+		return nil
+	}
+	inner := line[1:end]
+	if bytes.IndexByte(inner, '{') != -1 {
+		return nil
+	}
+	parts := bytes.Split(inner, []byte{'|'})
+	if len(parts) < 2 || len(bytes.TrimSpace(parts[0])) == 0 {
+		return nil
+	}
+	for _, reading := range parts[1:] {
+		if len(bytes.TrimSpace(reading)) == 0 {
+			return nil
+		}
+	}
+
+	block.Advance(end + 1)
+	return &rubyNode{
+		base:     parts[0],
+		readings: parts[1:],
+	}
+}
+
+type rubyHTMLRenderer struct{}
+
+func (r *rubyHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindRuby, r.renderRuby)
+}
+
+func (r *rubyHTMLRenderer) renderRuby(w util.BufWriter, source []byte, node gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	n := node.(*rubyNode)
+
+	_, _ = w.WriteString("<ruby>")
+	if len(n.readings) > 1 && len(n.readings) == utf8.RuneCount(n.base) {
+		base := n.base
+		for _, reading := range n.readings {
+			_, size := utf8.DecodeRune(base)
+			writeRubyPair(w, base[:size], reading)
+			base = base[size:]
+		}
+	} else {
+		writeRubyPair(w, n.base, bytes.Join(n.readings, nil))
+	}
+	_, _ = w.WriteString("</ruby>")
+	return gast.WalkSkipChildren, nil
+}
+
+// writeRubyPair writes a base and its reading. The reading is wrapped in rp
+// parentheses for reading systems that do not support ruby.
+func writeRubyPair(w util.BufWriter, base, reading []byte) {
+	_, _ = w.Write(util.EscapeHTML(base))
+	_, _ = w.WriteString("<rp>(</rp><rt>")
+	_, _ = w.Write(util.EscapeHTML(reading))
+	_, _ = w.WriteString("</rt><rp>)</rp>")
+}
+
+type rubyExtension struct{}
+
+// rubyAnnotation is a goldmark extension that renders {base|reading} as ruby
+// markup, typically used for furigana.
+var rubyAnnotation = &rubyExtension{}
+
+func (e *rubyExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&rubyParser{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&rubyHTMLRenderer{}, 500),
+	))
+}
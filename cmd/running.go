@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var runningPlaceholderPattern = regexp.MustCompile(`\{(title|chapter|page)\}`)
+
+// runningContentCSS returns @page rules that show the running header and
+// footer templates in the page margins of reading systems that support CSS
+// generated content for paged media. Templates may contain the {title},
+// {chapter} and {page} placeholders.
+func runningContentCSS(options generateOptions, title string) string {
+	if options.runningHeader == "" && options.runningFooter == "" {
+		return ""
+	}
+
+	var css strings.Builder
+	css.WriteString(`
+h1 {
+    string-set: chapter content();
+}
+
+@page {
+`)
+	if options.runningHeader != "" {
+		fmt.Fprintf(&css, "    @top-center {\n        content: %s;\n    }\n", cssContentValue(options.runningHeader, title))
+	}
+	if options.runningFooter != "" {
+		fmt.Fprintf(&css, "    @bottom-center {\n        content: %s;\n    }\n", cssContentValue(options.runningFooter, title))
+	}
+	css.WriteString("}\n")
+	return css.String()
+}
+
+// cssContentValue converts a running content template into a value for the
+// CSS content property.
+func cssContentValue(template, title string) string {
+	var parts []string
+	last := 0
+	for _, match := range runningPlaceholderPattern.FindAllStringSubmatchIndex(template, -1) {
+		if match[0] > last {
+			parts = append(parts, cssString(template[last:match[0]]))
+		}
+		switch template[match[2]:match[3]] {
+		case "title":
+			parts = append(parts, cssString(title))
+		case "chapter":
+			parts = append(parts, "string(chapter)")
+		case "page":
+			parts = append(parts, "counter(page)")
+		}
+		last = match[1]
+	}
+	if last < len(template) {
+		parts = append(parts, cssString(template[last:]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func cssString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\A `)
+	return `"` + value + `"`
+}
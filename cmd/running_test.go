@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSSContentValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		title    string
+		want     string
+	}{
+		{name: "text only", template: "Draft", want: `"Draft"`},
+		{name: "placeholders", template: "{chapter} · {page}", want: `string(chapter) " · " counter(page)`},
+		{name: "title", template: "{title}", title: "The Book", want: `"The Book"`},
+		{name: "quotes and backslashes", template: `"a\b"`, want: `"\"a\\b\""`},
+		{name: "unknown placeholder", template: "{author}", want: `"{author}"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cssContentValue(tt.template, tt.title); got != tt.want {
+				t.Errorf("cssContentValue(%q) = %s, want %s", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunningContentCSS(t *testing.T) {
+	if got := runningContentCSS(generateOptions{}, "Book"); got != "" {
+		t.Errorf("runningContentCSS() without templates = %q, want empty", got)
+	}
+
+	got := runningContentCSS(generateOptions{runningFooter: "{page}"}, "Book")
+	for _, want := range []string{"string-set: chapter content();", "@bottom-center {\n        content: counter(page);"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("runningContentCSS() = %s, want it to contain %s", got, want)
+		}
+	}
+	if strings.Contains(got, "@top-center") {
+		t.Errorf("runningContentCSS() = %s, want no header", got)
+	}
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	chapterSelectionPattern = regexp.MustCompile(`^(?:chapters?\s+)?(\d+(?:-\d+)?(?:\s*,\s*\d+(?:-\d+)?)*)$`)
+	atxH1Pattern            = regexp.MustCompile(`^ {0,3}#(?:[ \t]|\r?\n?$)`)
+	setextH1Pattern         = regexp.MustCompile(`^ {0,3}=+[ \t]*\r?\n?$`)
+)
+
+// chapterRange is an inclusive range of chapter numbers, counted from 1.
+type chapterRange struct {
+	first int
+	last  int
+}
+
+// chapterSelection is the value of --only, such as "chapters 3,5-7".
+type chapterSelection []chapterRange
+
+func validateOnlyOptions(options generateOptions) error {
+	if options.only == "" {
+		return nil
+	}
+	_, err := parseChapterSelection(options.only)
+	return err
+}
+
+func parseChapterSelection(value string) (chapterSelection, error) {
+	match := chapterSelectionPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, fmt.Errorf(`invalid chapter selection %s, expected chapter numbers and ranges such as "chapters 3,5-7"`, value)
+	}
+
+	var selection chapterSelection
+	for _, part := range strings.Split(match[1], ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			last = first
+		}
+		r := chapterRange{}
+		r.first, _ = strconv.Atoi(first)
+		r.last, _ = strconv.Atoi(last)
+		if r.first < 1 || r.last < r.first {
+			return nil, fmt.Errorf("invalid chapter range %s in chapter selection %s", part, value)
+		}
+		selection = append(selection, r)
+	}
+	return selection, nil
+}
+
+func (s chapterSelection) contains(chapter int) bool {
+	for _, r := range s {
+		if chapter >= r.first && chapter <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+func (s chapterSelection) last() int {
+	last := 0
+	for _, r := range s {
+		last = max(last, r.last)
+	}
+	return last
+}
+
+// lineSpan is a range of manuscript content lines, from start up to but not
+// including end.
+type lineSpan struct {
+	start int
+	end   int
+}
+
+// chapterSpans returns the lines of each chapter of the manuscript. The
+// chapters of a book assembled from include directives are the files the
+// master document includes; the chapters of a single file are its h1
+// sections, except for a first h1 repeating the book title. Lines before the
+// first chapter, such as the book title, belong to no chapter.
+func (m *manuscript) chapterSpans(title string) []lineSpan {
+	var spans []lineSpan
+	if len(m.includes) > 0 {
+		for _, file := range m.includes {
+			// Files included by a chapter are part of that chapter
+			if len(spans) == 0 || file.startLine >= spans[len(spans)-1].end {
+				spans = append(spans, lineSpan{start: file.startLine, end: file.endLine})
+			}
+		}
+		return spans
+	}
+
+	var starts []int
+	var fence codeFence
+	var previous []byte
+	first := true
+	number := 0
+	for line := range bytes.Lines(m.content) {
+		number++
+		inFence := fence.code(line)
+		start, text := 0, ""
+		switch {
+		case inFence:
+		case atxH1Pattern.Match(line):
+			start, text = number, string(bytes.TrimSpace(bytes.TrimSpace(line)[1:]))
+		case setextH1Pattern.Match(line) && len(bytes.TrimSpace(previous)) > 0 && number > 1:
+			start, text = number-1, string(bytes.TrimSpace(previous))
+		}
+		previous = line
+		if start == 0 {
+			continue
+		}
+		if !first || text != title {
+			starts = append(starts, start)
+		}
+		first = false
+	}
+	for i, start := range starts {
+		end := number + 1
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		spans = append(spans, lineSpan{start: start, end: end})
+	}
+	return spans
+}
+
+// selectChapters returns a copy of the manuscript containing only the
+// selected chapters and the lines outside every chapter. Included files are
+// kept when some of their lines are.
+func (m *manuscript) selectChapters(selection chapterSelection, title string) (*manuscript, error) {
+	spans := m.chapterSpans(title)
+	if last := selection.last(); last > len(spans) {
+		return nil, fmt.Errorf("cannot select chapter %d, the book has %d chapters", last, len(spans))
+	}
+
+	lines := slices.Collect(bytes.Lines(m.content))
+	keep := make([]bool, len(lines)+1)
+	for i := range keep {
+		keep[i] = true
+	}
+	chapters := 0
+	for i, span := range spans {
+		if selection.contains(i + 1) {
+			chapters++
+			continue
+		}
+		for line := span.start; line < min(span.end, len(keep)); line++ {
+			keep[line] = false
+		}
+	}
+
+	var content []byte
+	var sources []int
+	for i, line := range lines {
+		if keep[i+1] {
+			content = append(content, line...)
+			sources = append(sources, i+1)
+		}
+	}
+	selected := m.withLines(content, sources)
+
+	slog.Info("Building selected chapters only", "chapters", chapters, "of", len(spans))
+	return selected, nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseChapterSelection(t *testing.T) {
+	tests := []struct {
+		value    string
+		chapters []int
+		excluded []int
+		err      bool
+	}{
+		{value: "3", chapters: []int{3}, excluded: []int{2, 4}},
+		{value: "chapters 3,5-7", chapters: []int{3, 5, 6, 7}, excluded: []int{4, 8}},
+		{value: "chapter 2 , 4", chapters: []int{2, 4}, excluded: []int{3}},
+		{value: "0", err: true},
+		{value: "5-3", err: true},
+		{value: "chapters three", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			selection, err := parseChapterSelection(tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseChapterSelection() error = %v, want error %v", err, tt.err)
+			}
+			for _, chapter := range tt.chapters {
+				if !selection.contains(chapter) {
+					t.Errorf("selection %s does not contain chapter %d", tt.value, chapter)
+				}
+			}
+			for _, chapter := range tt.excluded {
+				if selection.contains(chapter) {
+					t.Errorf("selection %s contains chapter %d", tt.value, chapter)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectChapters(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		title string
+		only  string
+		want  string
+		err   string
+	}{
+		{
+			name: "h1 sections of a single file",
+			files: map[string]string{
+				"book.md": "Preface\n\n# One\n\nFirst\n\n```\n# not a chapter\n```\n\nTwo\n===\n\nSecond\n\n# Three\n\nThird\n",
+			},
+			title: "Book",
+			only:  "chapters 1,3",
+			want:  "Preface\n\n# One\n\nFirst\n\n```\n# not a chapter\n```\n\n# Three\n\nThird\n",
+		},
+		{
+			name: "the title heading of a single file belongs to no chapter",
+			files: map[string]string{
+				"book.md": "# Book\n\nIntro\n\n# One\n\nFirst\n\nBook\n===\n\nSecond\n",
+			},
+			title: "Book",
+			only:  "2",
+			want:  "# Book\n\nIntro\n\nBook\n===\n\nSecond\n",
+		},
+		{
+			name: "setext title headings",
+			files: map[string]string{
+				"book.md": "Book\n====\n\n# One\n\nFirst\n",
+			},
+			title: "Book",
+			only:  "1",
+			want:  "Book\n====\n\n# One\n\nFirst\n",
+		},
+		{
+			name: "included files",
+			files: map[string]string{
+				"book.md": "# Book\n<!-- include: one.md -->\n<!-- include: two.md -->\n",
+				"one.md":  "# One\n<!-- include: part.md -->\n",
+				"part.md": "Part of one\n",
+				"two.md":  "# Two\n",
+			},
+			only: "1",
+			want: "# Book\n# One\nPart of one\n",
+		},
+		{
+			name:  "chapters beyond the book",
+			files: map[string]string{"book.md": "# One\n"},
+			only:  "2",
+			err:   "cannot select chapter 2, the book has 1 chapters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			selection, err := parseChapterSelection(tt.only)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			selected, err := book.selectChapters(selection, tt.title)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("selectChapters() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(selected.content); got != tt.want {
+				t.Errorf("selectChapters() content = %q, want %q", got, tt.want)
+			}
+			if len(selected.origins) != strings.Count(tt.want, "\n") {
+				t.Errorf("selectChapters() has %d origins for %d lines", len(selected.origins), strings.Count(tt.want, "\n"))
+			}
+			for _, file := range selected.includes {
+				if file.endLine > len(selected.origins)+1 {
+					t.Errorf("included file %s ends at line %d, after the content", file.filename, file.endLine)
+				}
+			}
+		})
+	}
+}
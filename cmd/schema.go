@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var validSchemaTypes = []string{"string", "integer", "number", "boolean", "date", "list", "map"}
+
+// frontMatterSchema declares the keys the front matter of every chapter must
+// or may carry:
+//
+//	required: [title, status]
+//	properties:
+//	  title:
+//	    type: string
+//	  status:
+//	    type: string
+//	    enum: [draft, review, final]
+type frontMatterSchema struct {
+	Required   []string                  `yaml:"required"`
+	Properties map[string]schemaProperty `yaml:"properties"`
+}
+
+type schemaProperty struct {
+	Type string `yaml:"type"`
+	Enum []any  `yaml:"enum"`
+}
+
+func loadFrontMatterSchema(filename string) (*frontMatterSchema, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read front matter schema: %w", err)
+	}
+
+	var schema frontMatterSchema
+	if err := yaml.Unmarshal(content, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse front matter schema: %w", err)
+	}
+	for key, property := range schema.Properties {
+		if property.Type != "" && !slices.Contains(validSchemaTypes, property.Type) {
+			return nil, fmt.Errorf("invalid type %s of front matter key %s, expected one of %s", property.Type, key, strings.Join(validSchemaTypes, ", "))
+		}
+	}
+	return &schema, nil
+}
+
+// validateManuscript checks the front matter of the chapters of a book and
+// reports every mismatch in a single error.
+func (s *frontMatterSchema) validateManuscript(book *manuscript) error {
+	var problems []string
+	for _, diagnostic := range s.diagnostics(book) {
+		problems = append(problems, diagnostic.String())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("front matter does not match schema:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// diagnostics checks the front matter of the chapters of a book against the
+// schema.
+func (s *frontMatterSchema) diagnostics(book *manuscript) []LintDiagnostic {
+	var diagnostics []LintDiagnostic
+	for _, chapter := range book.chapters() {
+		for _, problem := range s.validate(chapter.matter.fields) {
+			diagnostics = append(diagnostics, LintDiagnostic{
+				Filename: chapter.filename,
+				Rule:     frontMatterSchemaRule,
+				Message:  problem,
+			})
+		}
+	}
+	return diagnostics
+}
+
+func (s *frontMatterSchema) validate(fields map[string]any) []string {
+	var problems []string
+	for _, key := range s.Required {
+		if _, ok := fields[key]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required key %s", key))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(s.Properties)) {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		property := s.Properties[key]
+		if property.Type != "" && !matchesSchemaType(value, property.Type) {
+			problems = append(problems, fmt.Sprintf("key %s must be of type %s", key, property.Type))
+			continue
+		}
+		if len(property.Enum) > 0 && !slices.ContainsFunc(property.Enum, func(allowed any) bool {
+			return fmt.Sprint(allowed) == fmt.Sprint(value)
+		}) {
+			problems = append(problems, fmt.Sprintf("key %s has value %v, expected one of %v", key, value, property.Enum))
+		}
+	}
+	return problems
+}
+
+func matchesSchemaType(value any, schemaType string) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		_, ok := value.(int)
+		return ok
+	case "number":
+		switch value.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "date":
+		_, ok := value.(time.Time)
+		return ok
+	case "list":
+		_, ok := value.([]any)
+		return ok
+	case "map":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateManuscript(t *testing.T) {
+	const schemaYAML = `required: [title, status]
+properties:
+  title:
+    type: string
+  status:
+    type: string
+    enum: [draft, review, final]
+  order:
+    type: integer
+  published:
+    type: date
+`
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   []string
+	}{
+		{
+			name: "matching chapters",
+			files: map[string]string{
+				"book.md": "# Book\n<!-- include: one.md -->\n",
+				"one.md":  "---\ntitle: One\nstatus: draft\norder: 1\npublished: 2024-05-01\n---\n# One\n",
+			},
+		},
+		{
+			name: "missing keys, wrong types and values",
+			files: map[string]string{
+				"book.md": "# Book\n<!-- include: one.md -->\n<!-- include: two.md -->\n",
+				"one.md":  "---\ntitle: One\n---\n# One\n",
+				"two.md":  "---\ntitle: Two\nstatus: done\norder: first\n---\n# Two\n",
+			},
+			err: []string{
+				"one.md: missing required key status",
+				"two.md: key order must be of type integer",
+				"two.md: key status has value done, expected one of [draft review final]",
+			},
+		},
+		{
+			name: "a book without includes is its own chapter",
+			files: map[string]string{
+				"book.md": "---\nstatus: final\n---\n# Book\n",
+			},
+			err: []string{"book.md: missing required key title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.files["schema.yaml"] = schemaYAML
+			writeFiles(t, dir, tt.files)
+
+			schema, err := loadFrontMatterSchema(filepath.Join(dir, "schema.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = schema.validateManuscript(book)
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("validateManuscript() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("validateManuscript() error = nil")
+			}
+			for _, want := range tt.err {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validateManuscript() error = %v, want it to contain %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFrontMatterSchemaInvalidType(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"schema.yaml": "properties:\n  title:\n    type: text\n"})
+
+	_, err := loadFrontMatterSchema(filepath.Join(dir, "schema.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "invalid type text") {
+		t.Errorf("loadFrontMatterSchema() error = %v, want invalid type", err)
+	}
+}
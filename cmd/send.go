@@ -0,0 +1,440 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexhokl/helper/cli"
+	"github.com/alexhokl/helper/iohelper"
+	"github.com/spf13/cobra"
+)
+
+const (
+	sendKindle  = "kindle"
+	sendDevice  = "device"
+	sendCalibre = "calibre"
+
+	smtpPasswordEnv    = "MARKDOWN_TO_EPUB_SMTP_PASSWORD"
+	smtpPasswordKey    = "smtp-password"
+	calibrePasswordEnv = "MARKDOWN_TO_EPUB_CALIBRE_PASSWORD"
+	calibrePasswordKey = "calibre-password"
+	sendTimeout        = 5 * time.Minute
+)
+
+var validSendTargets = []string{sendKindle, sendDevice, sendCalibre}
+
+type sendOptions struct {
+	epubFilename string
+	to           string
+
+	emailTo      string
+	emailFrom    string
+	smtpHost     string
+	smtpPort     int
+	smtpUsername string
+	smtpPassword string
+
+	deviceDir string
+
+	calibreURL       string
+	calibreLibrary   string
+	calibreUsername  string
+	calibrePassword  string
+	calibreDuplicate bool
+}
+
+var sendOps sendOptions
+
+// sendCmd represents the send command
+var sendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Deliver the specified epub file to a Kindle, a connected e-reader or a Calibre library",
+	RunE:  runSend,
+}
+
+func init() {
+	rootCmd.AddCommand(sendCmd)
+
+	flags := sendCmd.Flags()
+	flags.StringVarP(&sendOps.epubFilename, "input", "i", "", "Path to epub file")
+	flags.StringVar(&sendOps.to, "to", "", fmt.Sprintf("Destination (%s)", strings.Join(validSendTargets, ", ")))
+	flags.StringVar(&sendOps.emailTo, "kindle-email", "", "Send-to-Kindle e-mail address of the device")
+	flags.StringVar(&sendOps.emailFrom, "email-from", "", "Sender address, which must be approved in the Kindle settings")
+	flags.StringVar(&sendOps.smtpHost, "smtp-host", "", "SMTP server sending the e-mail")
+	flags.IntVar(&sendOps.smtpPort, "smtp-port", 587, "SMTP server port (465 for implicit TLS, otherwise STARTTLS when offered)")
+	flags.StringVar(&sendOps.smtpUsername, "smtp-username", "", "SMTP username (defaults to --email-from); the password is read from $"+smtpPasswordEnv+" or "+smtpPasswordKey+" in the config file")
+	flags.StringVar(&sendOps.deviceDir, "device-dir", "", "Mount point of the e-reader (detected when not given)")
+	flags.StringVar(&sendOps.calibreURL, "calibre-url", "", "URL of the Calibre content server, e.g. http://localhost:8080")
+	flags.StringVar(&sendOps.calibreLibrary, "calibre-library", "", "ID of the Calibre library (defaults to the default library of the server)")
+	flags.StringVar(&sendOps.calibreUsername, "calibre-username", "", "Username of the Calibre content server; the password is read from $"+calibrePasswordEnv+" or "+calibrePasswordKey+" in the config file")
+	flags.BoolVar(&sendOps.calibreDuplicate, "calibre-allow-duplicate", false, "Add the book even if the library has a book with the same title and author")
+
+	if err := sendCmd.MarkFlagRequired("input"); err != nil {
+		cli.LogUnableToMarkFlagAsRequired("input", err)
+	}
+	if err := sendCmd.MarkFlagRequired("to"); err != nil {
+		cli.LogUnableToMarkFlagAsRequired("to", err)
+	}
+}
+
+func runSend(cmd *cobra.Command, args []string) error {
+	sendOps.smtpPassword = configSecret(smtpPasswordEnv, smtpPasswordKey)
+	sendOps.calibrePassword = configSecret(calibrePasswordEnv, calibrePasswordKey)
+	if err := validateSendOptions(sendOps); err != nil {
+		return err
+	}
+
+	switch sendOps.to {
+	case sendKindle:
+		if err := sendToKindle(sendOps); err != nil {
+			return err
+		}
+		slog.Info("Sent "+sendOps.epubFilename, "to", sendOps.emailTo)
+	case sendDevice:
+		destination, err := copyToDevice(sendOps)
+		if err != nil {
+			return err
+		}
+		slog.Info("Copied "+sendOps.epubFilename, "to", destination)
+	case sendCalibre:
+		bookID, err := addToCalibre(sendOps)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added "+sendOps.epubFilename+" to Calibre", "book", bookID)
+	}
+	return nil
+}
+
+func validateSendOptions(options sendOptions) error {
+	if !iohelper.IsFileExist(options.epubFilename) {
+		return fmt.Errorf("epub file %s does not exist", options.epubFilename)
+	}
+
+	switch options.to {
+	case sendKindle:
+		if options.emailTo == "" || options.emailFrom == "" || options.smtpHost == "" {
+			return fmt.Errorf("sending to kindle requires --kindle-email, --email-from and --smtp-host")
+		}
+		if options.smtpPort < 1 || options.smtpPort > 65535 {
+			return fmt.Errorf("invalid SMTP port %d", options.smtpPort)
+		}
+	case sendDevice:
+		if options.deviceDir != "" && !iohelper.IsDirectoryExist(options.deviceDir) {
+			return fmt.Errorf("device directory %s does not exist", options.deviceDir)
+		}
+	case sendCalibre:
+		u, err := url.Parse(options.calibreURL)
+		if options.calibreURL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("sending to calibre requires --calibre-url with the http or https URL of the content server")
+		}
+	default:
+		return fmt.Errorf("invalid destination %s, expected one of %s", options.to, strings.Join(validSendTargets, ", "))
+	}
+	return nil
+}
+
+// sendToKindle e-mails the epub as an attachment to the Send-to-Kindle
+// address of the device.
+func sendToKindle(options sendOptions) error {
+	content, err := os.ReadFile(options.epubFilename)
+	if err != nil {
+		return fmt.Errorf("failed to read epub: %w", err)
+	}
+	message, err := kindleMessage(options.emailFrom, options.emailTo, filepath.Base(options.epubFilename), content)
+	if err != nil {
+		return err
+	}
+
+	username := options.smtpUsername
+	if username == "" {
+		username = options.emailFrom
+	}
+	var auth smtp.Auth
+	if options.smtpPassword != "" {
+		auth = smtp.PlainAuth("", username, options.smtpPassword, options.smtpHost)
+	}
+	address := net.JoinHostPort(options.smtpHost, strconv.Itoa(options.smtpPort))
+
+	if options.smtpPort != 465 {
+		if err := smtp.SendMail(address, auth, options.emailFrom, []string{options.emailTo}, message); err != nil {
+			return fmt.Errorf("failed to send e-mail: %w", err)
+		}
+		return nil
+	}
+
+	// Port 465 expects TLS from the start instead of STARTTLS
+	conn, err := tls.Dial("tcp", address, &tls.Config{ServerName: options.smtpHost})
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	client, err := smtp.NewClient(conn, options.smtpHost)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+	if err := client.Mail(options.emailFrom); err != nil {
+		return fmt.Errorf("failed to send e-mail: %w", err)
+	}
+	if err := client.Rcpt(options.emailTo); err != nil {
+		return fmt.Errorf("failed to send e-mail: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send e-mail: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send e-mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send e-mail: %w", err)
+	}
+	return client.Quit()
+}
+
+// kindleMessage returns a MIME message with the epub attached.
+func kindleMessage(from, to, filename string, content []byte) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose e-mail: %w", err)
+	}
+	if _, err := fmt.Fprintf(text, "%s\r\n", filename); err != nil {
+		return nil, fmt.Errorf("failed to compose e-mail: %w", err)
+	}
+
+	attachment, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("application/epub+zip", map[string]string{"name": filename})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose e-mail: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 0 {
+		line := encoded[:min(len(encoded), 76)]
+		if _, err := fmt.Fprintf(attachment, "%s\r\n", line); err != nil {
+			return nil, fmt.Errorf("failed to compose e-mail: %w", err)
+		}
+		encoded = encoded[len(line):]
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compose e-mail: %w", err)
+	}
+
+	// Writes to a bytes.Buffer cannot fail
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSuffix(filename, filepath.Ext(filename))))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// eReader is a kind of e-reader recognized on a mounted volume by a file or
+// directory only it has, with the directory books are copied to.
+type eReader struct {
+	name     string
+	marker   string
+	booksDir string
+}
+
+var eReaders = []eReader{
+	{name: "Kobo", marker: ".kobo", booksDir: ""},
+	{name: "Kindle", marker: "system/thumbnails", booksDir: "documents"},
+	{name: "Kindle", marker: "amazon-cover-bug", booksDir: "documents"},
+	{name: "PocketBook", marker: "system/config/books.db", booksDir: "Books"},
+	{name: "reMarkable", marker: ".remarkable", booksDir: ""},
+}
+
+// copyToDevice copies the epub to the books directory of the e-reader at
+// --device-dir, or of the only e-reader found among the mounted volumes, and
+// returns the path of the copy.
+func copyToDevice(options sendOptions) (string, error) {
+	root := options.deviceDir
+	if root == "" {
+		candidates := mountedEReaders()
+		switch len(candidates) {
+		case 0:
+			return "", fmt.Errorf("no e-reader found among the mounted volumes, specify its mount point with --device-dir")
+		case 1:
+		default:
+			return "", fmt.Errorf("found several e-readers at %s, specify one with --device-dir", strings.Join(candidates, ", "))
+		}
+		root = candidates[0]
+	}
+
+	dir := root
+	if reader, ok := detectEReader(root); ok {
+		dir = filepath.Join(root, reader.booksDir)
+		slog.Debug("Detected e-reader", "device", reader.name, "mount", root)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create books directory on device: %w", err)
+	}
+
+	destination := filepath.Join(dir, filepath.Base(options.epubFilename))
+	if err := copyFile(options.epubFilename, destination); err != nil {
+		return "", fmt.Errorf("failed to copy epub to device: %w", err)
+	}
+	return destination, nil
+}
+
+func detectEReader(root string) (eReader, bool) {
+	for _, reader := range eReaders {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(reader.marker))); err == nil {
+			return reader, true
+		}
+	}
+	return eReader{}, false
+}
+
+// mountedEReaders returns the mount points of the recognized e-readers among
+// the removable volumes.
+func mountedEReaders() []string {
+	var candidates []string
+	for _, root := range removableVolumes() {
+		if _, ok := detectEReader(root); ok && !slices.Contains(candidates, root) {
+			candidates = append(candidates, root)
+		}
+	}
+	return candidates
+}
+
+// removableVolumes returns the directories removable volumes are usually
+// mounted at.
+func removableVolumes() []string {
+	var patterns []string
+	switch runtime.GOOS {
+	case "darwin":
+		patterns = []string{"/Volumes/*"}
+	case "windows":
+		for drive := 'D'; drive <= 'Z'; drive++ {
+			patterns = append(patterns, string(drive)+`:\`)
+		}
+	default:
+		username := os.Getenv("USER")
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+		patterns = []string{"/media/" + username + "/*", "/run/media/" + username + "/*", "/media/*", "/mnt/*"}
+	}
+
+	var volumes []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		volumes = append(volumes, matches...)
+	}
+	return volumes
+}
+
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// calibreAddResult is the response of the add-book endpoint of the Calibre
+// content server.
+type calibreAddResult struct {
+	BookID     int             `json:"book_id"`
+	Title      string          `json:"title"`
+	Duplicates json.RawMessage `json:"duplicates"`
+}
+
+// addToCalibre uploads the epub to the library of a Calibre content server,
+// which must allow remote writes, and returns the ID of the new book.
+func addToCalibre(options sendOptions) (int, error) {
+	content, err := os.ReadFile(options.epubFilename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read epub: %w", err)
+	}
+
+	duplicates := "n"
+	if options.calibreDuplicate {
+		duplicates = "y"
+	}
+	endpoint := strings.TrimSuffix(options.calibreURL, "/") + "/cdb/add-book/1/" + duplicates + "/" + url.PathEscape(filepath.Base(options.epubFilename))
+	if options.calibreLibrary != "" {
+		endpoint += "/" + url.PathEscape(options.calibreLibrary)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(content))
+	if err != nil {
+		return 0, err
+	}
+	if options.calibreUsername != "" {
+		req.SetBasicAuth(options.calibreUsername, options.calibrePassword)
+	}
+	client := &http.Client{
+		Timeout: sendTimeout,
+		Transport: &userAgentTransport{
+			userAgent: epubUserAgent,
+			base:      http.DefaultTransport,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload to Calibre: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read Calibre response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to upload to Calibre: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result calibreAddResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse Calibre response: %w", err)
+	}
+	if len(result.Duplicates) > 0 && string(result.Duplicates) != "null" {
+		return 0, fmt.Errorf("the Calibre library already has %s, use --calibre-allow-duplicate to add it anyway", result.Title)
+	}
+	return result.BookID, nil
+}
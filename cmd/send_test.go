@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKindleMessage(t *testing.T) {
+	content := bytes.Repeat([]byte("epub"), 100)
+	message, err := kindleMessage("jane@example.org", "jane_kindle@kindle.com", "Field Guide.epub", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from, to := msg.Header.Get("From"), msg.Header.Get("To"); from != "jane@example.org" || to != "jane_kindle@kindle.com" {
+		t.Errorf("message from %s to %s", from, to)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("message content type = %s (%v), want multipart/mixed", mediaType, err)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	if _, err := reader.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := attachment.FileName(); got != "Field Guide.epub" {
+		t.Errorf("attachment filename = %s, want Field Guide.epub", got)
+	}
+	encoded, err := io.ReadAll(attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line := range strings.Lines(string(encoded)) {
+		if len(strings.TrimRight(line, "\r\n")) > 76 {
+			t.Errorf("attachment line of %d characters, want at most 76", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(string(encoded)))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("attachment = %q (%v), want the epub", decoded, err)
+	}
+}
+
+func TestCopyToDevice(t *testing.T) {
+	epubFilename := filepath.Join(t.TempDir(), "book.epub")
+	writeFiles(t, filepath.Dir(epubFilename), map[string]string{"book.epub": "epub"})
+
+	tests := []struct {
+		name   string
+		device map[string]string
+		want   string
+	}{
+		{name: "Kindle", device: map[string]string{"system/thumbnails/a.jpg": ""}, want: "documents/book.epub"},
+		{name: "Kobo", device: map[string]string{".kobo/KoboReader.sqlite": ""}, want: "book.epub"},
+		{name: "unknown device", device: map[string]string{"notes.txt": ""}, want: "book.epub"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.device)
+			got, err := copyToDevice(sendOptions{epubFilename: epubFilename, deviceDir: root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("copyToDevice() = %s, want %s", got, want)
+			}
+			if content, err := os.ReadFile(got); err != nil || string(content) != "epub" {
+				t.Errorf("copied file = %q (%v), want the epub", content, err)
+			}
+		})
+	}
+}
+
+func TestAddToCalibre(t *testing.T) {
+	epubFilename := filepath.Join(t.TempDir(), "Field Guide.epub")
+	writeFiles(t, filepath.Dir(epubFilename), map[string]string{"Field Guide.epub": "epub"})
+
+	tests := []struct {
+		name     string
+		options  sendOptions
+		response string
+		// truncated announces a response longer than the one written
+		truncated bool
+		path      string
+		want      int
+		err       string
+	}{
+		{
+			name:     "added",
+			options:  sendOptions{calibreUsername: "jane", calibrePassword: "secret"},
+			response: `{"book_id": 42, "title": "Field Guide"}`,
+			path:     "/cdb/add-book/1/n/Field Guide.epub",
+			want:     42,
+		},
+		{
+			name:     "duplicate allowed in a library",
+			options:  sendOptions{calibreDuplicate: true, calibreLibrary: "Books"},
+			response: `{"book_id": 43, "title": "Field Guide"}`,
+			path:     "/cdb/add-book/1/y/Field Guide.epub/Books",
+			want:     43,
+		},
+		{
+			name:     "duplicate",
+			response: `{"title": "Field Guide", "duplicates": [{"title": "Field Guide"}]}`,
+			path:     "/cdb/add-book/1/n/Field Guide.epub",
+			err:      "already has Field Guide",
+		},
+		{
+			name:      "truncated response",
+			response:  `{"book_id": 44`,
+			truncated: true,
+			path:      "/cdb/add-book/1/n/Field Guide.epub",
+			err:       "failed to read Calibre response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("request path = %s, want %s", r.URL.Path, tt.path)
+				}
+				username, password, _ := r.BasicAuth()
+				if username != tt.options.calibreUsername || password != tt.options.calibrePassword {
+					t.Errorf("request credentials = %s:%s", username, password)
+				}
+				if body, _ := io.ReadAll(r.Body); string(body) != "epub" {
+					t.Errorf("request body = %q, want the epub", body)
+				}
+				if tt.truncated {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.response)+10))
+				}
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			options := tt.options
+			options.epubFilename, options.calibreURL = epubFilename, server.URL+"/"
+			got, err := addToCalibre(options)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("addToCalibre() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("addToCalibre() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSendOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"book.epub": ""})
+	epubFilename := filepath.Join(dir, "book.epub")
+
+	tests := []struct {
+		name    string
+		options sendOptions
+		err     string
+	}{
+		{name: "kindle", options: sendOptions{to: sendKindle, emailTo: "a@kindle.com", emailFrom: "a@example.org", smtpHost: "smtp.example.org", smtpPort: 587}},
+		{name: "device", options: sendOptions{to: sendDevice}},
+		{name: "calibre", options: sendOptions{to: sendCalibre, calibreURL: "http://localhost:8080"}},
+		{name: "missing epub", options: sendOptions{epubFilename: filepath.Join(dir, "missing.epub"), to: sendDevice}, err: "does not exist"},
+		{name: "kindle without server", options: sendOptions{to: sendKindle, emailTo: "a@kindle.com", emailFrom: "a@example.org"}, err: "requires --kindle-email, --email-from and --smtp-host"},
+		{name: "missing device directory", options: sendOptions{to: sendDevice, deviceDir: filepath.Join(dir, "missing")}, err: "device directory"},
+		{name: "calibre without scheme", options: sendOptions{to: sendCalibre, calibreURL: "localhost:8080"}, err: "requires --calibre-url"},
+		{name: "unknown destination", options: sendOptions{to: "printer"}, err: "invalid destination printer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.options.epubFilename == "" {
+				tt.options.epubFilename = epubFilename
+			}
+			err := validateSendOptions(tt.options)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validateSendOptions() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validateSendOptions() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const statsSectionFilename = "statistics.xhtml"
+
+var h1TagPattern = regexp.MustCompile(`<h1\b`)
+
+// bookStats holds the word and estimated page counts of a book.
+type bookStats struct {
+	words      int
+	characters int
+	pages      int
+	minutes    int
+	chapters   []chapterStats
+}
+
+// chapterStats holds the counts of an h1 section of a book.
+type chapterStats struct {
+	Title          string `json:"title"`
+	ID             string `json:"id,omitempty"`
+	Words          int    `json:"words"`
+	Characters     int    `json:"characters"`
+	ReadingMinutes int    `json:"readingMinutes"`
+}
+
+func computeStats(htmlContent, title string, options generateOptions) bookStats {
+	text := plainText(htmlContent)
+	words := countWords(text)
+	return bookStats{
+		words:      words,
+		characters: countCharacters(text),
+		pages:      estimatePageCount(words, options.wordsPerPage),
+		minutes:    estimateReadingMinutes(words, options.wordsPerMinute),
+		chapters:   computeChapterStats(htmlContent, title, options.wordsPerMinute),
+	}
+}
+
+// computeChapterStats counts the words of each h1 section of htmlContent.
+// Content before the first h1 is counted as a chapter with the book title.
+func computeChapterStats(htmlContent, title string, wordsPerMinute int) []chapterStats {
+	starts := []int{0}
+	for _, loc := range h1TagPattern.FindAllStringIndex(htmlContent, -1) {
+		starts = append(starts, loc[0])
+	}
+	starts = append(starts, len(htmlContent))
+
+	var chapters []chapterStats
+	for i := 0; i+1 < len(starts); i++ {
+		section := htmlContent[starts[i]:starts[i+1]]
+		text := plainText(section)
+		if i == 0 && strings.TrimSpace(text) == "" {
+			continue
+		}
+		chapter := chapterStats{Title: title}
+		if headings := extractHeadings(section); i > 0 && len(headings) > 0 {
+			chapter.Title, chapter.ID = headings[0].text, headings[0].id
+		}
+		chapter.Words = countWords(text)
+		chapter.Characters = countCharacters(text)
+		chapter.ReadingMinutes = estimateReadingMinutes(chapter.Words, wordsPerMinute)
+		chapters = append(chapters, chapter)
+	}
+	return chapters
+}
+
+// plainText returns the text content of htmlContent.
+func plainText(htmlContent string) string {
+	return html.UnescapeString(htmlTagPattern.ReplaceAllString(htmlContent, " "))
+}
+
+// countWords counts whitespace-separated words in text. Scripts written
+// without spaces between words (Han, Hiragana and Katakana) are
+// counted one character per word.
+func countWords(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isUnspacedScript(r):
+			count++
+			inWord = false
+		case unicode.IsSpace(r):
+			inWord = false
+		case !inWord:
+			count++
+			inWord = true
+		}
+	}
+	return count
+}
+
+// countCharacters counts the characters of text other than whitespace.
+func countCharacters(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// estimatePageCount returns the number of pages needed for words at
+// wordsPerPage, rounding up. A book always has at least one page.
+func estimatePageCount(words, wordsPerPage int) int {
+	pages := (words + wordsPerPage - 1) / wordsPerPage
+	return max(pages, 1)
+}
+
+// estimateReadingMinutes returns the minutes needed to read words at
+// wordsPerMinute, rounding up.
+func estimateReadingMinutes(words, wordsPerMinute int) int {
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
+
+func validateStatsOptions(options generateOptions) error {
+	if options.wordsPerPage <= 0 {
+		return fmt.Errorf("words per page must be positive, got %d", options.wordsPerPage)
+	}
+	if options.wordsPerMinute <= 0 {
+		return fmt.Errorf("words per minute must be positive, got %d", options.wordsPerMinute)
+	}
+	return nil
+}
+
+// statsPage returns the body of the statistics page listing the counts of
+// each chapter and of the whole book.
+func statsPage(stats bookStats) string {
+	var page strings.Builder
+	page.WriteString(`<h1 class="statistics-title">Statistics</h1>
+<table class="statistics">
+<thead>
+<tr><th>Chapter</th><th>Words</th><th>Characters</th><th>Reading time</th></tr>
+</thead>
+<tbody>
+`)
+	for _, chapter := range stats.chapters {
+		fmt.Fprintf(&page, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%d min</td></tr>\n",
+			html.EscapeString(chapter.Title), chapter.Words, chapter.Characters, chapter.ReadingMinutes)
+	}
+	fmt.Fprintf(&page, `</tbody>
+<tfoot>
+<tr><th>Total</th><td>%d</td><td>%d</td><td>%d min</td></tr>
+</tfoot>
+</table>`, stats.words, stats.characters, stats.minutes)
+	return page.String()
+}
+
+// tocWordCounts returns the annotations of the table of contents entries of
+// the chapters, keyed by heading ID.
+func tocWordCounts(stats bookStats) map[string]string {
+	annotations := make(map[string]string)
+	for _, chapter := range stats.chapters {
+		if chapter.ID != "" {
+			annotations[chapter.ID] = fmt.Sprintf("%d words, %d min", chapter.Words, chapter.ReadingMinutes)
+		}
+	}
+	return annotations
+}
+
+// buildSummary is the result of a build printed by --json.
+type buildSummary struct {
+	Output         string         `json:"output"`
+	Title          string         `json:"title"`
+	Words          int            `json:"words"`
+	Characters     int            `json:"characters"`
+	Pages          int            `json:"pages"`
+	ReadingMinutes int            `json:"readingMinutes"`
+	Chapters       []chapterStats `json:"chapters"`
+	Stages         []stageSummary `json:"stages"`
+}
+
+// printBuildSummary writes the build summary as JSON to standard output.
+func printBuildSummary(output, title string, stats bookStats) error {
+	summary := buildSummary{
+		Output:         output,
+		Title:          title,
+		Words:          stats.words,
+		Characters:     stats.characters,
+		Pages:          stats.pages,
+		ReadingMinutes: stats.minutes,
+		Chapters:       stats.chapters,
+		Stages:         stageSummaries(),
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(summary); err != nil {
+		return fmt.Errorf("failed to encode build summary: %w", err)
+	}
+	return nil
+}
+
+// pageCountPatch records the estimated page count in the package metadata.
+func pageCountPatch(pages int) epubPatch {
+	return epubPatch{
+		filename: packageFilename,
+		apply: func(content []byte) ([]byte, error) {
+			return insertBefore(content, "</metadata>", fmt.Sprintf("    <meta property=\"schema:numberOfPages\">%d</meta>\n", pages))
+		},
+	}
+}
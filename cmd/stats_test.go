@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		text       string
+		words      int
+		characters int
+	}{
+		{text: "", words: 0, characters: 0},
+		{text: "  The quick\tbrown\nfox ", words: 4, characters: 16},
+		{text: "東京へ行く", words: 5, characters: 5},
+		{text: "Tokyo 東京", words: 3, characters: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := countWords(tt.text); got != tt.words {
+				t.Errorf("countWords() = %d, want %d", got, tt.words)
+			}
+			if got := countCharacters(tt.text); got != tt.characters {
+				t.Errorf("countCharacters() = %d, want %d", got, tt.characters)
+			}
+		})
+	}
+}
+
+func TestEstimates(t *testing.T) {
+	if got := estimatePageCount(0, 250); got != 1 {
+		t.Errorf("estimatePageCount(0) = %d, want 1", got)
+	}
+	if got := estimatePageCount(251, 250); got != 2 {
+		t.Errorf("estimatePageCount(251) = %d, want 2", got)
+	}
+	if got := estimateReadingMinutes(201, 200); got != 2 {
+		t.Errorf("estimateReadingMinutes(201) = %d, want 2", got)
+	}
+	if err := validateStatsOptions(generateOptions{wordsPerPage: 250}); err == nil {
+		t.Error("validateStatsOptions() without words per minute error = nil, want an error")
+	}
+}
+
+func TestComputeChapterStats(t *testing.T) {
+	html := `<p>Before the first chapter</p>` +
+		`<h1 id="one">One</h1><p>one two three</p>` +
+		`<h1 id="two">Two &amp; more</h1><p>四五</p>`
+	got := computeChapterStats(html, "Book", 2)
+	want := []chapterStats{
+		{Title: "Book", Words: 4, Characters: 21, ReadingMinutes: 2},
+		{Title: "One", ID: "one", Words: 4, Characters: 14, ReadingMinutes: 2},
+		{Title: "Two & more", ID: "two", Words: 5, Characters: 10, ReadingMinutes: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("computeChapterStats() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chapter %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := computeChapterStats(`<h1 id="one">One</h1><p>text</p>`, "Book", 200); len(got) != 1 || got[0].ID != "one" {
+		t.Errorf("computeChapterStats() without leading content = %+v, want only the chapter", got)
+	}
+}
+
+func TestStatsPage(t *testing.T) {
+	stats := bookStats{
+		words: 1200, characters: 6000, minutes: 6,
+		chapters: []chapterStats{{Title: "Salt & Pepper", ID: "salt", Words: 1200, Characters: 6000, ReadingMinutes: 6}},
+	}
+	page := statsPage(stats)
+	for _, want := range []string{
+		"<tr><td>Salt &amp; Pepper</td><td>1200</td><td>6000</td><td>6 min</td></tr>",
+		"<tr><th>Total</th><td>1200</td><td>6000</td><td>6 min</td></tr>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("statsPage() = %s, want it to contain %s", page, want)
+		}
+	}
+	if got := tocWordCounts(stats)["salt"]; got != "1200 words, 6 min" {
+		t.Errorf("tocWordCounts() = %s, want 1200 words, 6 min", got)
+	}
+}
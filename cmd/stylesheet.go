@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alexhokl/helper/iohelper"
+	"github.com/go-shiori/go-epub"
+)
+
+func validateStylesheetOptions(options generateOptions) error {
+	if options.cssFilename != "" && !iohelper.IsFileExist(options.cssFilename) {
+		return fmt.Errorf("stylesheet %s does not exist", options.cssFilename)
+	}
+	for _, font := range options.fonts {
+		if !iohelper.IsFileExist(font) {
+			return fmt.Errorf("font file %s does not exist", font)
+		}
+	}
+	return nil
+}
+
+// userCSS returns the content of the --css stylesheet, which is appended to
+// the generated stylesheet so that its rules take precedence.
+func userCSS(options generateOptions) (string, error) {
+	if options.cssFilename == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(options.cssFilename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stylesheet: %w", err)
+	}
+	return "\n" + string(content), nil
+}
+
+// addFonts embeds the --font files under their own names in the fonts
+// directory, next to the css directory, so that the --css stylesheet can
+// reference them as ../fonts/<filename>.
+func addFonts(e *epub.Epub, options generateOptions) error {
+	for _, font := range options.fonts {
+		if _, err := e.AddFont(font, filepath.Base(font)); err != nil {
+			return fmt.Errorf("failed to add font %s: %w", font, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cssPixelDPI is the resolution of a CSS pixel, which SVG user units map to.
+const cssPixelDPI = 96
+
+var svgManifestItemPattern = regexp.MustCompile(`(<item\b[^>]*\bhref="[^"]*\.svg"[^>]*\bmedia-type=")[^"]*(")`)
+
+// svgRasterizer is an external program converting an SVG read from stdin to a
+// PNG written to stdout.
+type svgRasterizer struct {
+	name string
+	args func(dpi int) []string
+}
+
+// svgRasterizers are tried in order; there is no pure Go SVG renderer that
+// handles text, which diagrams rely on.
+var svgRasterizers = []svgRasterizer{
+	{
+		name: "rsvg-convert",
+		args: func(dpi int) []string {
+			return []string{"--format", "png", "--zoom", strconv.FormatFloat(float64(dpi)/cssPixelDPI, 'f', -1, 64)}
+		},
+	},
+	{
+		name: "inkscape",
+		args: func(dpi int) []string {
+			return []string{"--pipe", "--export-type=png", "--export-dpi=" + strconv.Itoa(dpi), "--export-filename=-"}
+		},
+	},
+}
+
+func validateSVGOptions(options generateOptions) error {
+	if options.svgDPI <= 0 {
+		return fmt.Errorf("SVG DPI must be positive")
+	}
+	if !options.rasterizeSVG {
+		return nil
+	}
+	if _, err := findSVGRasterizer(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func findSVGRasterizer() (svgRasterizer, error) {
+	var names []string
+	for _, rasterizer := range svgRasterizers {
+		if _, err := exec.LookPath(rasterizer.name); err == nil {
+			return rasterizer, nil
+		}
+		names = append(names, rasterizer.name)
+	}
+	return svgRasterizer{}, fmt.Errorf("--rasterize-svg requires one of %s to be installed", strings.Join(names, ", "))
+}
+
+func isSVG(src string) bool {
+	if u, err := url.Parse(src); err == nil && u.Scheme != "" {
+		src = u.Path
+	}
+	return strings.EqualFold(path.Ext(src), ".svg")
+}
+
+// rasterizeSVG converts an SVG image to PNG at dpi.
+func rasterizeSVG(data []byte, dpi int) ([]byte, error) {
+	rasterizer, err := findSVGRasterizer()
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(rasterizer.name, rasterizer.args(dpi)...)
+	command.Stdin = bytes.NewReader(data)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return nil, fmt.Errorf("failed to rasterize SVG with %s: %w: %s", rasterizer.name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// svgMediaTypePatch declares SVG images as image/svg+xml in the manifest.
+// go-epub sniffs media types from the first bytes of a file, which for SVGs
+// with a long prolog, such as exports embedding editor metadata, yields
+// text/xml or text/plain and leaves the image unrendered.
+func svgMediaTypePatch() epubPatch {
+	return epubPatch{
+		filename: packageFilename,
+		apply: func(content []byte) ([]byte, error) {
+			return svgManifestItemPattern.ReplaceAll(content, []byte("${1}image/svg+xml${2}")), nil
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-shiori/go-epub"
+)
+
+func TestSVGMediaTypePatch(t *testing.T) {
+	opf := `<manifest>` +
+		`<item id="diagram" href="images/diagram.svg" media-type="text/xml"></item>` +
+		`<item id="photo" href="images/photo.png" media-type="image/png"></item>` +
+		`</manifest>`
+	got, err := svgMediaTypePatch().apply([]byte(opf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<manifest>` +
+		`<item id="diagram" href="images/diagram.svg" media-type="image/svg+xml"></item>` +
+		`<item id="photo" href="images/photo.png" media-type="image/png"></item>` +
+		`</manifest>`
+	if string(got) != want {
+		t.Errorf("svgMediaTypePatch() = %s, want %s", got, want)
+	}
+}
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: "images/diagram.svg", want: true},
+		{src: "images/DIAGRAM.SVG", want: true},
+		{src: "https://example.org/diagram.svg?version=2", want: true},
+		{src: "images/photo.png"},
+		{src: "https://example.org/render?name=diagram.svg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			if got := isSVG(tt.src); got != tt.want {
+				t.Errorf("isSVG(%s) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSVGRasterizer installs an rsvg-convert on the PATH that writes png and
+// its arguments to args.
+func fakeSVGRasterizer(t *testing.T, png []byte) (args string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rasterizer is a shell script")
+	}
+	dir := t.TempDir()
+	args = filepath.Join(dir, "args")
+	writeFiles(t, dir, map[string]string{"out.png": string(png)})
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\ncat > /dev/null\ncat " + filepath.Join(dir, "out.png") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "rsvg-convert"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return args
+}
+
+func TestRasterizeSVG(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"my diagram.svg": `<svg xmlns="http://www.w3.org/2000/svg"/>`})
+	args := fakeSVGRasterizer(t, testImage(t, "png", 4, 4))
+
+	book, err := epub.NewEpub("Book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := generateOptions{rasterizeSVG: true, svgDPI: 192}
+	if err := validateSVGOptions(options); err != nil {
+		t.Fatal(err)
+	}
+	html := `<img src="` + filepath.Join(dir, "my%20diagram.svg") + `" alt="Diagram" />`
+	got := newImageEmbedder(book, nil, options).embed(html)
+	if want := `<img src="../images/my-diagram.png" alt="Diagram" />`; got != want {
+		t.Errorf("embed() = %s, want %s", got, want)
+	}
+
+	content, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(content)); got != "--format png --zoom 2" {
+		t.Errorf("rasterizer arguments = %s, want --format png --zoom 2", got)
+	}
+}
+
+func TestValidateSVGOptions(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	tests := []struct {
+		name    string
+		options generateOptions
+		err     string
+	}{
+		{name: "defaults", options: generateOptions{svgDPI: 192}},
+		{name: "non-positive DPI", options: generateOptions{svgDPI: 0}, err: "SVG DPI must be positive"},
+		{name: "no rasterizer installed", options: generateOptions{svgDPI: 192, rasterizeSVG: true}, err: "--rasterize-svg requires one of rsvg-convert, inkscape"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSVGOptions(tt.options)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validateSVGOptions() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validateSVGOptions() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
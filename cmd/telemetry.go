@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// StageEvent reports a finished stage of a build, such as parse, process,
+// embed images, add sections or write.
+type StageEvent struct {
+	Stage    string
+	Duration time.Duration
+	// AllocatedBytes is the memory allocated during the stage, including
+	// memory freed since.
+	AllocatedBytes uint64
+	// HeapBytes is the memory in use by the heap at the end of the stage.
+	HeapBytes uint64
+}
+
+var (
+	stageMu        sync.Mutex
+	stageObservers []func(StageEvent)
+	stageEvents    []StageEvent
+)
+
+// OnStage registers a function called with each finished stage of a build.
+// Programs embedding the command line use it to collect stage timings and
+// memory use before calling Execute.
+func OnStage(observer func(StageEvent)) {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	stageObservers = append(stageObservers, observer)
+}
+
+// resetStages forgets the stages of previous builds, so that each build,
+// including repeated builds of programs embedding the command line, only
+// reports its own stages.
+func resetStages() {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	stageEvents = nil
+}
+
+// stageMeter measures the time and memory of a stage.
+type stageMeter struct {
+	name      string
+	start     time.Time
+	allocated uint64
+}
+
+func newStageMeter(name string) stageMeter {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	return stageMeter{name: name, start: time.Now(), allocated: memory.TotalAlloc}
+}
+
+// finish records the stage and notifies the observers.
+func (m stageMeter) finish() StageEvent {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	event := StageEvent{
+		Stage:          m.name,
+		Duration:       time.Since(m.start),
+		AllocatedBytes: memory.TotalAlloc - m.allocated,
+		HeapBytes:      memory.HeapInuse,
+	}
+
+	stageMu.Lock()
+	stageEvents = append(stageEvents, event)
+	observers := stageObservers
+	stageMu.Unlock()
+	for _, observer := range observers {
+		observer(event)
+	}
+	return event
+}
+
+// stageSummary is the time and memory of a stage in the build summary printed
+// by --json.
+type stageSummary struct {
+	Stage          string  `json:"stage"`
+	DurationMs     float64 `json:"durationMs"`
+	AllocatedBytes uint64  `json:"allocatedBytes"`
+	HeapBytes      uint64  `json:"heapBytes"`
+}
+
+func stageSummaries() []stageSummary {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	var summaries []stageSummary
+	for _, event := range stageEvents {
+		summaries = append(summaries, stageSummary{
+			Stage:          event.Stage,
+			DurationMs:     float64(event.Duration.Microseconds()) / 1000,
+			AllocatedBytes: event.AllocatedBytes,
+			HeapBytes:      event.HeapBytes,
+		})
+	}
+	return summaries
+}
+
+// logStageSummary logs the time and memory of each stage of the build at
+// debug level, with its share of the total time, so that slow builds can be
+// attributed to a stage.
+func logStageSummary() {
+	stageMu.Lock()
+	events := stageEvents
+	stageMu.Unlock()
+
+	var total time.Duration
+	var allocated, peak uint64
+	for _, event := range events {
+		total += event.Duration
+		allocated += event.AllocatedBytes
+		peak = max(peak, event.HeapBytes)
+	}
+	for _, event := range events {
+		share := 0
+		if total > 0 {
+			share = int(event.Duration * 100 / total)
+		}
+		slog.Debug("stage summary", "stage", event.Stage, "duration", roundDuration(event.Duration), "share", fmt.Sprintf("%d%%", share),
+			"allocated", kilobytes(event.AllocatedBytes), "heap", kilobytes(event.HeapBytes))
+	}
+	slog.Debug("build summary", "duration", roundDuration(total), "allocated", kilobytes(allocated), "peak", kilobytes(peak))
+}
+
+func kilobytes(bytes uint64) string {
+	return fmt.Sprintf("%d KB", bytes/1024)
+}
+
+// roundDuration rounds durations to a precision that keeps short stages
+// distinguishable from each other.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
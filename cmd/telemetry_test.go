@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordStages starts t with no recorded stages or observers and restores
+// them when t ends.
+func recordStages(t *testing.T) {
+	t.Helper()
+	stageMu.Lock()
+	observers, events := stageObservers, stageEvents
+	stageObservers, stageEvents = nil, nil
+	stageMu.Unlock()
+	t.Cleanup(func() {
+		stageMu.Lock()
+		stageObservers, stageEvents = observers, events
+		stageMu.Unlock()
+	})
+}
+
+func TestStages(t *testing.T) {
+	recordStages(t)
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	var observed []string
+	OnStage(func(event StageEvent) {
+		observed = append(observed, event.Stage)
+	})
+	for _, name := range []string{"parse", "write"} {
+		done := startStage(name)
+		_ = make([]byte, 1<<20)
+		done("files", 2)
+	}
+
+	if want := []string{"parse", "write"}; !slices.Equal(observed, want) {
+		t.Errorf("observed stages = %v, want %v", observed, want)
+	}
+	summaries := stageSummaries()
+	if len(summaries) != 2 || summaries[0].Stage != "parse" || summaries[1].Stage != "write" {
+		t.Fatalf("stageSummaries() = %+v, want parse and write", summaries)
+	}
+	if summaries[0].AllocatedBytes < 1<<20 || summaries[0].HeapBytes == 0 {
+		t.Errorf("stageSummaries() parse = %+v, want the memory allocated", summaries[0])
+	}
+
+	logStageSummary()
+	for _, want := range []string{
+		"msg=\"stage finished\" stage=parse",
+		"files=2",
+		"msg=\"stage summary\" stage=write",
+		"msg=\"build summary\"",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log = %s, want it to contain %s", buf.String(), want)
+		}
+	}
+}
+
+func TestResetStages(t *testing.T) {
+	recordStages(t)
+	var observed int
+	OnStage(func(StageEvent) { observed++ })
+	startStage("parse")()
+
+	resetStages()
+	startStage("write")()
+	summaries := stageSummaries()
+	if len(summaries) != 1 || summaries[0].Stage != "write" {
+		t.Errorf("stageSummaries() = %+v, want write only", summaries)
+	}
+	if observed != 2 {
+		t.Errorf("observers called %d times, want 2 as they are kept", observed)
+	}
+}
+
+func TestRoundDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     time.Duration
+	}{
+		{duration: 1234567 * time.Nanosecond, want: 1200 * time.Microsecond},
+		{duration: 2345678901 * time.Nanosecond, want: 2346 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.duration.String(), func(t *testing.T) {
+			if got := roundDuration(tt.duration); got != tt.want {
+				t.Errorf("roundDuration(%s) = %s, want %s", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"maps"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+const templateDateFormat = "2006-01-02"
+
+// codePlaceholderPattern matches the placeholders of the code left out of
+// markdown templates.
+var codePlaceholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+
+// lineMarkerPattern matches the markers of the lines of markdown templates,
+// which follow the lines through the expansion.
+var lineMarkerPattern = regexp.MustCompile("\x00L(\\d+)\x00")
+
+// templateDateLayouts are the layouts the date function parses dates with.
+var templateDateLayouts = []string{templateDateFormat, time.RFC3339}
+
+// templateEnabled reports whether the markdown should be expanded as a
+// template, which is the case when --template is set or variables are given
+// on the command line or in the front matter.
+func templateEnabled(options generateOptions, matter frontMatter) bool {
+	return options.template || len(options.vars) > 0 || len(matter.Vars) > 0
+}
+
+// templateData returns the values available to templates in the markdown.
+// Title and Date are always defined; variables from the front matter and then
+// --var override them. A title taken from a heading that itself uses
+// variables is expanded first.
+func templateData(options generateOptions, matter frontMatter, title string) map[string]string {
+	data := map[string]string{
+		"Title": title,
+		"Date":  time.Now().Format(templateDateFormat),
+	}
+	maps.Copy(data, matter.Vars)
+	maps.Copy(data, options.vars)
+	if expanded, err := expandTemplate([]byte(data["Title"]), data, templateFuncs(options, matter)); err == nil {
+		data["Title"] = string(expanded)
+	}
+	return data
+}
+
+// expandTemplate executes content as a text/template with data and funcs.
+// References to undefined variables are reported as errors.
+func expandTemplate(content []byte, data map[string]string, funcs template.FuncMap) ([]byte, error) {
+	tmpl, err := template.New("markdown").Funcs(funcs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to expand template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// expandCoverTemplate expands an XHTML template like expandTemplate, with
+// html/template escaping the values for their context, so that a title such
+// as "Tips & Tricks" keeps the cover well-formed. The HTML rendered by
+// markdownify and the paths returned by asset are inserted as they are.
+func expandCoverTemplate(content []byte, data map[string]string, funcs template.FuncMap) ([]byte, error) {
+	funcs = maps.Clone(funcs)
+	if markdownify, ok := funcs["markdownify"].(func(string) (string, error)); ok {
+		funcs["markdownify"] = func(text string) (htmltemplate.HTML, error) {
+			rendered, err := markdownify(text)
+			return htmltemplate.HTML(rendered), err
+		}
+	}
+	if asset, ok := funcs["asset"].(func(string) (string, error)); ok {
+		funcs["asset"] = func(path string) (htmltemplate.URL, error) {
+			resolved, err := asset(path)
+			return htmltemplate.URL(resolved), err
+		}
+	}
+
+	tmpl, err := htmltemplate.New("cover").Funcs(funcs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to expand template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// expandMarkdownTemplate expands the template variables of markdown content
+// like expandTemplate, leaving fenced code blocks and code spans as written,
+// so that books documenting Go templates, Jinja or Handlebars keep their
+// examples. It also returns, for each line of the expansion, the line of
+// content it comes from, as actions add and remove lines.
+func expandMarkdownTemplate(content []byte, data map[string]string, funcs template.FuncMap) ([]byte, []int, error) {
+	var code [][]byte
+	protect := func(segment []byte) []byte {
+		code = append(code, segment)
+		return fmt.Appendf(nil, "\x00%d\x00", len(code)-1)
+	}
+
+	var lines [][]byte
+	var fence codeFence
+	for line := range bytes.Lines(content) {
+		if fence.code(line) {
+			lines = append(lines, protect(line))
+			continue
+		}
+		lines = append(lines, protectCodeSpans(line, protect))
+	}
+
+	// Mark the start of every line, except of lines within actions spanning
+	// several lines, which the markers would break, and of lines joined by
+	// {{- and -}}, which the markers would keep apart
+	marked := make([]bool, len(lines))
+	inAction := false
+	for i, line := range lines {
+		marked[i] = !inAction
+		inAction = endsInAction(line, inAction)
+	}
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte("{{-")) {
+			marked[i] = false
+			for j := i - 1; j >= 0 && len(bytes.TrimSpace(lines[j])) == 0; j-- {
+				marked[j] = false
+			}
+		}
+		if bytes.HasSuffix(bytes.TrimRight(line, " \t\r\n"), []byte("-}}")) {
+			for j := i + 1; j < len(lines); j++ {
+				marked[j] = false
+				if len(bytes.TrimSpace(lines[j])) > 0 {
+					break
+				}
+			}
+		}
+	}
+	var protected bytes.Buffer
+	for i, line := range lines {
+		if marked[i] {
+			fmt.Fprintf(&protected, "\x00L%d\x00", i+1)
+		}
+		protected.Write(line)
+	}
+
+	expanded, err := expandTemplate(protected.Bytes(), data, funcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	expanded = restoreCode(expanded, code)
+
+	// Lines without a marker, added by actions, come from the line of the
+	// last marker, and lines joined by actions from the line of the first
+	var out []byte
+	var sources []int
+	source := 1
+	for line := range bytes.Lines(expanded) {
+		markers := lineMarkerPattern.FindAllSubmatch(line, -1)
+		lineSource := source
+		for i, marker := range markers {
+			number, _ := strconv.Atoi(string(marker[1]))
+			if i == 0 && bytes.HasPrefix(line, marker[0]) {
+				lineSource = number
+			}
+			source = number
+		}
+		line = lineMarkerPattern.ReplaceAll(line, nil)
+		if len(line) == 0 {
+			continue
+		}
+		out = append(out, line...)
+		sources = append(sources, lineSource)
+	}
+	return out, sources, nil
+}
+
+// endsInAction reports whether a template action is still open at the end
+// of line, given whether one was open at its start.
+func endsInAction(line []byte, inAction bool) bool {
+	for len(line) > 0 {
+		delimiter := []byte("{{")
+		if inAction {
+			delimiter = []byte("}}")
+		}
+		i := bytes.Index(line, delimiter)
+		if i == -1 {
+			break
+		}
+		inAction = !inAction
+		line = line[i+len(delimiter):]
+	}
+	return inAction
+}
+
+// restoreCode replaces the placeholders of content with the code segments
+// they were protected from.
+func restoreCode(content []byte, code [][]byte) []byte {
+	return codePlaceholderPattern.ReplaceAllFunc(content, func(placeholder []byte) []byte {
+		index, err := strconv.Atoi(string(codePlaceholderPattern.FindSubmatch(placeholder)[1]))
+		if err != nil || index >= len(code) {
+			return placeholder
+		}
+		return code[index]
+	})
+}
+
+// protectCodeSpans replaces the code spans of line, delimited by backtick
+// strings of equal length, with the result of protect.
+func protectCodeSpans(line []byte, protect func([]byte) []byte) []byte {
+	var out []byte
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			out = append(out, line[i])
+			i++
+			continue
+		}
+		opening := backtickRun(line, i)
+		end := -1
+		for j := i + opening; j < len(line); {
+			if line[j] != '`' {
+				j++
+				continue
+			}
+			run := backtickRun(line, j)
+			if run == opening {
+				end = j + run
+				break
+			}
+			j += run
+		}
+		if end == -1 {
+			out = append(out, line[i:i+opening]...)
+			i += opening
+			continue
+		}
+		out = append(out, protect(line[i:end])...)
+		i = end
+	}
+	return out
+}
+
+func backtickRun(line []byte, start int) int {
+	n := 0
+	for start+n < len(line) && line[start+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// templateFuncs returns the functions available to every template, the
+// markdown and the cover page:
+//
+//   - slugify returns the ID a heading with the text would get
+//   - date formats today, or a YYYY-MM-DD or RFC 3339 date, with a Go layout
+//   - t looks up a key in the translations of the front matter for the book
+//     language, falling back to its base language and then to the key
+//   - markdownify renders inline markdown to HTML
+//   - asset resolves a path relative to the markdown file, so that the file
+//     is embedded wherever the template is used
+//   - upper, lower and default transform values
+func templateFuncs(options generateOptions, matter frontMatter) template.FuncMap {
+	return template.FuncMap{
+		"slugify": func(text string) string {
+			return string(newHeadingIDs(options.headingID).Generate([]byte(text), ast.KindHeading))
+		},
+		"date": func(layout string, value ...string) (string, error) {
+			if len(value) == 0 {
+				return time.Now().Format(layout), nil
+			}
+			for _, dateLayout := range templateDateLayouts {
+				if date, err := time.Parse(dateLayout, value[0]); err == nil {
+					return date.Format(layout), nil
+				}
+			}
+			return "", fmt.Errorf("invalid date %s, expected YYYY-MM-DD or RFC 3339", value[0])
+		},
+		"t": func(key string) string {
+			return translate(matter.Translations, options.language, key)
+		},
+		"markdownify": func(text string) (string, error) {
+			var buf bytes.Buffer
+			md := goldmark.New(goldmark.WithRendererOptions(html.WithXHTML()))
+			if err := md.Convert([]byte(text), &buf); err != nil {
+				return "", err
+			}
+			rendered := strings.TrimSpace(buf.String())
+			if inner, ok := strings.CutPrefix(rendered, "<p>"); ok && strings.Count(rendered, "<p>") == 1 {
+				rendered = strings.TrimSuffix(inner, "</p>")
+			}
+			return rendered, nil
+		},
+		"asset": func(path string) (string, error) {
+			resolved := rebaseLocalPath(path, inputDir(options.markdownFilename))
+			if !isRemoteOrAbsolute(path) {
+				if _, err := os.Stat(resolved); err != nil {
+					return "", fmt.Errorf("asset %s not found: %w", path, err)
+				}
+			}
+			return resolved, nil
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+	}
+}
+
+// translate returns the translation of key for language, trying the base
+// language of a regional code such as zh-TW next.
+func translate(translations map[string]map[string]string, language, key string) string {
+	base, _, _ := strings.Cut(language, "-")
+	for _, lang := range []string{language, base} {
+		if value, ok := translations[lang][key]; ok {
+			return value
+		}
+	}
+	return key
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		options generateOptions
+		matter  frontMatter
+		title   string
+		want    string
+		err     string
+	}{
+		{
+			name:    "title and date",
+			content: "# {{ .Title }}\n{{ .Date }}",
+			title:   "Field Guide",
+			want:    "# Field Guide\n" + time.Now().Format(templateDateFormat),
+		},
+		{
+			name:    "front matter variables",
+			content: "{{ .edition }} edition",
+			matter:  frontMatter{Vars: map[string]string{"edition": "Second"}},
+			want:    "Second edition",
+		},
+		{
+			name:    "command line variables override the front matter",
+			content: "{{ .edition }} edition",
+			options: generateOptions{vars: map[string]string{"edition": "Third"}},
+			matter:  frontMatter{Vars: map[string]string{"edition": "Second"}},
+			want:    "Third edition",
+		},
+		{
+			name:    "variables override the title",
+			content: "{{ .Title }}",
+			options: generateOptions{vars: map[string]string{"Title": "Other"}},
+			title:   "Field Guide",
+			want:    "Other",
+		},
+		{
+			name:    "titles using variables are expanded",
+			content: "{{ .Title }}",
+			matter:  frontMatter{Vars: map[string]string{"edition": "Second"}},
+			title:   "Guide ({{ .edition }})",
+			want:    "Guide (Second)",
+		},
+		{
+			name:    "undefined variables are errors",
+			content: "{{ .audience }}",
+			err:     "failed to expand template",
+		},
+		{
+			name:    "invalid templates are errors",
+			content: "{{ .Title",
+			err:     "failed to parse template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplate([]byte(tt.content), templateData(tt.options, tt.matter, tt.title), templateFuncs(tt.options, tt.matter))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expandTemplate() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expandTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandMarkdownTemplate(t *testing.T) {
+	data := map[string]string{"Title": "Field Guide", "Edition": "Second", "Draft": ""}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		sources []int
+	}{
+		{
+			name:    "fenced code blocks are kept",
+			content: "# {{ .Title }}\n\n```gotemplate\n{{ .Name }}\n```\n",
+			want:    "# Field Guide\n\n```gotemplate\n{{ .Name }}\n```\n",
+			sources: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:    "fences close only with their own marker",
+			content: "~~~\n```\n{{ .Name }}\n~~~\n{{ .Title }}\n",
+			want:    "~~~\n```\n{{ .Name }}\n~~~\nField Guide\n",
+			sources: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:    "code spans are kept",
+			content: "Write `{{ .Name }}` or ``{{ `x` }}`` in {{ .Title }}",
+			want:    "Write `{{ .Name }}` or ``{{ `x` }}`` in Field Guide",
+			sources: []int{1},
+		},
+		{
+			name:    "unmatched backticks are text",
+			content: "`{{ .Title }}",
+			want:    "`Field Guide",
+			sources: []int{1},
+		},
+		{
+			name:    "lines left out by actions",
+			content: "# Book\n{{ if .Draft }}\nDraft\n{{ end }}\nText\n",
+			want:    "# Book\n\nText\n",
+			sources: []int{1, 2, 5},
+		},
+		{
+			name:    "lines added by actions come from the action",
+			content: "# Book\n{{ range 2 }}\n- item\n{{ end }}\nText\n",
+			want:    "# Book\n\n- item\n\n- item\n\nText\n",
+			sources: []int{1, 2, 3, 4, 3, 4, 5},
+		},
+		{
+			name:    "actions spanning lines",
+			content: "# Book\n{{ if\n  .Edition }}Edition: {{ .Edition }}{{ end }}\nText\n",
+			want:    "# Book\nEdition: Second\nText\n",
+			sources: []int{1, 2, 4},
+		},
+		{
+			name:    "lines joined by trim markers",
+			content: "# Book\n{{ if .Edition -}}\n\n  {{ .Edition }}\n  {{- end }}\nText\n",
+			want:    "# Book\nSecond\nText\n",
+			sources: []int{1, 2, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, sources, err := expandMarkdownTemplate([]byte(tt.content), data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expandMarkdownTemplate() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(sources, tt.sources) {
+				t.Errorf("expandMarkdownTemplate() sources = %v, want %v", sources, tt.sources)
+			}
+		})
+	}
+}
+
+func TestExpandedTemplateOrigins(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"book.md": "# Book\n{{ if .Draft }}\nDraft notes\nMore notes\n{{ end }}\n<!-- include: one.md -->\n",
+		"one.md":  "# {{ .Title }}\n\npassword: hunter22\n",
+	})
+	book, err := loadMarkdown(filepath.Join(dir, "book.md"), sourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, sources, err := expandMarkdownTemplate(book.content, map[string]string{"Title": "One", "Draft": ""}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book = book.withLines(expanded, sources)
+
+	if want := "# Book\n\n# One\n\npassword: hunter22\n"; string(book.content) != want {
+		t.Fatalf("content = %q, want %q", book.content, want)
+	}
+	if got := book.origin(5); got.filename != filepath.Join(dir, "one.md") || got.line != 3 {
+		t.Errorf("origin(5) = %+v, want line 3 of one.md", got)
+	}
+	chapters := book.chapters()
+	if len(chapters) != 1 || chapters[0].startLine != 3 || chapters[0].endLine != 6 {
+		t.Errorf("chapters() = %+v, want one.md on lines 3 to 5", chapters)
+	}
+}
+
+func TestTemplateEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		options generateOptions
+		matter  frontMatter
+		want    bool
+	}{
+		{name: "disabled by default"},
+		{name: "--template", options: generateOptions{template: true}, want: true},
+		{name: "--var", options: generateOptions{vars: map[string]string{"a": "b"}}, want: true},
+		{name: "front matter variables", matter: frontMatter{Vars: map[string]string{"a": "b"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templateEnabled(tt.options, tt.matter); got != tt.want {
+				t.Errorf("templateEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"book.md": "", "images/map.png": ""})
+	options := generateOptions{markdownFilename: filepath.Join(dir, "book.md"), language: "zh-TW"}
+	matter := frontMatter{Translations: map[string]map[string]string{"zh": {"chapter": "章"}}}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		err     string
+	}{
+		{name: "slugify", content: `{{ slugify "The End!" }}`, want: "the-end"},
+		{name: "date of a value", content: `{{ date "2 Jan 2006" "2024-03-05" }}`, want: "5 Mar 2024"},
+		{name: "date of an RFC 3339 value", content: `{{ date "2006" "2024-03-05T10:00:00Z" }}`, want: "2024"},
+		{name: "date of today", content: `{{ date "2006-01-02" }}`, want: time.Now().Format(templateDateFormat)},
+		{name: "invalid date", content: `{{ date "2006" "March" }}`, err: "invalid date March"},
+		{name: "translation of the base language", content: `{{ t "chapter" }}`, want: "章"},
+		{name: "missing translation", content: `{{ t "part" }}`, want: "part"},
+		{name: "markdownify", content: `{{ markdownify "*Second* edition" }}`, want: "<em>Second</em> edition"},
+		{name: "asset", content: `{{ asset "images/map.png" }}`, want: filepath.Join(dir, "images/map.png")},
+		{name: "remote asset", content: `{{ asset "https://example.org/map.png" }}`, want: "https://example.org/map.png"},
+		{name: "missing asset", content: `{{ asset "images/missing.png" }}`, err: "asset images/missing.png not found"},
+		{name: "upper, lower and default", content: `{{ upper "a" }}{{ lower "B" }}{{ default "none" "" }}`, want: "Abnone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplate([]byte(tt.content), nil, templateFuncs(options, matter))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expandTemplate() error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expandTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateAssetOfDirectoryInput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"one.md": "", "images/map.png": ""})
+	got, err := expandTemplate([]byte(`{{ asset "images/map.png" }}`), nil, templateFuncs(generateOptions{markdownFilename: dir}, frontMatter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "images/map.png"); string(got) != want {
+		t.Errorf("expandTemplate() = %s, want %s", got, want)
+	}
+}
+
+func TestGenerateCoverPage(t *testing.T) {
+	saved := generateOps
+	t.Cleanup(func() { generateOps = saved })
+
+	generateOps = generateOptions{}
+	got, err := generateCoverPage("Tips & <Tricks>", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `<h1 class="cover-title">Tips &amp; &lt;Tricks&gt;</h1>`) {
+		t.Errorf("generateCoverPage() = %s, want the title escaped", got)
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"book.md": "", "a&b.jpg": ""})
+	generateOps = generateOptions{markdownFilename: filepath.Join(dir, "book.md")}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "functions",
+			template: `<h1>{{ upper .Title }}</h1>`,
+			want:     "<h1>TIPS &amp; &lt;TRICKS&gt;</h1>",
+		},
+		{
+			name:     "values are escaped",
+			template: `<h1 title="{{ .Title }}">{{ .Title }}</h1>`,
+			want:     `<h1 title="Tips &amp; &lt;Tricks&gt;">Tips &amp; &lt;Tricks&gt;</h1>`,
+		},
+		{
+			name:     "markdownify inserts HTML",
+			template: `<p>{{ markdownify "*Second* & final" }}</p>`,
+			want:     "<p><em>Second</em> &amp; final</p>",
+		},
+		{
+			name:     "asset paths are kept",
+			template: `<img src="{{ asset "a&b.jpg" }}" alt="" />`,
+			want:     `<img src="` + strings.ReplaceAll(filepath.Join(dir, "a&b.jpg"), "&", "&amp;") + `" alt="" />`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generateOps.coverTemplateFilename = filepath.Join(dir, "cover.xhtml")
+			if err := os.WriteFile(generateOps.coverTemplateFilename, []byte(tt.template), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := generateCoverPage("Tips & <Tricks>", map[string]string{"Title": "Tips & <Tricks>"}, templateFuncs(generateOps, frontMatter{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("generateCoverPage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
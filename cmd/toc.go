@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+func validateTOCOptions(options generateOptions) error {
+	if options.tocDepth < 0 || options.tocDepth > 6 {
+		return fmt.Errorf("table of contents depth must be between 0 and 6")
+	}
+	return nil
+}
+
+// tocPatch returns the patch that lists the headings of the chapters, down to
+// level depth, under the chapter entries of the table of contents. go-epub
+// only lists the sections themselves. A leading h1 repeating the chapter title
+// is represented by the chapter entry, which lists its subheadings, and the
+// headings after it, such as further h1 chapters, follow the chapter entry.
+// Annotations, keyed by heading ID, are shown after the heading titles.
+func tocPatch(outline bookOutline, depth int, annotations map[string]string) epubPatch {
+	return epubPatch{
+		filename: navFilename,
+		apply: func(content []byte) ([]byte, error) {
+			for _, chapter := range outline.Chapters {
+				headings := chapter.Headings
+				var following []*outlineHeading
+				if len(headings) > 0 && headings[0].Level == 1 && headings[0].Title == chapter.Title {
+					headings, following = headings[0].Children, headings[1:]
+				}
+				list := tocList(headings, depth, annotations, "          ")
+				items := tocItems(following, depth, annotations, "      ")
+				if list == "" && items == "" {
+					continue
+				}
+
+				anchor := bytes.Index(content, []byte(`<a href="`+chapter.Href+`">`))
+				if anchor < 0 {
+					return nil, fmt.Errorf("table of contents entry for %s not found", chapter.Href)
+				}
+				end := bytes.Index(content[anchor:], []byte("</li>"))
+				if end < 0 {
+					return nil, fmt.Errorf("end of the table of contents entry for %s not found", chapter.Href)
+				}
+				end += anchor + len("</li>")
+
+				updated, err := insertBefore(content[anchor:end], "</li>", list)
+				if err != nil {
+					return nil, err
+				}
+				if items != "" {
+					updated = append(updated, "\n"+strings.TrimSuffix(items, "\n")...)
+				}
+				content = slices.Concat(content[:anchor], updated, content[end:])
+			}
+			return content, nil
+		},
+	}
+}
+
+func tocList(headings []*outlineHeading, depth int, annotations map[string]string, indent string) string {
+	items := tocItems(headings, depth, annotations, indent)
+	if items == "" {
+		return ""
+	}
+	return indent + "<ol>\n" + items + indent + "</ol>\n"
+}
+
+// tocItems returns the list items of headings, down to level depth, with
+// their subheadings nested.
+func tocItems(headings []*outlineHeading, depth int, annotations map[string]string, indent string) string {
+	var items strings.Builder
+	for _, h := range headings {
+		if h.Level > depth {
+			continue
+		}
+		title := h.Title
+		if annotation, ok := annotations[h.ID]; ok {
+			title += " (" + annotation + ")"
+		}
+		fmt.Fprintf(&items, "%s  <li>\n%s    <a href=\"%s\">%s</a>\n", indent, indent, html.EscapeString(h.Href), html.EscapeString(title))
+		items.WriteString(tocList(h.Children, depth, annotations, indent+"    "))
+		fmt.Fprintf(&items, "%s  </li>\n", indent)
+	}
+	return items.String()
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTOCPatch(t *testing.T) {
+	nav := `<ol>
+        <li>
+          <a href="xhtml/content.xhtml">Book</a>
+        </li>
+      </ol>`
+	html := `<h1 id="book">Book</h1><h2 id="one">One</h2><h3 id="detail">Detail</h3><h2 id="two">Two &amp; Three</h2>`
+
+	tests := []struct {
+		name        string
+		depth       int
+		annotations map[string]string
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:    "subheadings of the title are listed",
+			depth:   2,
+			want:    []string{`<a href="xhtml/content.xhtml#one">One</a>`, `<a href="xhtml/content.xhtml#two">Two &amp; Three</a>`},
+			notWant: []string{`#book"`, `#detail"`},
+		},
+		{
+			name:  "deeper levels are nested",
+			depth: 3,
+			want:  []string{`<a href="xhtml/content.xhtml#one">One</a> <ol> <li> <a href="xhtml/content.xhtml#detail">Detail</a>`},
+		},
+		{
+			name:        "annotations follow the titles",
+			depth:       2,
+			annotations: map[string]string{"one": "120 words, 1 min"},
+			want:        []string{`<a href="xhtml/content.xhtml#one">One (120 words, 1 min)</a>`},
+		},
+		{
+			name:    "depth 1 lists no headings",
+			depth:   1,
+			notWant: []string{"#one"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outline := buildOutline("Book", "content.xhtml", html)
+			got, err := tocPatch(outline, tt.depth, tt.annotations).apply([]byte(nav))
+			if err != nil {
+				t.Fatal(err)
+			}
+			flat := strings.Join(strings.Fields(string(got)), " ")
+			for _, want := range tt.want {
+				if !strings.Contains(flat, want) {
+					t.Errorf("tocPatch() = %s, want it to contain %s", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(flat, notWant) {
+					t.Errorf("tocPatch() = %s, want it not to contain %s", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestTOCPatchChaptersAfterTitle(t *testing.T) {
+	nav := `<ol>
+        <li>
+          <a href="xhtml/content.xhtml">Book</a>
+        </li>
+      </ol>`
+	html := numberHeadings(`<h1 id="book">Book</h1><h2 id="notes">Notes</h2><h1 id="two">Chapter Two</h1><h2 id="details">Details</h2>`, "Book", nil)
+	got, err := tocPatch(buildOutline("Book", "content.xhtml", html), 2, nil).apply([]byte(nav))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<ol>
+        <li>
+          <a href="xhtml/content.xhtml">Book</a>
+          <ol>
+            <li>
+              <a href="xhtml/content.xhtml#notes">1 Notes</a>
+            </li>
+          </ol>
+        </li>
+        <li>
+          <a href="xhtml/content.xhtml#two">1 Chapter Two</a>
+          <ol>
+            <li>
+              <a href="xhtml/content.xhtml#details">1.1 Details</a>
+            </li>
+          </ol>
+        </li>
+      </ol>`
+	if string(got) != want {
+		t.Errorf("tocPatch() = %s, want %s", got, want)
+	}
+}
+
+func TestTOCPatchMissingEntry(t *testing.T) {
+	outline := buildOutline("Book", "content.xhtml", `<h1 id="book">Book</h1><h2 id="one">One</h2>`)
+	if _, err := tocPatch(outline, 2, nil).apply([]byte("<ol></ol>")); err == nil {
+		t.Error("tocPatch() error = nil, want an error for a missing entry")
+	}
+}
@@ -1,7 +1,13 @@
 package main
 
-import "github.com/alexhokl/markdown-to-epub/cmd"
+import (
+	"os"
+
+	"github.com/alexhokl/markdown-to-epub/cmd"
+)
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }